@@ -1,11 +1,17 @@
 package cmd
 
 import (
+	"time"
+
 	"github.com/fize/go-ext/log"
 	"github.com/gin-gonic/gin"
 	"github.com/hex-techs/blade/pkg/router"
+	"github.com/hex-techs/blade/pkg/utils/casbin"
 	"github.com/hex-techs/blade/pkg/utils/config"
+	"github.com/hex-techs/blade/pkg/utils/password"
 	"github.com/hex-techs/blade/pkg/utils/storage"
+	"github.com/hex-techs/blade/pkg/utils/token"
+	"github.com/hex-techs/blade/pkg/utils/web"
 )
 
 func Run() *gin.Engine {
@@ -14,14 +20,29 @@ func Run() *gin.Engine {
 	}
 	logger := log.InitLogger()
 	defer logger.Sync()
+	if err := token.LoadKeys(config.Read().Jwt); err != nil {
+		log.Fatalf("load jwt signing keys error: %v", err)
+	}
+	if err := password.LoadBreachedList(); err != nil {
+		log.Fatalf("%v", err)
+	}
 
 	s := storage.NewEngine(config.Read().DB.Host, config.Read().DB.DB, config.Read().DB.User, config.Read().DB.Password)
 	initDB(s)
 	if err := initAdmin(s); err != nil {
 		log.Fatalf("initialize administrator user error: %v", err)
 	}
+	e, err := casbin.Init(s, time.Second*time.Duration(config.Read().Authz.PolicyReloadInterval))
+	if err != nil {
+		log.Fatalf("initialize casbin enforcer error: %v", err)
+	}
+	web.SetAuthorizer(casbin.NewAuthorizer(e, s))
 
 	r := gin.Default()
-	router.InstallAPI(r, s)
+	// 登录锁定、会话和审计日志都使用客户端地址，不能信任任意来源的X-Forwarded-For
+	if err := r.SetTrustedProxies(config.Read().Service.TrustedProxies); err != nil {
+		log.Fatalf("set trusted proxies error: %v", err)
+	}
+	router.InstallAPI(r, s, e)
 	return r
 }
@@ -2,6 +2,7 @@ package cmd
 
 import (
 	"context"
+	"fmt"
 
 	"github.com/fize/go-ext/log"
 	"github.com/hex-techs/blade/pkg/models"
@@ -29,26 +30,104 @@ func initDB(s *storage.Engine) {
 		c, _ := db.DB()
 		c.SetMaxOpenConns(config.Read().DB.MaxOpenConns)
 	}
+	// 模块成员的唯一索引增加了用户组、项目和申请，删除旧的索引
+	for _, index := range []string{"idx_module_member", "idx_module_subject"} {
+		if db.Migrator().HasIndex(&models.ModuleMember{}, index) {
+			if err := db.Migrator().DropIndex(&models.ModuleMember{}, index); err != nil {
+				log.Fatalf("drop index %s error: %v", index, err)
+				return
+			}
+		}
+	}
+	// 模块成员可以是服务账号，唯一索引需要包含服务账号id
+	if !db.Migrator().HasColumn(&models.ModuleMember{}, "ServiceAccountID") &&
+		db.Migrator().HasIndex(&models.ModuleMember{}, "idx_module_grant") {
+		if err := db.Migrator().DropIndex(&models.ModuleMember{}, "idx_module_grant"); err != nil {
+			log.Fatalf("drop index idx_module_grant error: %v", err)
+			return
+		}
+	}
 	// 自动迁移
-	if err := db.AutoMigrate(&models.User{}, &models.Module{}); err != nil {
+	if err := db.AutoMigrate(&models.User{}, &models.Module{}, &models.Project{}, &models.PersonalAccessToken{},
+		&models.RefreshToken{}, &models.Session{}, &models.PasswordResetToken{},
+		&models.PasswordHistory{}, &models.MFARecoveryCode{}, &models.LoginAttempt{},
+		&models.ModuleMember{}, &models.Invitation{}, &models.ServiceAccount{},
+		&models.ServiceAccountToken{}, &models.AuditLog{}, &models.PolicyRevision{},
+		&models.Group{}, &models.GroupMember{}, &models.AccessRequest{}, &models.UserPreference{},
+		&models.UserAvatar{}); err != nil {
 		log.Fatalf("auto migrate table error: %v", err)
 		return
 	}
+	if err := migrateUserIndexes(db); err != nil {
+		log.Fatalf("migrate user indexes error: %v", err)
+		return
+	}
 	log.Info("initialize database ok!")
 }
 
+// 用户名和邮箱只在未删除的用户中唯一，已删除的用户名可以重新创建，没有邮箱的外部用户不受限制，
+// gorm的标签不能声明表达式索引，需要手动创建，mysql需要8.0.13及以上版本
+var userIndexes = []struct {
+	name   string
+	column string
+	expr   string
+}{
+	{"idx_users_active_name", "name", "CASE WHEN deleted_at IS NULL THEN name END"},
+	{"idx_users_active_email", "email", "CASE WHEN deleted_at IS NULL THEN NULLIF(email, '') END"},
+}
+
+// migrateUserIndexes 删除包含已删除用户和空邮箱的旧唯一索引，创建只约束未删除用户的唯一索引
+func migrateUserIndexes(db *gorm.DB) error {
+	for _, index := range []string{"idx_users_name", "idx_users_email"} {
+		if db.Migrator().HasIndex(&models.User{}, index) {
+			if err := db.Migrator().DropIndex(&models.User{}, index); err != nil {
+				return err
+			}
+		}
+	}
+	for _, index := range userIndexes {
+		if db.Migrator().HasIndex(&models.User{}, index.name) {
+			continue
+		}
+		if err := checkDuplicateUsers(db, index.column); err != nil {
+			return err
+		}
+		if err := db.Exec(fmt.Sprintf("CREATE UNIQUE INDEX %s ON users ((%s))", index.name, index.expr)).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// checkDuplicateUsers 未删除的用户中存在重复的用户名或邮箱时无法创建唯一索引，需要先手动处理
+func checkDuplicateUsers(db *gorm.DB, column string) error {
+	var duplicates []string
+	// mysql默认不区分大小写，按小写比较
+	expr := "LOWER(" + column + ")"
+	if err := db.Model(&models.User{}).Where(column+" <> ''").Group(expr).Having("COUNT(*) > 1").
+		Pluck(expr, &duplicates).Error; err != nil {
+		return err
+	}
+	if len(duplicates) > 0 {
+		return fmt.Errorf("duplicate user %s %v, rename or remove them before upgrading", column, duplicates)
+	}
+	return nil
+}
+
 func initAdmin(s *storage.Engine) error {
-	if s.IsExist(context.TODO(), 0, "admin", &models.User{}) {
+	if s.IsExist(context.TODO(), 0, models.AdminName, &models.User{}) {
 		return nil
 	}
 	u := &models.User{
-		Name:     "admin",
+		Name:     models.AdminName,
 		CnName:   "管理员",
 		Password: config.Read().Service.AdminPassword,
 		Email:    "admin@example.com",
 		Admin:    true,
 	}
-	u.EncodePasswd()
+	if err := u.EncodePasswd(); err != nil {
+		return err
+	}
 	if err := s.Create(context.TODO(), u); err != nil {
 		if err.Error() != "object exist" {
 			return err
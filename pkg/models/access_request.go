@@ -0,0 +1,50 @@
+package models
+
+import "time"
+
+// 权限申请的状态
+const (
+	// 等待审批
+	AccessPending = "pending"
+	// 已批准，临时角色生效中
+	AccessApproved = "approved"
+	// 已拒绝
+	AccessDenied = "denied"
+	// 申请人已撤回
+	AccessCancelled = "cancelled"
+	// 临时角色被提前收回
+	AccessRevoked = "revoked"
+	// 临时角色已到期
+	AccessExpired = "expired"
+)
+
+// AccessRequest 临时权限申请，批准后在模块或项目上创建带有过期时间的角色绑定
+type AccessRequest struct {
+	Base
+	// 申请人id
+	UserID uint `gorm:"index;not null" json:"userID" write:"readonly"`
+	// 申请人名称
+	UserName string `gorm:"size:64" json:"userName" write:"readonly"`
+	// 申请的模块id，申请项目时为项目所属的模块
+	ModuleID uint `gorm:"index;not null" json:"moduleID"`
+	// 申请的项目id，申请模块时为0
+	ProjectID uint `gorm:"default:0" json:"projectID"`
+	// 申请的角色
+	Role string `gorm:"size:32;not null" json:"role"`
+	// 申请的时长，单位秒
+	Duration int64 `gorm:"not null" json:"duration"`
+	// 申请理由
+	Justification string `gorm:"size:1024" json:"justification"`
+	// 状态
+	Status string `gorm:"size:16;index;not null" json:"status" write:"readonly"`
+	// 审批人id
+	ReviewerID uint `json:"reviewerID,omitempty" write:"readonly"`
+	// 审批人名称
+	ReviewerName string `gorm:"size:64" json:"reviewerName,omitempty" write:"readonly"`
+	// 审批意见
+	ReviewComment string `gorm:"size:1024" json:"reviewComment,omitempty" write:"readonly"`
+	// 审批时间
+	ReviewedAt *time.Time `json:"reviewedAt,omitempty" write:"readonly"`
+	// 临时角色的过期时间，批准时为审批时间加上申请的时长
+	ExpiresAt *time.Time `json:"expiresAt,omitempty" write:"readonly"`
+}
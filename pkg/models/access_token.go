@@ -0,0 +1,61 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/hex-techs/blade/pkg/utils/token"
+	"gorm.io/gorm"
+)
+
+// 个人访问令牌前缀
+const PATPrefix = "blade_pat_"
+
+// PersonalAccessToken 个人访问令牌，供CI和脚本使用
+type PersonalAccessToken struct {
+	Base
+	// 所属用户id
+	UserID uint `gorm:"index;not null" json:"userID" write:"readonly"`
+	// 令牌名称
+	Name string `gorm:"size:64;not null" json:"name" binding:"required"`
+	// 权限范围，read或write
+	Scopes []string `gorm:"serializer:json" json:"scopes" binding:"required,min=1,dive,oneof=read write"`
+	// 过期时间
+	ExpiresAt time.Time `json:"expiresAt" binding:"required"`
+	// 最后使用时间
+	LastUsedAt *time.Time `json:"lastUsedAt" write:"readonly"`
+	// 令牌的前几位，便于用户辨认
+	Prefix string `gorm:"size:32" json:"prefix" write:"readonly"`
+	// 令牌摘要，明文不存储
+	Hash string `gorm:"size:64;uniqueIndex" json:"-"`
+	// 令牌明文，只在创建时返回一次
+	Token string `gorm:"-" json:"token,omitempty" write:"readonly"`
+}
+
+// GenToken 生成令牌明文和摘要
+func (p *PersonalAccessToken) GenToken() error {
+	s, err := token.RandomString(32)
+	if err != nil {
+		return err
+	}
+	p.Token = PATPrefix + s
+	p.Prefix = p.Token[:len(PATPrefix)+4]
+	p.Hash = token.Hash(p.Token)
+	return nil
+}
+
+// Validate 校验令牌是否过期
+func (p *PersonalAccessToken) Validate() error {
+	if time.Now().After(p.ExpiresAt) {
+		return fmt.Errorf("access token %s expired", p.Prefix)
+	}
+	return nil
+}
+
+func (p *PersonalAccessToken) BeforeCreate(tx *gorm.DB) error {
+	if !p.ExpiresAt.After(time.Now()) {
+		return errors.New("expiresAt must be in the future")
+	}
+	return p.Base.BeforeCreate(tx)
+}
@@ -0,0 +1,55 @@
+package models
+
+// 审计日志的操作类型
+const (
+	// 管理员开始模拟其他用户
+	AuditImpersonate = "impersonate"
+	// 模拟期间发起的请求
+	AuditImpersonatedRequest = "impersonated_request"
+	// 申请临时权限
+	AuditAccessRequest = "access_request"
+	// 批准权限申请
+	AuditAccessApprove = "access_approve"
+	// 拒绝权限申请
+	AuditAccessDeny = "access_deny"
+	// 撤回权限申请
+	AuditAccessCancel = "access_cancel"
+	// 提前收回临时权限
+	AuditAccessRevoke = "access_revoke"
+	// 临时权限到期被自动删除
+	AuditAccessExpire = "access_expire"
+	// 验证新邮箱后修改邮箱
+	AuditEmailChange = "email_change"
+)
+
+// 系统自动执行的操作的操作人名称
+const AuditActorSystem = "system"
+
+// AuditLog 审计日志，记录真实操作人和生效的用户身份
+type AuditLog struct {
+	Base
+	// 操作类型
+	Action string `gorm:"size:32;index;not null" json:"action"`
+	// 真实操作人id
+	ActorID uint `gorm:"index" json:"actorID"`
+	// 真实操作人名称
+	ActorName string `gorm:"size:64" json:"actorName"`
+	// 生效的用户id
+	UserID uint `gorm:"index" json:"userID"`
+	// 生效的用户名称
+	UserName string `gorm:"size:64" json:"userName"`
+	// 请求方法
+	Method string `gorm:"size:16" json:"method"`
+	// 请求路径
+	Path string `gorm:"size:1024" json:"path"`
+	// 响应状态码
+	Status int `json:"status"`
+	// 来源IP
+	IP string `gorm:"size:64" json:"ip"`
+	// 备注，如模拟的原因
+	Detail string `gorm:"size:1024" json:"detail"`
+	// 操作的资源类型，如accessrequest
+	Resource string `gorm:"size:32;index" json:"resource,omitempty"`
+	// 操作的资源id
+	ResourceID uint `gorm:"index" json:"resourceID,omitempty"`
+}
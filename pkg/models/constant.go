@@ -6,16 +6,29 @@ import (
 	"gorm.io/gorm"
 )
 
-const salt = "blade"
+// 内置管理员用户名
+const AdminName = "admin"
+
+// 用户来源
+const (
+	// 本地注册或管理员创建的用户
+	SourceLocal = "local"
+	// 通过ldap登录同步的用户
+	SourceLdap = "ldap"
+	// 通过oidc单点登录创建的用户
+	SourceOidc = "oidc"
+	// 通过可信反向代理认证创建的用户
+	SourceProxy = "proxy"
+)
 
 // 基类
 type Base struct {
 	// 默认主键为ID，类型为uint
-	ID uint `gorm:"primary_key" json:"id"`
+	ID uint `gorm:"primary_key" json:"id" write:"readonly"`
 	// 创建时间
-	CreatedAt time.Time `json:"createdAt"`
+	CreatedAt time.Time `json:"createdAt" write:"readonly"`
 	// 更新时间
-	UpdatedAt time.Time `json:"updatedAt"`
+	UpdatedAt time.Time `json:"updatedAt" write:"readonly"`
 	// 删除时间
 	DeletedAt gorm.DeletedAt `gorm:"index" json:"-"`
 }
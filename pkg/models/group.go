@@ -0,0 +1,31 @@
+package models
+
+// 用户组在角色绑定和项目负责人中的前缀，用户名不能包含':'，不会与用户组混淆
+const GroupPrefix = "group:"
+
+// GroupSubject 用户组在角色绑定和项目负责人中的名称
+func GroupSubject(name string) string {
+	return GroupPrefix + name
+}
+
+// Group 用户组，可以像用户一样被授予模块角色、绑定角色或作为项目负责人
+type Group struct {
+	Base
+	// 用户组名，唯一，不可为空
+	Name string `gorm:"uniqueIndex;size:64;not null" json:"name" binding:"required,excludes=:"`
+	// 描述
+	Description string `gorm:"size:1024" json:"description"`
+	// 用户组来源，local表示在blade中创建，ldap、oidc或proxy表示登录时从身份源同步创建
+	Source string `gorm:"size:32;default:local" json:"source" write:"readonly"`
+}
+
+// GroupMember 用户组成员
+type GroupMember struct {
+	Base
+	// 用户组id
+	GroupID uint `gorm:"uniqueIndex:idx_group_member;not null" json:"groupID" write:"readonly"`
+	// 用户id
+	UserID uint `gorm:"uniqueIndex:idx_group_member;not null" json:"userID" binding:"required"`
+	// 成员来源，local表示手动添加，其他表示登录时从对应的身份源同步，同步只会修改同一来源的成员
+	Source string `gorm:"size:32;default:local" json:"source" write:"readonly"`
+}
@@ -0,0 +1,54 @@
+package models
+
+import (
+	"strings"
+	"time"
+
+	"github.com/hex-techs/blade/pkg/utils/token"
+)
+
+// Invitation 邀请注册，邀请注册模式下只能通过邀请链接注册
+type Invitation struct {
+	Base
+	// 被邀请人的邮箱，注册时必须使用该邮箱
+	Email string `gorm:"size:255;index;not null" json:"email" binding:"required,email"`
+	// 注册后自动加入的模块
+	Modules []ModuleGrant `gorm:"serializer:json" json:"modules" binding:"dive"`
+	// 邀请人id
+	InvitedBy uint `json:"invitedBy" write:"readonly"`
+	// 令牌摘要，明文只在创建时返回并通过邮件发送
+	Hash string `gorm:"size:64;uniqueIndex" json:"-"`
+	// 过期时间
+	ExpiresAt time.Time `json:"expiresAt" write:"readonly"`
+	// 是否已经使用
+	Used bool `gorm:"default:false" json:"used" write:"readonly"`
+	// 通过邀请注册的用户id
+	UserID uint `json:"userID" write:"readonly"`
+	// 令牌明文，只在创建时返回一次
+	Token string `gorm:"-" json:"token,omitempty" write:"readonly"`
+}
+
+// ModuleGrant 邀请中预先分配的模块角色
+type ModuleGrant struct {
+	// 模块id
+	ModuleID uint `json:"moduleID" binding:"required"`
+	// 角色
+	Role string `json:"role" binding:"required,oneof=owner maintainer developer viewer"`
+}
+
+// GenToken 生成邀请令牌明文和摘要，并设置过期时间
+func (i *Invitation) GenToken(exp int64) error {
+	s, err := token.RandomString(32)
+	if err != nil {
+		return err
+	}
+	i.Token = s
+	i.Hash = token.Hash(s)
+	i.ExpiresAt = time.Now().Add(time.Second * time.Duration(exp))
+	return nil
+}
+
+// Match 校验邀请是否可以用于该邮箱注册
+func (i *Invitation) Match(email string) bool {
+	return !i.Used && time.Now().Before(i.ExpiresAt) && strings.EqualFold(i.Email, email)
+}
@@ -0,0 +1,33 @@
+package models
+
+import "time"
+
+// 登录失败的计数对象
+const (
+	// 按账号计数，不区分账号是否存在
+	AttemptAccount = "account"
+	// 按来源IP计数
+	AttemptIP = "ip"
+)
+
+// LoginAttempt 登录失败计数，存储在数据库中以便多个副本共享
+type LoginAttempt struct {
+	Base
+	// 计数对象类型，account 或 ip
+	Kind string `gorm:"size:16;uniqueIndex:idx_attempt_subject;not null" json:"kind"`
+	// 用户名或IP地址
+	Subject string `gorm:"size:255;uniqueIndex:idx_attempt_subject;not null" json:"subject"`
+	// 连续失败次数
+	Failures int `gorm:"default:0" json:"failures"`
+	// 最近一次失败时间
+	LastFailure time.Time `json:"lastFailure"`
+	// 锁定截止时间
+	LockedUntil time.Time `gorm:"index" json:"lockedUntil"`
+	// 当前是否处于锁定状态
+	Locked bool `gorm:"-" json:"locked"`
+}
+
+// IsLocked 判断在指定时间是否处于锁定状态
+func (l *LoginAttempt) IsLocked(now time.Time) bool {
+	return l.LockedUntil.After(now)
+}
@@ -19,9 +19,9 @@ type Module struct {
 	// 父模块id
 	ParentID uint `gorm:"index" json:"parentID"`
 	// 级别
-	Level uint `gorm:"index" json:"level"`
+	Level uint `gorm:"index" json:"level" write:"readonly"`
 	// module全称
-	FullName string `json:"fullName"`
+	FullName string `json:"fullName" write:"readonly"`
 }
 
 func (m *Module) BeforeCreate(tx *gorm.DB) error {
@@ -0,0 +1,65 @@
+package models
+
+import "time"
+
+// 模块成员角色
+const (
+	RoleOwner      = "owner"
+	RoleMaintainer = "maintainer"
+	RoleDeveloper  = "developer"
+	RoleViewer     = "viewer"
+)
+
+// 模块上的操作
+const (
+	// 查看模块、项目和成员
+	ActionView = "view"
+	// 发布项目
+	ActionDeploy = "deploy"
+	// 修改模块、项目，管理服务账号
+	ActionEdit = "edit"
+	// 管理成员
+	ActionManage = "manage"
+)
+
+// 角色从高到低排列，高级角色包含低级角色的所有操作
+var Roles = []string{RoleOwner, RoleMaintainer, RoleDeveloper, RoleViewer}
+
+// RoleActions 角色可以执行的操作
+var RoleActions = map[string][]string{
+	RoleOwner:      {ActionView, ActionDeploy, ActionEdit, ActionManage},
+	RoleMaintainer: {ActionView, ActionDeploy, ActionEdit},
+	RoleDeveloper:  {ActionView, ActionDeploy},
+	RoleViewer:     {ActionView},
+}
+
+// RoleRank 角色的等级，越大权限越高，未知角色为0
+func RoleRank(role string) int {
+	for i, r := range Roles {
+		if r == role {
+			return len(Roles) - i
+		}
+	}
+	return 0
+}
+
+// ModuleMember 模块成员，即用户、用户组或服务账号在模块上的角色绑定，下级模块及其项目继承该角色
+type ModuleMember struct {
+	Base
+	// 模块id
+	ModuleID uint `gorm:"uniqueIndex:idx_module_grant;not null" json:"moduleID" binding:"required" write:"readonly"`
+	// 项目id，不为0时角色只在模块下的该项目上生效
+	ProjectID uint `gorm:"uniqueIndex:idx_module_grant;not null;default:0" json:"projectID"`
+	// 用户id，绑定用户组或服务账号时为0
+	UserID uint `gorm:"uniqueIndex:idx_module_grant;not null;default:0" json:"userID"`
+	// 用户组id，绑定用户或服务账号时为0
+	GroupID uint `gorm:"uniqueIndex:idx_module_grant;not null;default:0" json:"groupID"`
+	// 服务账号id，绑定用户或用户组时为0
+	ServiceAccountID uint `gorm:"uniqueIndex:idx_module_grant;not null;default:0" json:"serviceAccountID"`
+	// 申请权限的id，通过申请获得的临时角色不为0，可以与长期角色同时存在
+	RequestID uint `gorm:"uniqueIndex:idx_module_grant;not null;default:0" json:"requestID" write:"readonly"`
+	// 角色
+	Role string `gorm:"size:32;not null" json:"role" binding:"required,oneof=owner maintainer developer viewer"`
+	// 过期时间，为空时长期有效，过期后不再生效并被自动删除
+	ExpiresAt *time.Time `gorm:"index" json:"expiresAt,omitempty"`
+}
@@ -0,0 +1,10 @@
+package models
+
+// PasswordHistory 用户使用过的密码哈希，用于禁止重复使用最近的密码
+type PasswordHistory struct {
+	Base
+	// 所属用户id
+	UserID uint `gorm:"index;not null" json:"userID"`
+	// 密码哈希
+	Password string `gorm:"size:1024" json:"-"`
+}
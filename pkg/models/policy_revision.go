@@ -0,0 +1,11 @@
+package models
+
+// 策略版本号所在行的id
+const PolicyRevisionID = 1
+
+// PolicyRevision 权限策略的版本号，只有一行，策略变化时递增，各副本发现变化后重新加载策略
+type PolicyRevision struct {
+	Base
+	// 版本号
+	Revision int64 `gorm:"not null;default:0" json:"revision"`
+}
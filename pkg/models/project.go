@@ -1,6 +1,10 @@
 package models
 
-import "gorm.io/gorm"
+import (
+	"strings"
+
+	"gorm.io/gorm"
+)
 
 type Project struct {
 	Base
@@ -14,7 +18,7 @@ type Project struct {
 	Language string `gorm:"size:32" json:"language"`
 	// 开发框架
 	Framework string `gorm:"size:32" json:"framework"`
-	// 负责人
+	// 负责人，逗号分隔的用户名，用户组使用 group:<用户组名>
 	Owner string `gorm:"size:256" json:"owner"`
 	// 产品负责人
 	ProductOwner string `gorm:"size:256" json:"productOwner"`
@@ -28,10 +32,93 @@ type Project struct {
 
 func (p *Project) AfterFind(tx *gorm.DB) error {
 	var md Module
-	r := tx.Model(p).Where("id = ?", p.ModuleID).First(&md)
+	r := tx.Model(&Module{}).Where("id = ?", p.ModuleID).First(&md)
 	if r.Error != nil {
 		return r.Error
 	}
 	p.Module = md.FullName
 	return nil
 }
+
+// 负责人字段，值为逗号分隔的用户名
+var projectOwnerFields = []string{"owner", "product_owner", "test_owner"}
+
+// ownerField 返回负责人字段对应的值
+func (p *Project) ownerField(field string) *string {
+	switch field {
+	case "owner":
+		return &p.Owner
+	case "product_owner":
+		return &p.ProductOwner
+	default:
+		return &p.TestOwner
+	}
+}
+
+// OwnedBy 返回引用了该用户的负责人字段
+func (p *Project) OwnedBy(name string) []string {
+	var fields []string
+	for _, field := range projectOwnerFields {
+		for _, n := range strings.Split(*p.ownerField(field), ",") {
+			if strings.TrimSpace(n) == name {
+				fields = append(fields, field)
+				break
+			}
+		}
+	}
+	return fields
+}
+
+// TransferOwner 将负责人字段中的用户替换为另一个用户，返回需要更新的字段
+func (p *Project) TransferOwner(from, to string) map[string]interface{} {
+	updates := map[string]interface{}{}
+	for _, field := range p.OwnedBy(from) {
+		v := p.ownerField(field)
+		var names []string
+		seen := map[string]bool{}
+		for _, n := range strings.Split(*v, ",") {
+			n = strings.TrimSpace(n)
+			if n == from {
+				n = to
+			}
+			if n == "" || seen[n] {
+				continue
+			}
+			seen[n] = true
+			names = append(names, n)
+		}
+		*v = strings.Join(names, ",")
+		updates[field] = *v
+	}
+	return updates
+}
+
+// Owners 返回所有负责人字段中的用户名和用户组，去掉重复的
+func (p *Project) Owners() []string {
+	var names []string
+	seen := map[string]bool{}
+	for _, field := range projectOwnerFields {
+		for _, n := range strings.Split(*p.ownerField(field), ",") {
+			n = strings.TrimSpace(n)
+			if n == "" || seen[n] {
+				continue
+			}
+			seen[n] = true
+			names = append(names, n)
+		}
+	}
+	return names
+}
+
+// HasOwner 用户本身或其所在的用户组是否是项目的负责人
+func (p *Project) HasOwner(name string, groups []string) bool {
+	if len(p.OwnedBy(name)) > 0 {
+		return true
+	}
+	for _, g := range groups {
+		if len(p.OwnedBy(GroupSubject(g))) > 0 {
+			return true
+		}
+	}
+	return false
+}
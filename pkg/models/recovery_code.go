@@ -0,0 +1,46 @@
+package models
+
+import (
+	"crypto/rand"
+	"encoding/base32"
+	"strings"
+
+	"github.com/hex-techs/blade/pkg/utils/token"
+)
+
+// 每次生成的恢复码数量
+const RecoveryCodeCount = 10
+
+// MFARecoveryCode 两步验证恢复码，每个只能使用一次
+type MFARecoveryCode struct {
+	Base
+	// 所属用户id
+	UserID uint `gorm:"index;not null" json:"userID"`
+	// 恢复码摘要，明文只在生成时返回
+	Hash string `gorm:"size:64;index" json:"-"`
+	// 是否已经使用
+	Used bool `gorm:"default:false" json:"used"`
+}
+
+// NewRecoveryCodes 为用户生成一组恢复码，返回明文和待保存的记录
+func NewRecoveryCodes(userID uint) ([]string, []MFARecoveryCode, error) {
+	codes := make([]string, 0, RecoveryCodeCount)
+	records := make([]MFARecoveryCode, 0, RecoveryCodeCount)
+	for i := 0; i < RecoveryCodeCount; i++ {
+		b := make([]byte, 10)
+		if _, err := rand.Read(b); err != nil {
+			return nil, nil, err
+		}
+		// 16位base32字符，分为4组便于抄写
+		s := strings.ToLower(base32.StdEncoding.EncodeToString(b))
+		code := s[:4] + "-" + s[4:8] + "-" + s[8:12] + "-" + s[12:]
+		codes = append(codes, code)
+		records = append(records, MFARecoveryCode{UserID: userID, Hash: RecoveryCodeHash(code)})
+	}
+	return codes, records, nil
+}
+
+// RecoveryCodeHash 计算恢复码摘要，忽略大小写和分隔符
+func RecoveryCodeHash(code string) string {
+	return token.Hash(strings.ToLower(strings.ReplaceAll(strings.TrimSpace(code), "-", "")))
+}
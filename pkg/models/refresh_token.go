@@ -0,0 +1,35 @@
+package models
+
+import (
+	"time"
+
+	"github.com/hex-techs/blade/pkg/utils/token"
+)
+
+// RefreshToken 用于换取新token的令牌，每次使用后轮换
+type RefreshToken struct {
+	Base
+	// 所属用户id
+	UserID uint `gorm:"index;not null" json:"userID"`
+	// 同一次登录轮换出的refresh token属于同一个family，即会话id
+	Family string `gorm:"size:64;index;not null" json:"family"`
+	// 令牌摘要，明文不存储
+	Hash string `gorm:"size:64;uniqueIndex" json:"-"`
+	// 过期时间
+	ExpiresAt time.Time `json:"expiresAt"`
+	// 是否已经轮换过，再次使用说明令牌泄露
+	Used bool `gorm:"default:false" json:"used"`
+	// 令牌明文，只在签发时返回
+	Token string `gorm:"-" json:"-"`
+}
+
+// GenToken 生成令牌明文和摘要
+func (r *RefreshToken) GenToken() error {
+	s, err := token.RandomString(32)
+	if err != nil {
+		return err
+	}
+	r.Token = s
+	r.Hash = token.Hash(s)
+	return nil
+}
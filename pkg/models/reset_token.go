@@ -0,0 +1,48 @@
+package models
+
+import (
+	"crypto/subtle"
+	"time"
+
+	"github.com/hex-techs/blade/pkg/utils/token"
+)
+
+// PasswordResetToken 重置密码令牌，只能使用一次
+type PasswordResetToken struct {
+	Base
+	// 所属用户id
+	UserID uint `gorm:"index;not null" json:"userID"`
+	// 令牌摘要，明文只通过邮件发送
+	Hash string `gorm:"size:64;uniqueIndex" json:"-"`
+	// 申请时用户密码的摘要，密码变化后令牌失效
+	Fingerprint string `gorm:"size:64" json:"-"`
+	// 过期时间
+	ExpiresAt time.Time `json:"expiresAt"`
+	// 是否已经使用
+	Used bool `gorm:"default:false" json:"used"`
+	// 令牌明文，不存储
+	Token string `gorm:"-" json:"-"`
+}
+
+// NewPasswordResetToken 为用户生成重置密码令牌，与用户当前的密码绑定
+func NewPasswordResetToken(u *User, exp int64) (*PasswordResetToken, error) {
+	s, err := token.RandomString(32)
+	if err != nil {
+		return nil, err
+	}
+	return &PasswordResetToken{
+		UserID:      u.ID,
+		Hash:        token.Hash(s),
+		Fingerprint: token.Hash(u.Password),
+		ExpiresAt:   time.Now().Add(time.Second * time.Duration(exp)),
+		Token:       s,
+	}, nil
+}
+
+// Match 校验令牌是否过期，以及是否属于用户当前的密码
+func (p *PasswordResetToken) Match(u *User) bool {
+	if p.Used || time.Now().After(p.ExpiresAt) || p.UserID != u.ID {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(p.Fingerprint), []byte(token.Hash(u.Password))) == 1
+}
@@ -0,0 +1,86 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/hex-techs/blade/pkg/utils/token"
+	"gorm.io/gorm"
+)
+
+// 服务账号令牌前缀
+const SATPrefix = "blade_sat_"
+
+// ServiceAccount 服务账号，供部署机器人等非人类主体使用，不能使用密码登录
+type ServiceAccount struct {
+	Base
+	// 名称，唯一
+	Name string `gorm:"size:64;uniqueIndex;not null" json:"name" binding:"required,excludes=:"`
+	// 描述
+	Description string `gorm:"size:1024" json:"description"`
+	// 所属模块id，与ProjectID二选一
+	ModuleID uint `gorm:"index" json:"moduleID"`
+	// 所属项目id，与ModuleID二选一
+	ProjectID uint `gorm:"index" json:"projectID"`
+	// 是否有效，禁用后所有令牌失效
+	Enabled bool `gorm:"default:true" json:"enabled"`
+	// 创建人id
+	CreatedBy uint `json:"createdBy" write:"readonly"`
+}
+
+// BeforeCreate 服务账号必须属于一个模块或者一个项目
+func (s *ServiceAccount) BeforeCreate(tx *gorm.DB) error {
+	if (s.ModuleID == 0) == (s.ProjectID == 0) {
+		return errors.New("service account must be owned by exactly one of module or project")
+	}
+	return s.Base.BeforeCreate(tx)
+}
+
+// ServiceAccountToken 服务账号令牌，必须设置过期时间和权限范围
+type ServiceAccountToken struct {
+	Base
+	// 所属服务账号id
+	ServiceAccountID uint `gorm:"index;not null" json:"serviceAccountID" write:"readonly"`
+	// 令牌名称
+	Name string `gorm:"size:64;not null" json:"name" binding:"required"`
+	// 权限范围，read或write
+	Scopes []string `gorm:"serializer:json" json:"scopes" binding:"required,min=1,dive,oneof=read write"`
+	// 过期时间
+	ExpiresAt time.Time `json:"expiresAt" binding:"required"`
+	// 最后使用时间
+	LastUsedAt *time.Time `json:"lastUsedAt" write:"readonly"`
+	// 令牌的前几位，便于辨认
+	Prefix string `gorm:"size:32" json:"prefix" write:"readonly"`
+	// 令牌摘要，明文不存储
+	Hash string `gorm:"size:64;uniqueIndex" json:"-"`
+	// 令牌明文，只在创建时返回一次
+	Token string `gorm:"-" json:"token,omitempty" write:"readonly"`
+}
+
+// GenToken 生成令牌明文和摘要
+func (t *ServiceAccountToken) GenToken() error {
+	s, err := token.RandomString(32)
+	if err != nil {
+		return err
+	}
+	t.Token = SATPrefix + s
+	t.Prefix = t.Token[:len(SATPrefix)+4]
+	t.Hash = token.Hash(t.Token)
+	return nil
+}
+
+// Validate 校验令牌是否过期
+func (t *ServiceAccountToken) Validate() error {
+	if time.Now().After(t.ExpiresAt) {
+		return fmt.Errorf("service account token %s expired", t.Prefix)
+	}
+	return nil
+}
+
+func (t *ServiceAccountToken) BeforeCreate(tx *gorm.DB) error {
+	if !t.ExpiresAt.After(time.Now()) {
+		return errors.New("expiresAt must be in the future")
+	}
+	return t.Base.BeforeCreate(tx)
+}
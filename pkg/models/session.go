@@ -0,0 +1,22 @@
+package models
+
+import "time"
+
+// Session 登录会话，每次登录创建一个会话，刷新token时沿用同一个会话
+type Session struct {
+	Base
+	// 所属用户id
+	UserID uint `gorm:"index;not null" json:"userID"`
+	// 会话id，写入token的sid，同时作为refresh token的family
+	SID string `gorm:"column:sid;size:64;uniqueIndex;not null" json:"-"`
+	// 登录或最近一次刷新时的来源IP
+	IP string `gorm:"size:64" json:"ip"`
+	// 登录或最近一次刷新时的User-Agent
+	UserAgent string `gorm:"size:512" json:"userAgent"`
+	// 最近一次使用时间
+	LastSeenAt time.Time `json:"lastSeenAt"`
+	// 过期时间，与refresh token一致
+	ExpiresAt time.Time `gorm:"index" json:"expiresAt"`
+	// 是否是当前请求使用的会话
+	Current bool `gorm:"-" json:"current"`
+}
@@ -1,39 +1,57 @@
 package models
 
 import (
-	"crypto/sha256"
-	"crypto/subtle"
 	"fmt"
+	"strings"
 
 	"github.com/dgrijalva/jwt-go"
 	"github.com/hex-techs/blade/pkg/utils/config"
+	"github.com/hex-techs/blade/pkg/utils/password"
 	"github.com/hex-techs/blade/pkg/utils/token"
-	"golang.org/x/crypto/pbkdf2"
+	"gorm.io/gorm"
 )
 
 // User 用户表
 type User struct {
 	Base
-	// 用户名，默认英文，唯一，不可为空
-	Name string `gorm:"unique,index,size:64,not null" json:"name" binding:"required"`
+	// 用户名，默认英文，在未删除的用户中唯一，不可为空，创建后不能修改，token和授权策略都以用户名为主体
+	Name string `gorm:"index:idx_user_name;size:64;not null" json:"name" binding:"required,excludes=:" write:"endpoint"`
 	// 中文名称
 	CnName string `gorm:"size:64" json:"cnName" binding:"required"`
 	// 用户密码，加密后存储
-	Password string `gorm:"size:1024" json:"password"`
-	// 用户邮箱，唯一，不可为空
-	Email string `gorm:"unique,index,not null" json:"email" binding:"required"`
+	Password string `gorm:"size:1024" json:"password" write:"endpoint"`
+	// 用户邮箱，在未删除的用户中唯一，外部身份源没有提供邮箱时为空
+	Email string `gorm:"index:idx_user_email;size:255;not null" json:"email" binding:"required" write:"endpoint"`
 	// 是否是管理员
-	Admin bool `gorm:"default:false" json:"admin"`
+	Admin bool `gorm:"default:false" json:"admin" write:"admin"`
 	// 是否有效
-	Enabled bool `gorm:"default:true" json:"enabled"`
+	Enabled bool `gorm:"default:true" json:"enabled" write:"admin"`
+	// 自助注册后等待验证邮箱，验证前不能登录
+	Pending bool `gorm:"default:false" json:"pending" write:"readonly"`
 	// 电话号码
 	Phone string `gorm:"size:32" json:"phone"`
 	// 社交账号，如微信，qq，钉钉，lark等
 	IM string `gorm:"size:128" json:"im"`
+	// 头像地址，上传头像后由服务端设置，带有版本号便于前端缓存
+	Avatar string `gorm:"size:128" json:"avatar" write:"readonly"`
+	// 用户来源，local、ldap或oidc
+	Source string `gorm:"size:32;default:local" json:"source" write:"readonly"`
+	// oidc用户的issuer，与OidcSubject一起唯一确定oidc用户
+	OidcIssuer string `gorm:"size:255;uniqueIndex:idx_user_oidc;not null;default:''" json:"-"`
+	// oidc用户在issuer中的唯一标识，用户名在身份源中可能被修改或复用，不能用来关联用户，未关联时为空
+	OidcSubject *string `gorm:"size:255;uniqueIndex:idx_user_oidc" json:"-"`
+	// token版本号，修改密码、重置密码或禁用用户时递增，使已签发的token失效
+	TokenVersion uint `gorm:"default:0" json:"-"`
+	// 是否开启了两步验证
+	MFAEnabled bool `gorm:"default:false" json:"mfaEnabled" write:"readonly"`
+	// 两步验证密钥，绑定未确认时MFAEnabled为false
+	MFASecret string `gorm:"size:64" json:"-"`
+	// 最后一次使用的验证码时间步，防止验证码重放
+	MFALastStep int64 `gorm:"default:0" json:"-"`
 	// 用户token，不存储在数据库中
-	Token *Token `gorm:"-" json:"token"`
+	Token *Token `gorm:"-" json:"token" write:"readonly"`
 	// 用户角色，不存储在数据库中
-	Roles []string `gorm:"-" json:"roles"`
+	Roles []string `gorm:"-" json:"roles" write:"readonly"`
 }
 
 // Token response user's token
@@ -42,27 +60,48 @@ type Token struct {
 	Token string `json:"token"`
 	// 过期时间
 	Expired int64 `json:"expired"`
+	// refresh token，用于换取新的token
+	RefreshToken string `json:"refreshToken,omitempty"`
+	// refresh token过期时间
+	RefreshExpired int64 `json:"refreshExpired,omitempty"`
+}
+
+// BeforeCreate 用户名不能包含':'，避免与服务账号等其他主体的名称冲突
+func (u *User) BeforeCreate(tx *gorm.DB) error {
+	if strings.Contains(u.Name, ":") {
+		return fmt.Errorf("user name %q must not contain ':'", u.Name)
+	}
+	return u.Base.BeforeCreate(tx)
 }
 
 // EncodePasswd encodes password to safe format.
-func (u *User) EncodePasswd() {
-	newPasswd := pbkdf2.Key([]byte(u.Password), []byte(salt), 10000, 50, sha256.New)
-	u.Password = fmt.Sprintf("%x", newPasswd)
+func (u *User) EncodePasswd() error {
+	hash, err := password.Hash(u.Password)
+	if err != nil {
+		return err
+	}
+	u.Password = hash
+	return nil
 }
 
 // ValidatePassword checks if given password matches the one belongs to the user.
-func (u *User) ValidatePassword(Password string) bool {
-	newUser := &User{Password: Password}
-	newUser.EncodePasswd()
-	return subtle.ConstantTimeCompare([]byte(u.Password), []byte(newUser.Password)) == 1
+func (u *User) ValidatePassword(p string) bool {
+	return password.Verify(p, u.Password)
+}
+
+// NeedRehash 密码哈希是旧格式或旧参数时返回true，登录成功后需要重新生成
+func (u *User) NeedRehash() bool {
+	return password.NeedsRehash(u.Password)
 }
 
-// GenUser generate User
-func (u *User) GenUser() error {
+// GenUser generate User，sid为token所属的登录会话
+func (u *User) GenUser(sid string) error {
 	claim := &token.Claims{
 		ID:             u.ID,
 		Name:           u.Name,
 		Admin:          u.Admin,
+		Version:        u.TokenVersion,
+		SID:            sid,
 		StandardClaims: jwt.StandardClaims{},
 	}
 	t, e, err := token.GenerateJWTToken(claim, config.Read().Service.TokenExpired)
@@ -76,6 +115,26 @@ func (u *User) GenUser() error {
 	return nil
 }
 
+// GenImpersonation 为管理员生成模拟该用户的token，不签发refresh token，过期后需要重新模拟
+func (u *User) GenImpersonation(actor *token.Actor) error {
+	claim := &token.Claims{
+		ID:      u.ID,
+		Name:    u.Name,
+		Admin:   u.Admin,
+		Version: u.TokenVersion,
+		Actor:   actor,
+	}
+	t, e, err := token.GenerateJWTToken(claim, config.Read().Service.ImpersonationExpired)
+	if err != nil {
+		return err
+	}
+	u.Token = &Token{
+		Token:   t,
+		Expired: e,
+	}
+	return nil
+}
+
 // TruncatePassword return null password to client
 func (u *User) TruncatePassword() {
 	u.Password = ""
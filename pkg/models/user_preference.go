@@ -0,0 +1,31 @@
+package models
+
+// UserPreference 用户的偏好设置，每个用户一条，整体读写
+type UserPreference struct {
+	Base
+	// 所属用户id
+	UserID uint `gorm:"uniqueIndex;not null" json:"userID" write:"readonly"`
+	// 界面语言，zh-CN或en-US，为空时由前端决定
+	Language string `gorm:"size:16" json:"language" binding:"omitempty,oneof=zh-CN en-US"`
+	// 时区，IANA时区名称，如Asia/Shanghai
+	Timezone string `gorm:"size:64" json:"timezone" binding:"max=64"`
+	// 默认集群
+	DefaultCluster string `gorm:"size:64" json:"defaultCluster" binding:"max=64"`
+	// 默认命名空间
+	DefaultNamespace string `gorm:"size:64" json:"defaultNamespace" binding:"max=63"`
+	// 收藏的模块id
+	FavoriteModules []uint `gorm:"serializer:json" json:"favoriteModules" binding:"max=100"`
+	// 收藏的项目id
+	FavoriteProjects []uint `gorm:"serializer:json" json:"favoriteProjects" binding:"max=100"`
+}
+
+// UserAvatar 用户头像，存储在数据库中，多副本部署时不依赖本地磁盘
+type UserAvatar struct {
+	Base
+	// 所属用户id
+	UserID uint `gorm:"uniqueIndex;not null" json:"userID"`
+	// 图片类型，如image/png
+	ContentType string `gorm:"size:32;not null" json:"contentType"`
+	// 图片内容
+	Data []byte `gorm:"not null" json:"-"`
+}
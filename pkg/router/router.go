@@ -1,37 +1,123 @@
 package router
 
 import (
+	"time"
+
+	"github.com/fize/go-ext/log"
 	"github.com/gin-gonic/gin"
+	"github.com/hex-techs/blade/pkg/models"
+	"github.com/hex-techs/blade/pkg/utils/casbin"
+	"github.com/hex-techs/blade/pkg/utils/config"
+	"github.com/hex-techs/blade/pkg/utils/kube"
 	"github.com/hex-techs/blade/pkg/utils/storage"
 	"github.com/hex-techs/blade/pkg/utils/web"
+	"github.com/hex-techs/blade/pkg/view/accessrequest"
 	"github.com/hex-techs/blade/pkg/view/authentication"
+	"github.com/hex-techs/blade/pkg/view/authz"
+	"github.com/hex-techs/blade/pkg/view/group"
 	"github.com/hex-techs/blade/pkg/view/module"
+	"github.com/hex-techs/blade/pkg/view/rbac"
+	"github.com/hex-techs/blade/pkg/view/serviceaccount"
 	"github.com/hex-techs/blade/pkg/view/user"
 )
 
-func InstallAPI(r *gin.Engine, s *storage.Engine) {
+func InstallAPI(r *gin.Engine, s *storage.Engine, e *casbin.Enforcer) {
 	installAuthn(r, s)
-	installUserAPI(r, s)
+	installUserAPI(r, s, e)
 	installModuleAPI(r, s)
+	installGroupAPI(r, s, e)
+	installAuthzAPI(r, s, e)
+	installAccessRequestAPI(r, s)
+	if config.Read().Kubernetes.RBACSync {
+		installRBACSync(r, s)
+	}
 }
 
 func installAuthn(r *gin.Engine, s *storage.Engine) {
 	api := authentication.NewAuthn(s)
+	web.RegisterClaimsValidator(api.ValidateClaims)
+	web.RegisterImpersonationRecorder(api.RecordImpersonation)
+	if config.Read().ProxyAuth.Enabled {
+		web.RegisterAuthenticator(api.ProxyAuthenticator())
+	}
+	r.GET("/.well-known/jwks.json", api.JWKS)
 	group := r.Group("/api/v1/auth")
 	{
 		group.POST("/register", api.Register)
 		group.POST("/login", api.Login)
 		group.POST("/restpasswordrequest", api.ResetPasswordRequest)
 		group.PUT("/resetpassword/:token", api.ResetPassword)
-		group.PUT("/changepassword", web.LoginRequired(), api.ChangePassword)
+		group.PUT("/changepassword", web.LoginRequired(), web.NoImpersonation(), api.ChangePassword)
+		group.PUT("/verifyemail/:token", api.VerifyEmail)
+		group.POST("/verifyemail", api.ResendVerifyEmail)
+		group.POST("/refresh", api.Refresh)
+		group.POST("/logout", web.LoginRequired(), api.Logout)
+		group.GET("/oidc/login", api.OidcLogin)
+		group.GET("/oidc/callback", api.OidcCallback)
+		group.POST("/mfa/verify", api.VerifyMFA)
+		group.POST("/mfa/enroll", api.MFAEnrollRequired(), api.EnrollMFA)
+		group.POST("/mfa/confirm", api.MFAEnrollRequired(), api.ConfirmMFA)
+		group.DELETE("/mfa", web.LoginRequired(), web.NoImpersonation(), api.DisableMFA)
+		group.POST("/mfa/recoverycodes", web.LoginRequired(), web.NoImpersonation(), api.RegenerateRecoveryCodes)
+		group.DELETE("/mfa/:id", web.LoginRequired(), web.AdminRequired(), api.ResetMFA)
+		group.GET("/loginattempts", web.LoginRequired(), web.AdminRequired(), api.ListLoginAttempts)
+		group.DELETE("/loginattempts/:id", web.LoginRequired(), web.AdminRequired(), api.ClearLoginAttempt)
+		group.GET("/sessions", web.LoginRequired(), api.ListSessions)
+		group.DELETE("/sessions", web.LoginRequired(), api.RevokeOtherSessions)
+		group.DELETE("/sessions/:id", web.LoginRequired(), api.RevokeSession)
+		group.POST("/impersonate/:id", web.LoginRequired(), web.AdminRequired(), web.NoImpersonation(), api.Impersonate)
+		group.GET("/auditlogs", web.LoginRequired(), web.AdminRequired(), api.ListAuditLogs)
+	}
+	// 只供集群调用，不在对外的api中
+	if cfg := config.Read().Kubernetes; cfg.TokenReview {
+		r.POST("/webhook/tokenreview", authentication.WebhookRequired(cfg.TokenReviewToken), api.TokenReview)
 	}
 }
 
-func installUserAPI(r *gin.Engine, s *storage.Engine) {
+func installUserAPI(r *gin.Engine, s *storage.Engine, e *casbin.Enforcer) {
 	u := web.RestfulAPI{
 		PostParameter: "/:id",
 	}
-	u.Install(r, user.NewUserController(s))
+	uc := user.NewUserController(s, e)
+	u.Install(r, uc)
+	r.POST("/api/v1/user/:id/offboard", web.LoginRequired(), web.AdminRequired(), web.NoImpersonation(), uc.Offboard)
+	r.GET("/api/v1/user/:id/avatar", web.LoginRequired(), uc.Avatar)
+	me := r.Group("/api/v1/user/me", web.LoginRequired())
+	{
+		me.GET("", uc.Me)
+		me.PATCH("", web.NoImpersonation(), uc.UpdateMe)
+		me.GET("/preferences", uc.Preferences)
+		me.PUT("/preferences", web.WritePolicy(web.NewFieldPolicy(&models.UserPreference{}), web.UPDATE),
+			uc.UpdatePreferences)
+		me.PUT("/avatar", uc.UploadAvatar)
+		me.DELETE("/avatar", uc.DeleteAvatar)
+	}
+
+	i := web.RestfulAPI{
+		PostParameter: "/:id",
+	}
+	i.Install(r, user.NewInvitationController(s))
+
+	tc := user.NewTokenController(s)
+	web.RegisterTokenResolver(models.PATPrefix, tc.Resolve)
+	t := web.RestfulAPI{
+		PreParameter:  "user/:id",
+		PostParameter: "/:tid",
+	}
+	t.Install(r, tc)
+
+	sa := web.RestfulAPI{
+		PostParameter: "/:id",
+	}
+	sa.Install(r, serviceaccount.NewServiceAccountController(s, e))
+
+	stc := serviceaccount.NewTokenController(s)
+	web.RegisterTokenResolver(models.SATPrefix, stc.Resolve)
+	st := web.RestfulAPI{
+		PreParameter:  "serviceaccount/:id",
+		PostParameter: "/:tid",
+	}
+	st.Install(r, stc)
 }
 
 func installModuleAPI(r *gin.Engine, s *storage.Engine) {
@@ -39,4 +125,71 @@ func installModuleAPI(r *gin.Engine, s *storage.Engine) {
 		PostParameter: "/:id",
 	}
 	u.Install(r, module.NewModuleController(s))
+
+	mc := module.NewMemberController(s)
+	m := web.RestfulAPI{
+		PreParameter:  "module/:id",
+		PostParameter: "/:mid",
+	}
+	m.Install(r, mc)
+	r.GET("/api/v1/module/:id/access", web.LoginRequired(), mc.Access)
+}
+
+func installGroupAPI(r *gin.Engine, s *storage.Engine, e *casbin.Enforcer) {
+	g := web.RestfulAPI{
+		PostParameter: "/:id",
+	}
+	g.Install(r, group.NewGroupController(s, e))
+
+	m := web.RestfulAPI{
+		PreParameter:  "group/:id",
+		PostParameter: "/:mid",
+	}
+	m.Install(r, group.NewMemberController(s))
+}
+
+func installAuthzAPI(r *gin.Engine, s *storage.Engine, e *casbin.Enforcer) {
+	ro := web.RestfulAPI{
+		PostParameter: "/:name",
+	}
+	ro.Install(r, authz.NewRoleController(e))
+
+	rb := web.RestfulAPI{
+		PostParameter: "/:subject/:role",
+	}
+	rb.Install(r, authz.NewRoleBindingController(s, e))
+
+	api := authz.NewAuthz(s, e)
+	group := r.Group("/api/v1/authz", web.LoginRequired())
+	{
+		group.POST("/can-i", api.CanI)
+		group.GET("/my-permissions", api.MyPermissions)
+	}
+}
+
+func installAccessRequestAPI(r *gin.Engine, s *storage.Engine) {
+	ac := accessrequest.NewAccessRequestController(s)
+	a := web.RestfulAPI{
+		PostParameter: "/:id",
+	}
+	a.Install(r, ac)
+	r.POST("/api/v1/accessrequest/:id/approve", web.LoginRequired(), web.NoImpersonation(), ac.Approve)
+	r.POST("/api/v1/accessrequest/:id/deny", web.LoginRequired(), web.NoImpersonation(), ac.Deny)
+	r.POST("/api/v1/accessrequest/:id/revoke", web.LoginRequired(), ac.Revoke)
+	accessrequest.StartReaper(s, time.Second*time.Duration(config.Read().Authz.GrantReapInterval))
+}
+
+func installRBACSync(r *gin.Engine, s *storage.Engine) {
+	cfg := config.Read().Kubernetes
+	clusters, err := kube.LoadClusters(cfg)
+	if err != nil {
+		log.Fatalf("load kubernetes clusters error: %v", err)
+	}
+	sy := rbac.NewSyncer(s, kube.NewReconciler(clusters, cfg.RoleMapping))
+	sy.Start(time.Second * time.Duration(cfg.ResyncInterval))
+	group := r.Group("/api/v1/rbac", web.LoginRequired(), web.AdminRequired())
+	{
+		group.GET("/reports", sy.Reports)
+		group.POST("/sync", sy.Sync)
+	}
 }
@@ -1,47 +1,181 @@
 package casbin
 
 import (
-	"fmt"
+	"context"
 	"time"
 
 	"github.com/casbin/casbin/v2"
 	"github.com/casbin/casbin/v2/model"
 	gormadapter "github.com/casbin/gorm-adapter/v3"
-	ext "github.com/fize/go-ext/config"
 	"github.com/fize/go-ext/log"
-	"github.com/hex-techs/blade/pkg/utils/config"
+	"github.com/hex-techs/blade/pkg/models"
+	"github.com/hex-techs/blade/pkg/utils/storage"
+	"github.com/hex-techs/blade/pkg/utils/token"
+	"gorm.io/gorm"
 )
 
-func Init() (*casbin.Enforcer, error) {
+// Enforcer 并发安全的enforcer，策略在多个副本间同步
+type Enforcer = casbin.SyncedEnforcer
+
+// 角色在策略中的前缀，用户名和服务账号名不能包含':'，不会与角色混淆
+const RolePrefix = "role:"
+
+// 内置角色，每个请求的主体除了自身名称外，还隐式拥有以下角色
+const (
+	// 管理员，models.User.Admin 为true的用户
+	RoleAdmin = RolePrefix + "admin"
+	// 所有登录的用户和服务账号
+	RoleAuthenticated = RolePrefix + "authenticated"
+	// 匹配任意资源或操作
+	Any = "*"
+)
+
+// 内置策略，启动时补齐缺失的策略，保持原有的管理员和登录用户的权限
+var builtinPolicies = [][]string{
+	{RoleAdmin, Any, Any},
+	// 用户和访问令牌，是否是本人在接口中判断
+	{RoleAuthenticated, "user", "get"},
+	{RoleAuthenticated, "user", "list"},
+	{RoleAuthenticated, "user", "update"},
+	{RoleAuthenticated, "user/token", "create"},
+	{RoleAuthenticated, "user/token", "delete"},
+	{RoleAuthenticated, "user/token", "list"},
+	// 模块，修改需要模块上的角色，在接口中判断
+	{RoleAuthenticated, "module", "get"},
+	{RoleAuthenticated, "module", "list"},
+	{RoleAuthenticated, "module", "update"},
+	// 模块成员，是否是模块的owner在接口中判断
+	{RoleAuthenticated, "module/member", Any},
+	// 服务账号，是否是模块负责人在接口中判断
+	{RoleAuthenticated, "serviceaccount", Any},
+	{RoleAuthenticated, "serviceaccount/token", Any},
+	// 用户组由管理员维护，所有用户都可以查看，模块owner授权用户组时需要
+	{RoleAuthenticated, "group", "get"},
+	{RoleAuthenticated, "group", "list"},
+	{RoleAuthenticated, "group/member", "list"},
+	// 临时权限申请，申请人和审批人在接口中判断
+	{RoleAuthenticated, "accessrequest", Any},
+}
+
+// Init 使用存储引擎的数据库连接创建enforcer，策略保存在 casbin_rule 表中，并补齐内置策略，
+// 其他副本修改策略后在reload时间内重新加载
+func Init(s *storage.Engine, reload time.Duration) (*Enforcer, error) {
 	m := model.NewModel()
 	m.AddDef("r", "r", "sub, obj, act")
 	m.AddDef("p", "p", "sub, obj, act")
 	m.AddDef("g", "g", "_, _")
 	m.AddDef("e", "e", "some(where (p.eft == allow))")
-	m.AddDef("m", "m", "g(r.sub, p.sub) && r.obj == p.obj && r.act == p.act")
-
-	var a *gormadapter.Adapter
-	var err error
-
-	if config.Read().DB.Type == ext.Mysql {
-		link := fmt.Sprintf("%s:%s@tcp(%s)/",
-			config.Read().DB.User, config.Read().DB.Password,
-			config.Read().DB.Host)
-		for {
-			a, err = gormadapter.NewAdapter("mysql", link, config.Read().DB, "casbin")
-			if err != nil {
-				log.Error(err)
-				time.Sleep(5 * time.Second)
-			} else {
-				break
-			}
+	m.AddDef("m", "m", `g(r.sub, p.sub) && (p.obj == "*" || r.obj == p.obj) && (p.act == "*" || r.act == p.act)`)
+
+	a, err := gormadapter.NewAdapterByDB(s.Client().(*gorm.DB))
+	if err != nil {
+		return nil, err
+	}
+	e, err := casbin.NewSyncedEnforcer(m, a)
+	if err != nil {
+		return nil, err
+	}
+	w, err := NewWatcher(s, reload)
+	if err != nil {
+		return nil, err
+	}
+	if err := e.SetWatcher(w); err != nil {
+		return nil, err
+	}
+	// 默认的回调不加锁，替换为SyncedEnforcer的LoadPolicy
+	if err := w.SetUpdateCallback(func(string) {
+		if err := e.LoadPolicy(); err != nil {
+			log.Errorw("reload policy error", "error", err)
+		}
+	}); err != nil {
+		return nil, err
+	}
+	for _, p := range builtinPolicies {
+		if e.HasPolicy(p) {
+			continue
 		}
-	} else {
-		a, err = gormadapter.NewAdapter("sqlite3", config.Read().DB.DB)
-		if err != nil {
+		log.Infow("add builtin policy", "policy", p)
+		if _, err := e.AddPolicy(p); err != nil {
 			return nil, err
 		}
 	}
+	return e, nil
+}
+
+// RoleSubject 角色在策略中的名称
+func RoleSubject(name string) string {
+	return RolePrefix + name
+}
+
+// IsBuiltinRole 是否是内置角色，内置角色在启动时补齐，不能通过接口修改
+func IsBuiltinRole(sub string) bool {
+	return sub == RoleAdmin || sub == RoleAuthenticated
+}
+
+// RemoveSubject 删除主体直接拥有的权限和角色，用于删除用户或服务账号，避免同名的新主体继承
+func RemoveSubject(e *Enforcer, sub string) error {
+	if _, err := e.RemoveFilteredPolicy(0, sub); err != nil {
+		return err
+	}
+	_, err := e.RemoveFilteredGroupingPolicy(0, sub)
+	return err
+}
+
+// Authorizer 使用casbin判断主体是否可以对资源执行操作
+type Authorizer struct {
+	Enforcer *Enforcer
+	Store    *storage.Engine
+}
+
+// NewAuthorizer return a new casbin authorizer
+func NewAuthorizer(e *Enforcer, s *storage.Engine) *Authorizer {
+	return &Authorizer{
+		Enforcer: e,
+		Store:    s,
+	}
+}
+
+// Authorize 主体自身、所在的用户组或其隐式角色任意一个被允许即可
+func (a *Authorizer) Authorize(claims *token.Claims, obj, act string) (bool, error) {
+	subjects, err := a.Subjects(claims)
+	if err != nil {
+		return false, err
+	}
+	for _, sub := range subjects {
+		ok, err := a.Enforcer.Enforce(sub, obj, act)
+		if err != nil || ok {
+			return ok, err
+		}
+	}
+	return false, nil
+}
 
-	return casbin.NewEnforcer(m, a)
+// Subjects 返回请求主体在casbin中的名称，包括用户当前所在的用户组，修改用户组成员后立即生效
+func (a *Authorizer) Subjects(claims *token.Claims) ([]string, error) {
+	if claims.ID == 0 || claims.IsServiceAccount() {
+		return Subjects(claims), nil
+	}
+	var groups []models.Group
+	if err := a.Store.FindWhere(context.TODO(), &groups,
+		"id IN (SELECT group_id FROM group_members WHERE user_id = ? AND deleted_at IS NULL)", claims.ID); err != nil {
+		return nil, err
+	}
+	names := make([]string, 0, len(groups))
+	for _, g := range groups {
+		names = append(names, g.Name)
+	}
+	return Subjects(claims, names...), nil
+}
+
+// Subjects 返回请求主体在casbin中的名称、所在用户组的名称以及隐式拥有的内置角色
+func Subjects(claims *token.Claims, groups ...string) []string {
+	subjects := []string{claims.Name}
+	for _, g := range groups {
+		subjects = append(subjects, models.GroupSubject(g))
+	}
+	subjects = append(subjects, RoleAuthenticated)
+	if claims.Admin {
+		subjects = append(subjects, RoleAdmin)
+	}
+	return subjects
 }
@@ -0,0 +1,95 @@
+package casbin
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/fize/go-ext/log"
+	"github.com/hex-techs/blade/pkg/models"
+	"github.com/hex-techs/blade/pkg/utils/storage"
+	"gorm.io/gorm"
+)
+
+// Watcher 通过数据库中的版本号在多个副本间同步策略，实现 persist.Watcher
+type Watcher struct {
+	store    *storage.Engine
+	interval time.Duration
+	// 已经加载的版本号
+	revision int64
+	lock     sync.Mutex
+	callback func(string)
+	stop     chan struct{}
+}
+
+// NewWatcher 创建watcher并开始轮询版本号
+func NewWatcher(s *storage.Engine, interval time.Duration) (*Watcher, error) {
+	var rev models.PolicyRevision
+	err := s.Get(context.TODO(), models.PolicyRevisionID, "", &rev)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		rev = models.PolicyRevision{Base: models.Base{ID: models.PolicyRevisionID}}
+		err = s.Create(context.TODO(), &rev)
+	}
+	if err != nil {
+		return nil, err
+	}
+	w := &Watcher{
+		store:    s,
+		interval: interval,
+		revision: rev.Revision,
+		stop:     make(chan struct{}),
+	}
+	go w.run()
+	return w, nil
+}
+
+// SetUpdateCallback 设置版本号变化时的回调，一般为重新加载策略
+func (w *Watcher) SetUpdateCallback(f func(string)) error {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	w.callback = f
+	return nil
+}
+
+// Update 策略变化后递增版本号，由enforcer在修改策略后调用
+func (w *Watcher) Update() error {
+	_, err := w.store.UpdateWhere(context.TODO(), &models.PolicyRevision{},
+		map[string]interface{}{"revision": gorm.Expr("revision + 1")}, "id = ?", models.PolicyRevisionID)
+	return err
+}
+
+// Close 停止轮询
+func (w *Watcher) Close() {
+	close(w.stop)
+}
+
+func (w *Watcher) run() {
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-w.stop:
+			return
+		case <-ticker.C:
+			w.check()
+		}
+	}
+}
+
+// check 版本号变化时调用回调，包括本副本修改策略引起的变化
+func (w *Watcher) check() {
+	var rev models.PolicyRevision
+	if err := w.store.Get(context.TODO(), models.PolicyRevisionID, "", &rev); err != nil {
+		log.Warnw("get policy revision error", "error", err)
+		return
+	}
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	if rev.Revision == w.revision || w.callback == nil {
+		return
+	}
+	log.Infow("policy changed, reload", "from", w.revision, "to", rev.Revision)
+	w.revision = rev.Revision
+	w.callback("")
+}
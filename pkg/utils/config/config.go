@@ -2,6 +2,7 @@ package config
 
 import (
 	"fmt"
+	"net"
 	"sync"
 
 	ext "github.com/fize/go-ext/config"
@@ -12,12 +13,82 @@ import (
 const (
 	// 默认端口
 	_defaultServerPort = 8080
-	// 默认token超时时间24小时
-	_defaultTokenExpired = 3600 * 24
+	// 默认token超时时间1小时，过期后使用refresh token换取新token
+	_defaultTokenExpired = 3600
+	// 默认refresh token超时时间7天
+	_defaultRefreshTokenExpired = 3600 * 24 * 7
 	// 默认url超时时间10分钟
 	_defaultURLExpired = 600
+	// 默认邮箱验证链接超时时间1天
+	_defaultVerifyEmailExpired = 3600 * 24
+	// 默认邀请超时时间7天
+	_defaultInvitationExpired = 3600 * 24 * 7
+	// 默认模拟登录token超时时间15分钟
+	_defaultImpersonationExpired = 900
 	// 默认管理员密码
 	_defaultPassword = "admin"
+	// 默认头像大小上限1MB
+	_defaultAvatarMaxSize = 1 << 20
+	// 默认ldap用户查询条件
+	_defaultLdapFilter = "(uid=%s)"
+	// 默认ldap邮箱属性
+	_defaultLdapEmailAttr = "mail"
+	// 默认ldap中文名属性
+	_defaultLdapCnNameAttr = "displayName"
+	// 默认ldap电话属性
+	_defaultLdapPhoneAttr = "mobile"
+	// 默认ldap用户组属性
+	_defaultLdapGroupAttr = "memberOf"
+	// 默认密码最小长度
+	_defaultPasswordMinLength = 8
+	// 默认两步验证的签发者名称
+	_defaultMFAIssuer = "Blade"
+	// 默认两步验证挑战的超时时间5分钟
+	_defaultMFAChallengeExpired = 300
+	// 默认同一账号连续登录失败5次后锁定
+	_defaultLoginMaxAttempts = 5
+	// 默认同一来源IP连续登录失败20次后锁定
+	_defaultLoginIPMaxAttempts = 20
+	// 默认首次锁定1分钟
+	_defaultLoginLockout = 60
+	// 默认最长锁定1小时
+	_defaultLoginMaxLockout = 3600
+	// 默认1小时没有失败后重新计数
+	_defaultLoginResetAfter = 3600
+	// 默认oidc用户名claim
+	_defaultOidcNameClaim = "preferred_username"
+	// 默认oidc邮箱claim
+	_defaultOidcEmailClaim = "email"
+	// 默认oidc中文名claim
+	_defaultOidcCnNameClaim = "name"
+	// 默认oidc用户组claim
+	_defaultOidcGroupsClaim = "groups"
+	// 默认策略同步间隔1秒
+	_defaultPolicyReloadInterval = 1
+	// 默认临时权限最长8小时
+	_defaultMaxGrantDuration = 28800
+	// 默认每分钟清理一次过期的临时权限
+	_defaultGrantReapInterval = 60
+	// 默认kubernetes权限全量同步间隔5分钟
+	_defaultRBACResyncInterval = 300
+	// 默认项目命名空间标签
+	_defaultProjectLabel = "blade.io/project"
+	// 默认可信代理的用户名header
+	_defaultProxyUserHeader = "X-Forwarded-User"
+	// 默认可信代理的邮箱header
+	_defaultProxyEmailHeader = "X-Forwarded-Email"
+	// 默认可信代理的用户组header
+	_defaultProxyGroupsHeader = "X-Forwarded-Groups"
+)
+
+// 注册模式
+const (
+	// 任何人都可以注册
+	RegistrationOpen = "open"
+	// 只允许Company后缀的邮箱注册
+	RegistrationDomain = "domain"
+	// 只能通过管理员的邀请注册
+	RegistrationInvite = "invite"
 )
 
 // 服务配置
@@ -28,10 +99,28 @@ type ServiceConfig struct {
 	Domain string `fig:"domain"`
 	// token过期时间
 	TokenExpired int64 `fig:"tokenExpired"`
+	// refresh token过期时间
+	RefreshTokenExpired int64 `fig:"refreshTokenExpired"`
 	// url过期时间
 	URLExpired int64 `fig:"urlExpired"`
 	// 重置密码的path
 	ResetPath string `fig:"resetPath"`
+	// 验证邮箱的path
+	VerifyPath string `fig:"verifyPath"`
+	// 邮箱验证链接过期时间
+	VerifyEmailExpired int64 `fig:"verifyEmailExpired"`
+	// 接受邀请的path
+	InvitePath string `fig:"invitePath"`
+	// 邀请过期时间
+	InvitationExpired int64 `fig:"invitationExpired"`
+	// 管理员模拟其他用户的token过期时间，不能刷新
+	ImpersonationExpired int64 `fig:"impersonationExpired"`
+	// 注册模式，open、domain或invite，默认配置了Company时为domain，否则为open
+	RegistrationMode string `fig:"registrationMode"`
+	// 头像大小上限，单位字节
+	AvatarMaxSize int64 `fig:"avatarMaxSize"`
+	// 可信的反向代理地址或地址段，只有来自这些地址的请求才使用X-Forwarded-For中的客户端地址，默认不信任任何代理
+	TrustedProxies []string `fig:"trustedProxies"`
 	// 管理员密码
 	AdminPassword string `fig:"adminPassword"`
 	// 跨域相关配置
@@ -55,6 +144,166 @@ type Ldap struct {
 	User string `fig:"user"`
 	// 密码
 	Password string `fig:"password"`
+	// 用户查询条件，%s 会被替换为登录用户名，默认 (uid=%s)
+	Filter string `fig:"filter"`
+	// 邮箱属性，默认 mail
+	EmailAttr string `fig:"emailAttr"`
+	// 中文名属性，默认 displayName
+	CnNameAttr string `fig:"cnNameAttr"`
+	// 电话属性，默认 mobile
+	PhoneAttr string `fig:"phoneAttr"`
+	// 用户组属性，值为用户组的DN，取第一个RDN的值作为用户组名，默认 memberOf
+	GroupAttr string `fig:"groupAttr"`
+	// 是否允许ldap用户关联同名的本地用户，默认不允许，避免ldap中的同名用户接管本地用户
+	LinkLocalAccounts bool `fig:"linkLocalAccounts"`
+}
+
+// oidc单点登录配置
+type Oidc struct {
+	// 是否开启oidc
+	Enabled bool `fig:"enabled"`
+	// issuer地址 https://sso.example.com
+	Issuer string `fig:"issuer"`
+	// 客户端id
+	ClientID string `fig:"clientID"`
+	// 客户端密钥
+	ClientSecret string `fig:"clientSecret"`
+	// 回调地址 https://blade.example.com/api/v1/auth/oidc/callback
+	RedirectURL string `fig:"redirectURL"`
+	// 额外申请的scope，openid会自动添加
+	Scopes []string `fig:"scopes"`
+	// 用户名claim，默认 preferred_username
+	NameClaim string `fig:"nameClaim"`
+	// 邮箱claim，默认 email
+	EmailClaim string `fig:"emailClaim"`
+	// 中文名claim，默认 name
+	CnNameClaim string `fig:"cnNameClaim"`
+	// 用户组claim，默认 groups
+	GroupsClaim string `fig:"groupsClaim"`
+	// 判断管理员的claim，为空时不同步管理员状态
+	AdminClaim string `fig:"adminClaim"`
+	// AdminClaim 为以下任意值时是管理员，claim为true的布尔值时也视为管理员
+	AdminValues []string `fig:"adminValues"`
+	// 是否允许oidc用户关联同名的本地用户，默认不允许，避免身份源中的同名用户接管本地用户
+	LinkLocalAccounts bool `fig:"linkLocalAccounts"`
+}
+
+// 密码策略
+type PasswordPolicy struct {
+	// 最小长度，默认8
+	MinLength int `fig:"minLength"`
+	// 必须包含大写字母
+	RequireUpper bool `fig:"requireUpper"`
+	// 必须包含小写字母
+	RequireLower bool `fig:"requireLower"`
+	// 必须包含数字
+	RequireDigit bool `fig:"requireDigit"`
+	// 必须包含特殊字符
+	RequireSymbol bool `fig:"requireSymbol"`
+	// 允许密码中包含用户名或邮箱，默认不允许
+	AllowUserInfo bool `fig:"allowUserInfo"`
+	// 不能与最近N次使用过的密码相同，0表示不检查
+	History int `fig:"history"`
+	// 泄露密码列表文件，每行一个密码，为空表示不检查
+	BreachedListFile string `fig:"breachedListFile"`
+}
+
+// 两步验证配置
+type MFA struct {
+	// 管理员必须开启两步验证
+	RequireAdmin bool `fig:"requireAdmin"`
+	// 认证器App中显示的签发者名称，默认 Blade
+	Issuer string `fig:"issuer"`
+	// 输入验证码的超时时间，默认300秒
+	ChallengeExpired int64 `fig:"challengeExpired"`
+}
+
+// 登录保护配置，失败次数达到上限后锁定，之后每次失败锁定时间翻倍
+type LoginProtection struct {
+	// 同一账号连续失败多少次后锁定，默认5
+	MaxAttempts int `fig:"maxAttempts"`
+	// 同一来源IP连续失败多少次后锁定，默认20
+	IPMaxAttempts int `fig:"ipMaxAttempts"`
+	// 首次锁定时长，默认60秒
+	Lockout int64 `fig:"lockout"`
+	// 最长锁定时长，默认3600秒
+	MaxLockout int64 `fig:"maxLockout"`
+	// 超过该时间没有再失败时重新计数，默认3600秒
+	ResetAfter int64 `fig:"resetAfter"`
+}
+
+// 可信反向代理认证配置，网关完成认证后通过header传递用户信息
+type ProxyAuth struct {
+	// 是否开启
+	Enabled bool `fig:"enabled"`
+	// 可信代理的地址段，只接受来自这些地址的header，如 10.0.0.0/8
+	TrustedCIDRs []string `fig:"trustedCIDRs"`
+	// 用户名header，默认 X-Forwarded-User
+	UserHeader string `fig:"userHeader"`
+	// 邮箱header，默认 X-Forwarded-Email
+	EmailHeader string `fig:"emailHeader"`
+	// 用户组header，多个用户组用逗号分隔，默认 X-Forwarded-Groups
+	GroupsHeader string `fig:"groupsHeader"`
+	// 属于以下任意用户组时是管理员，为空时不同步管理员状态
+	AdminGroups []string `fig:"adminGroups"`
+}
+
+// 权限配置
+type Authz struct {
+	// 检查其他副本是否修改了策略的间隔，默认1秒
+	PolicyReloadInterval int64 `fig:"policyReloadInterval"`
+	// 申请临时权限的最长时长，单位秒，默认8小时
+	MaxGrantDuration int64 `fig:"maxGrantDuration"`
+	// 清理过期临时权限的间隔，单位秒，默认60
+	GrantReapInterval int64 `fig:"grantReapInterval"`
+}
+
+// kubernetes权限同步配置，将模块和项目上的角色同步为项目命名空间中的RoleBinding
+type Kubernetes struct {
+	// 是否开启权限同步
+	RBACSync bool `fig:"rbacSync"`
+	// 全量同步并检查漂移的间隔，单位秒，默认300
+	ResyncInterval int64 `fig:"resyncInterval"`
+	// 命名空间的标签，值为项目名的命名空间属于该项目，默认 blade.io/project
+	ProjectLabel string `fig:"projectLabel"`
+	// blade角色对应的ClusterRole，默认 owner:admin, maintainer:edit, developer:edit, viewer:view
+	RoleMapping map[string]string `fig:"roleMapping"`
+	// 同步的集群
+	Clusters []KubeCluster `fig:"clusters"`
+	// 是否开启TokenReview webhook，开启后集群可以使用blade的token认证
+	TokenReview bool `fig:"tokenReview"`
+	// 集群调用TokenReview webhook时携带的bearer token，对应webhook kubeconfig中的users[].user.token
+	TokenReviewToken string `fig:"tokenReviewToken"`
+}
+
+// 同步权限的集群
+type KubeCluster struct {
+	// 集群名称，唯一
+	Name string `fig:"name"`
+	// kubeconfig文件路径，为空时使用blade所在集群的serviceaccount
+	Kubeconfig string `fig:"kubeconfig"`
+}
+
+// jwt签名配置
+type Jwt struct {
+	// 签发token使用的key id，为空时使用第一个key
+	ActiveKey string `fig:"activeKey"`
+	// 签名密钥，可以同时配置多个，轮换时旧的key继续用于校验
+	Keys []JwtKey `fig:"keys"`
+}
+
+// jwt签名密钥
+type JwtKey struct {
+	// key id，会写入jwt header的kid
+	ID string `fig:"id"`
+	// 签名算法，支持 HS256、RS256、ES256
+	Algorithm string `fig:"algorithm"`
+	// HS256使用的密钥
+	Secret string `fig:"secret"`
+	// RS256、ES256使用的PEM格式私钥
+	PrivateKey string `fig:"privateKey"`
+	// 私钥文件路径，与PrivateKey二选一
+	PrivateKeyFile string `fig:"privateKeyFile"`
 }
 
 // 全局配置
@@ -64,6 +313,22 @@ type Config struct {
 	Service *ServiceConfig `fig:"service"`
 	// ldap配置
 	Ldap *Ldap `fig:"ldap"`
+	// oidc配置
+	Oidc *Oidc `fig:"oidc"`
+	// jwt签名配置
+	Jwt *Jwt `fig:"jwt"`
+	// 密码策略
+	PasswordPolicy *PasswordPolicy `fig:"passwordPolicy"`
+	// 两步验证配置
+	MFA *MFA `fig:"mfa"`
+	// 登录保护配置
+	LoginProtection *LoginProtection `fig:"loginProtection"`
+	// 可信反向代理认证配置
+	ProxyAuth *ProxyAuth `fig:"proxyAuth"`
+	// 权限配置
+	Authz *Authz `fig:"authz"`
+	// kubernetes权限同步配置
+	Kubernetes *Kubernetes `fig:"kubernetes"`
 }
 
 // 配置内容
@@ -90,7 +355,139 @@ func Load(dir, name string) error {
 	config.DB = ext.Read().DB
 	config.Email = ext.Read().Email
 
-	config.Ldap = new(Ldap)
+	if config.Ldap == nil {
+		config.Ldap = new(Ldap)
+	}
+	if config.Ldap.Filter == "" {
+		config.Ldap.Filter = _defaultLdapFilter
+	}
+	if config.Ldap.EmailAttr == "" {
+		config.Ldap.EmailAttr = _defaultLdapEmailAttr
+	}
+	if config.Ldap.CnNameAttr == "" {
+		config.Ldap.CnNameAttr = _defaultLdapCnNameAttr
+	}
+	if config.Ldap.PhoneAttr == "" {
+		config.Ldap.PhoneAttr = _defaultLdapPhoneAttr
+	}
+	if config.Ldap.GroupAttr == "" {
+		config.Ldap.GroupAttr = _defaultLdapGroupAttr
+	}
+
+	if config.PasswordPolicy == nil {
+		config.PasswordPolicy = new(PasswordPolicy)
+	}
+	if config.PasswordPolicy.MinLength == 0 {
+		config.PasswordPolicy.MinLength = _defaultPasswordMinLength
+	}
+	if config.MFA == nil {
+		config.MFA = new(MFA)
+	}
+	if config.MFA.Issuer == "" {
+		config.MFA.Issuer = _defaultMFAIssuer
+	}
+	if config.MFA.ChallengeExpired == 0 {
+		config.MFA.ChallengeExpired = _defaultMFAChallengeExpired
+	}
+	if config.LoginProtection == nil {
+		config.LoginProtection = new(LoginProtection)
+	}
+	if config.LoginProtection.MaxAttempts == 0 {
+		config.LoginProtection.MaxAttempts = _defaultLoginMaxAttempts
+	}
+	if config.LoginProtection.IPMaxAttempts == 0 {
+		config.LoginProtection.IPMaxAttempts = _defaultLoginIPMaxAttempts
+	}
+	if config.LoginProtection.Lockout == 0 {
+		config.LoginProtection.Lockout = _defaultLoginLockout
+	}
+	if config.LoginProtection.MaxLockout == 0 {
+		config.LoginProtection.MaxLockout = _defaultLoginMaxLockout
+	}
+	if config.LoginProtection.ResetAfter == 0 {
+		config.LoginProtection.ResetAfter = _defaultLoginResetAfter
+	}
+	if config.Jwt == nil {
+		config.Jwt = new(Jwt)
+	}
+	if config.Authz == nil {
+		config.Authz = new(Authz)
+	}
+	if config.Authz.PolicyReloadInterval == 0 {
+		config.Authz.PolicyReloadInterval = _defaultPolicyReloadInterval
+	}
+	if config.Authz.MaxGrantDuration == 0 {
+		config.Authz.MaxGrantDuration = _defaultMaxGrantDuration
+	}
+	if config.Authz.GrantReapInterval == 0 {
+		config.Authz.GrantReapInterval = _defaultGrantReapInterval
+	}
+	if config.Kubernetes == nil {
+		config.Kubernetes = new(Kubernetes)
+	}
+	if config.Kubernetes.ResyncInterval == 0 {
+		config.Kubernetes.ResyncInterval = _defaultRBACResyncInterval
+	}
+	if config.Kubernetes.ProjectLabel == "" {
+		config.Kubernetes.ProjectLabel = _defaultProjectLabel
+	}
+	if config.Kubernetes.RoleMapping == nil {
+		config.Kubernetes.RoleMapping = map[string]string{
+			"owner":      "admin",
+			"maintainer": "edit",
+			"developer":  "edit",
+			"viewer":     "view",
+		}
+	}
+	// 没有token时任何人都可以用webhook校验token并查询用户的用户组
+	if config.Kubernetes.TokenReview && config.Kubernetes.TokenReviewToken == "" {
+		return fmt.Errorf("kubernetes.tokenReviewToken is required when token review is enabled")
+	}
+	names := map[string]bool{}
+	for _, c := range config.Kubernetes.Clusters {
+		if c.Name == "" || names[c.Name] {
+			return fmt.Errorf("kubernetes cluster name %q is empty or duplicated", c.Name)
+		}
+		names[c.Name] = true
+	}
+	if config.ProxyAuth == nil {
+		config.ProxyAuth = new(ProxyAuth)
+	}
+	if config.ProxyAuth.UserHeader == "" {
+		config.ProxyAuth.UserHeader = _defaultProxyUserHeader
+	}
+	if config.ProxyAuth.EmailHeader == "" {
+		config.ProxyAuth.EmailHeader = _defaultProxyEmailHeader
+	}
+	if config.ProxyAuth.GroupsHeader == "" {
+		config.ProxyAuth.GroupsHeader = _defaultProxyGroupsHeader
+	}
+	if config.ProxyAuth.Enabled {
+		// 没有可信代理时任何人都可以伪造header
+		if len(config.ProxyAuth.TrustedCIDRs) == 0 {
+			return fmt.Errorf("proxyAuth.trustedCIDRs is required when proxy auth is enabled")
+		}
+		for _, cidr := range config.ProxyAuth.TrustedCIDRs {
+			if _, _, err := net.ParseCIDR(cidr); err != nil {
+				return fmt.Errorf("proxyAuth.trustedCIDRs %q invalid: %v", cidr, err)
+			}
+		}
+	}
+	if config.Oidc == nil {
+		config.Oidc = new(Oidc)
+	}
+	if config.Oidc.NameClaim == "" {
+		config.Oidc.NameClaim = _defaultOidcNameClaim
+	}
+	if config.Oidc.EmailClaim == "" {
+		config.Oidc.EmailClaim = _defaultOidcEmailClaim
+	}
+	if config.Oidc.CnNameClaim == "" {
+		config.Oidc.CnNameClaim = _defaultOidcCnNameClaim
+	}
+	if config.Oidc.GroupsClaim == "" {
+		config.Oidc.GroupsClaim = _defaultOidcGroupsClaim
+	}
 
 	// 设置默认端口
 	if config.Service == nil {
@@ -103,10 +500,42 @@ func Load(dir, name string) error {
 	if config.Service.TokenExpired == 0 {
 		config.Service.TokenExpired = _defaultTokenExpired
 	}
+	// 设置默认refresh token超时时间
+	if config.Service.RefreshTokenExpired == 0 {
+		config.Service.RefreshTokenExpired = _defaultRefreshTokenExpired
+	}
 	// 设置默认url超时时间
 	if config.Service.URLExpired == 0 {
 		config.Service.URLExpired = _defaultURLExpired
 	}
+	if config.Service.VerifyEmailExpired == 0 {
+		config.Service.VerifyEmailExpired = _defaultVerifyEmailExpired
+	}
+	if config.Service.InvitationExpired == 0 {
+		config.Service.InvitationExpired = _defaultInvitationExpired
+	}
+	if config.Service.ImpersonationExpired == 0 {
+		config.Service.ImpersonationExpired = _defaultImpersonationExpired
+	}
+	if config.Service.AvatarMaxSize == 0 {
+		config.Service.AvatarMaxSize = _defaultAvatarMaxSize
+	}
+	// 兼容只配置了Company的旧配置
+	if config.Service.RegistrationMode == "" {
+		if config.Service.Company != "" {
+			config.Service.RegistrationMode = RegistrationDomain
+		} else {
+			config.Service.RegistrationMode = RegistrationOpen
+		}
+	}
+	switch config.Service.RegistrationMode {
+	case RegistrationOpen, RegistrationDomain, RegistrationInvite:
+	default:
+		return fmt.Errorf("invalid registration mode: %s", config.Service.RegistrationMode)
+	}
+	if config.Service.RegistrationMode == RegistrationDomain && config.Service.Company == "" {
+		return fmt.Errorf("registration mode %s requires service.company", RegistrationDomain)
+	}
 	// 设置默认管理员密码
 	if config.Service.AdminPassword == "" {
 		config.Service.AdminPassword = _defaultPassword
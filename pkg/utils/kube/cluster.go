@@ -0,0 +1,118 @@
+package kube
+
+import (
+	"context"
+
+	"github.com/hex-techs/blade/pkg/utils/config"
+	rbacv1 "k8s.io/api/rbac/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/clientcmd"
+)
+
+// blade管理的资源的标签
+const (
+	ManagedByLabel = "app.kubernetes.io/managed-by"
+	ManagedByValue = "blade"
+)
+
+// Cluster 同步权限的集群
+type Cluster interface {
+	// Name 集群名称
+	Name() string
+	// Namespaces 返回属于项目的命名空间
+	Namespaces(ctx context.Context, project string) ([]string, error)
+	// RoleBindings 返回命名空间中由blade管理的RoleBinding
+	RoleBindings(ctx context.Context, namespace string) ([]rbacv1.RoleBinding, error)
+	// Create 创建RoleBinding
+	Create(ctx context.Context, rb *rbacv1.RoleBinding) error
+	// Update 更新RoleBinding，roleRef不能修改
+	Update(ctx context.Context, rb *rbacv1.RoleBinding) error
+	// Delete 删除RoleBinding
+	Delete(ctx context.Context, namespace, name string) error
+}
+
+// cluster 使用client-go访问集群
+type cluster struct {
+	name   string
+	client kubernetes.Interface
+	// 命名空间的项目标签
+	label string
+}
+
+// NewCluster 使用clientset创建集群，命名空间的label标签值为项目名时属于该项目
+func NewCluster(name string, client kubernetes.Interface, label string) Cluster {
+	return &cluster{
+		name:   name,
+		client: client,
+		label:  label,
+	}
+}
+
+// LoadClusters 根据配置连接所有集群
+func LoadClusters(cfg *config.Kubernetes) ([]Cluster, error) {
+	var clusters []Cluster
+	for _, c := range cfg.Clusters {
+		var (
+			rc  *rest.Config
+			err error
+		)
+		if c.Kubeconfig == "" {
+			rc, err = rest.InClusterConfig()
+		} else {
+			rc, err = clientcmd.BuildConfigFromFlags("", c.Kubeconfig)
+		}
+		if err != nil {
+			return nil, err
+		}
+		client, err := kubernetes.NewForConfig(rc)
+		if err != nil {
+			return nil, err
+		}
+		clusters = append(clusters, NewCluster(c.Name, client, cfg.ProjectLabel))
+	}
+	return clusters, nil
+}
+
+func (c *cluster) Name() string {
+	return c.name
+}
+
+func (c *cluster) Namespaces(ctx context.Context, project string) ([]string, error) {
+	list, err := c.client.CoreV1().Namespaces().List(ctx, metav1.ListOptions{
+		LabelSelector: c.label + "=" + project,
+	})
+	if err != nil {
+		return nil, err
+	}
+	names := make([]string, 0, len(list.Items))
+	for _, ns := range list.Items {
+		names = append(names, ns.Name)
+	}
+	return names, nil
+}
+
+func (c *cluster) RoleBindings(ctx context.Context, namespace string) ([]rbacv1.RoleBinding, error) {
+	list, err := c.client.RbacV1().RoleBindings(namespace).List(ctx, metav1.ListOptions{
+		LabelSelector: ManagedByLabel + "=" + ManagedByValue,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return list.Items, nil
+}
+
+func (c *cluster) Create(ctx context.Context, rb *rbacv1.RoleBinding) error {
+	_, err := c.client.RbacV1().RoleBindings(rb.Namespace).Create(ctx, rb, metav1.CreateOptions{})
+	return err
+}
+
+func (c *cluster) Update(ctx context.Context, rb *rbacv1.RoleBinding) error {
+	_, err := c.client.RbacV1().RoleBindings(rb.Namespace).Update(ctx, rb, metav1.UpdateOptions{})
+	return err
+}
+
+func (c *cluster) Delete(ctx context.Context, namespace, name string) error {
+	return c.client.RbacV1().RoleBindings(namespace).Delete(ctx, name, metav1.DeleteOptions{})
+}
@@ -0,0 +1,188 @@
+package kube
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/fize/go-ext/log"
+	rbacv1 "k8s.io/api/rbac/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	// blade管理的RoleBinding的名称前缀，后面是blade角色
+	bindingPrefix = "blade:"
+	// 最近一次同步的内容摘要，与当前内容不一致说明被其他人修改过
+	hashAnnotation = "blade.io/hash"
+)
+
+// Subject 项目上的授权主体，Kind为User或Group
+type Subject struct {
+	Kind string
+	Name string
+	// blade角色
+	Role string
+}
+
+// Result 一个命名空间的同步结果
+type Result struct {
+	Cluster   string `json:"cluster"`
+	Namespace string `json:"namespace"`
+	// 创建、更新和删除的RoleBinding
+	Created []string `json:"created,omitempty"`
+	Updated []string `json:"updated,omitempty"`
+	Deleted []string `json:"deleted,omitempty"`
+	// 在blade之外被修改过的RoleBinding，同步时已经恢复
+	Drift []string `json:"drift,omitempty"`
+	// 同步失败的原因
+	Error string `json:"error,omitempty"`
+}
+
+// Reconciler 将项目上的授权同步为项目所有命名空间中的RoleBinding，每个blade角色一个RoleBinding
+type Reconciler struct {
+	Clusters []Cluster
+	// blade角色对应的ClusterRole，没有对应的角色不同步
+	Roles map[string]string
+}
+
+// NewReconciler return a new reconciler
+func NewReconciler(clusters []Cluster, roles map[string]string) *Reconciler {
+	return &Reconciler{
+		Clusters: clusters,
+		Roles:    roles,
+	}
+}
+
+// Reconcile 在所有集群中同步项目的RoleBinding，删除已经不存在的授权，并报告在blade之外发生的修改
+func (r *Reconciler) Reconcile(ctx context.Context, project string, subjects []Subject) []Result {
+	var results []Result
+	for _, c := range r.Clusters {
+		namespaces, err := c.Namespaces(ctx, project)
+		if err != nil {
+			log.Errorw("list project namespaces error", "cluster", c.Name(), "project", project, "error", err)
+			results = append(results, Result{Cluster: c.Name(), Error: err.Error()})
+			continue
+		}
+		for _, ns := range namespaces {
+			result := Result{Cluster: c.Name(), Namespace: ns}
+			if err := r.reconcile(ctx, c, ns, r.desired(ns, subjects), &result); err != nil {
+				log.Errorw("reconcile rolebindings error", "cluster", c.Name(), "namespace", ns, "error", err)
+				result.Error = err.Error()
+			}
+			results = append(results, result)
+		}
+	}
+	return results
+}
+
+// desired 根据授权生成命名空间中应该存在的RoleBinding
+func (r *Reconciler) desired(namespace string, subjects []Subject) map[string]*rbacv1.RoleBinding {
+	bindings := map[string]*rbacv1.RoleBinding{}
+	for _, s := range subjects {
+		role, ok := r.Roles[s.Role]
+		if !ok {
+			continue
+		}
+		name := bindingPrefix + s.Role
+		rb, ok := bindings[name]
+		if !ok {
+			rb = &rbacv1.RoleBinding{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      name,
+					Namespace: namespace,
+					Labels:    map[string]string{ManagedByLabel: ManagedByValue},
+				},
+				RoleRef: rbacv1.RoleRef{
+					APIGroup: rbacv1.GroupName,
+					Kind:     "ClusterRole",
+					Name:     role,
+				},
+			}
+			bindings[name] = rb
+		}
+		rb.Subjects = append(rb.Subjects, rbacv1.Subject{
+			APIGroup: rbacv1.GroupName,
+			Kind:     s.Kind,
+			Name:     s.Name,
+		})
+	}
+	for _, rb := range bindings {
+		sort.Slice(rb.Subjects, func(i, j int) bool {
+			return rb.Subjects[i].Kind+"/"+rb.Subjects[i].Name < rb.Subjects[j].Kind+"/"+rb.Subjects[j].Name
+		})
+		rb.Annotations = map[string]string{hashAnnotation: hash(rb)}
+	}
+	return bindings
+}
+
+// reconcile 使命名空间中blade管理的RoleBinding与期望一致
+func (r *Reconciler) reconcile(ctx context.Context, c Cluster, namespace string, desired map[string]*rbacv1.RoleBinding, result *Result) error {
+	existing, err := c.RoleBindings(ctx, namespace)
+	if err != nil {
+		return err
+	}
+	for i := range existing {
+		rb := &existing[i]
+		// 摘要不一致说明最近一次同步之后被其他人修改过
+		if rb.Annotations[hashAnnotation] != hash(rb) {
+			log.Warnw("rolebinding changed outside blade", "cluster", c.Name(), "namespace", namespace, "name", rb.Name)
+			result.Drift = append(result.Drift, rb.Name)
+		}
+		want, ok := desired[rb.Name]
+		delete(desired, rb.Name)
+		switch {
+		case !ok:
+			log.Infow("delete rolebinding", "cluster", c.Name(), "namespace", namespace, "name", rb.Name)
+			if err := c.Delete(ctx, namespace, rb.Name); err != nil {
+				return err
+			}
+			result.Deleted = append(result.Deleted, rb.Name)
+		case rb.RoleRef != want.RoleRef:
+			// roleRef不能修改，只能重建
+			log.Infow("recreate rolebinding", "cluster", c.Name(), "namespace", namespace, "name", rb.Name)
+			if err := c.Delete(ctx, namespace, rb.Name); err != nil {
+				return err
+			}
+			if err := c.Create(ctx, want); err != nil {
+				return err
+			}
+			result.Updated = append(result.Updated, rb.Name)
+		case hash(rb) != want.Annotations[hashAnnotation] || rb.Annotations[hashAnnotation] != want.Annotations[hashAnnotation]:
+			log.Infow("update rolebinding", "cluster", c.Name(), "namespace", namespace, "name", rb.Name)
+			rb.Subjects = want.Subjects
+			rb.Labels = want.Labels
+			rb.Annotations = want.Annotations
+			if err := c.Update(ctx, rb); err != nil {
+				return err
+			}
+			result.Updated = append(result.Updated, rb.Name)
+		}
+	}
+	names := make([]string, 0, len(desired))
+	for name := range desired {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		log.Infow("create rolebinding", "cluster", c.Name(), "namespace", namespace, "name", name)
+		if err := c.Create(ctx, desired[name]); err != nil {
+			return err
+		}
+		result.Created = append(result.Created, name)
+	}
+	return nil
+}
+
+// hash RoleBinding的roleRef和主体的摘要
+func hash(rb *rbacv1.RoleBinding) string {
+	parts := []string{rb.RoleRef.Kind + "/" + rb.RoleRef.Name}
+	for _, s := range rb.Subjects {
+		parts = append(parts, fmt.Sprintf("%s/%s/%s", s.Kind, s.Namespace, s.Name))
+	}
+	sum := sha256.Sum256([]byte(strings.Join(parts, ",")))
+	return hex.EncodeToString(sum[:8])
+}
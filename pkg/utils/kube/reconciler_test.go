@@ -0,0 +1,291 @@
+package kube
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/fize/go-ext/log"
+	"github.com/hex-techs/blade/pkg/utils/config"
+	corev1 "k8s.io/api/core/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+const testLabel = "blade.io/project"
+
+var testRoles = map[string]string{
+	"owner":     "admin",
+	"developer": "edit",
+	"viewer":    "view",
+}
+
+// TestMain 同步时会输出日志，需要先加载配置初始化日志
+func TestMain(m *testing.M) {
+	dir, err := os.MkdirTemp("", "blade-kube")
+	if err != nil {
+		panic(err)
+	}
+	cfg := "log:\n  output: stdout\n  level: error\n"
+	if err := os.WriteFile(filepath.Join(dir, "config.yaml"), []byte(cfg), 0o600); err != nil {
+		panic(err)
+	}
+	if err := config.Load(dir, "config.yaml"); err != nil {
+		panic(err)
+	}
+	log.InitLogger()
+	code := m.Run()
+	os.RemoveAll(dir)
+	os.Exit(code)
+}
+
+// newFakeCluster 创建带有命名空间的fake集群，命名空间名到所属项目
+func newFakeCluster(namespaces map[string]string, objects ...runtime.Object) (*fake.Clientset, Cluster) {
+	for ns, project := range namespaces {
+		objects = append(objects, &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{
+			Name:   ns,
+			Labels: map[string]string{testLabel: project},
+		}})
+	}
+	client := fake.NewSimpleClientset(objects...)
+	return client, NewCluster("test", client, testLabel)
+}
+
+func getBinding(t *testing.T, client *fake.Clientset, namespace, name string) *rbacv1.RoleBinding {
+	t.Helper()
+	rb, err := client.RbacV1().RoleBindings(namespace).Get(context.TODO(), name, metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("get rolebinding %s/%s: %v", namespace, name, err)
+	}
+	return rb
+}
+
+func subjectNames(rb *rbacv1.RoleBinding) []string {
+	names := []string{}
+	for _, s := range rb.Subjects {
+		names = append(names, s.Kind+"/"+s.Name)
+	}
+	return names
+}
+
+// single 只有一个命名空间时返回它的同步结果
+func single(t *testing.T, results []Result) Result {
+	t.Helper()
+	if len(results) != 1 {
+		t.Fatalf("expected 1 result, got %+v", results)
+	}
+	if results[0].Error != "" {
+		t.Fatalf("reconcile error: %s", results[0].Error)
+	}
+	return results[0]
+}
+
+func TestReconcileCreate(t *testing.T) {
+	client, c := newFakeCluster(map[string]string{"p1-dev": "p1", "p2-dev": "p2"})
+	r := NewReconciler([]Cluster{c}, testRoles)
+	result := single(t, r.Reconcile(context.TODO(), "p1", []Subject{
+		{Kind: rbacv1.UserKind, Name: "bob", Role: "developer"},
+		{Kind: rbacv1.GroupKind, Name: "blade:group:dev", Role: "developer"},
+		{Kind: rbacv1.UserKind, Name: "alice", Role: "viewer"},
+		// 没有对应ClusterRole的角色不同步
+		{Kind: rbacv1.UserKind, Name: "carol", Role: "maintainer"},
+	}))
+	if result.Cluster != "test" || result.Namespace != "p1-dev" {
+		t.Fatalf("unexpected result %+v", result)
+	}
+	if want := []string{"blade:developer", "blade:viewer"}; !reflect.DeepEqual(result.Created, want) {
+		t.Fatalf("created %v, want %v", result.Created, want)
+	}
+	if len(result.Updated)+len(result.Deleted)+len(result.Drift) != 0 {
+		t.Fatalf("unexpected changes %+v", result)
+	}
+	rb := getBinding(t, client, "p1-dev", "blade:developer")
+	if rb.RoleRef.Kind != "ClusterRole" || rb.RoleRef.Name != "edit" {
+		t.Fatalf("unexpected roleRef %+v", rb.RoleRef)
+	}
+	if rb.Labels[ManagedByLabel] != ManagedByValue || rb.Annotations[hashAnnotation] == "" {
+		t.Fatalf("missing label or hash: %+v", rb.ObjectMeta)
+	}
+	if want := []string{"Group/blade:group:dev", "User/bob"}; !reflect.DeepEqual(subjectNames(rb), want) {
+		t.Fatalf("subjects %v, want %v", subjectNames(rb), want)
+	}
+	// 其他项目的命名空间不受影响
+	list, err := client.RbacV1().RoleBindings("p2-dev").List(context.TODO(), metav1.ListOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list.Items) != 0 {
+		t.Fatalf("rolebindings created in other project: %+v", list.Items)
+	}
+	// 没有变化时再次同步不做任何修改
+	result = single(t, r.Reconcile(context.TODO(), "p1", []Subject{
+		{Kind: rbacv1.UserKind, Name: "alice", Role: "viewer"},
+		{Kind: rbacv1.UserKind, Name: "bob", Role: "developer"},
+		{Kind: rbacv1.GroupKind, Name: "blade:group:dev", Role: "developer"},
+	}))
+	if len(result.Created)+len(result.Updated)+len(result.Deleted)+len(result.Drift) != 0 {
+		t.Fatalf("unexpected changes %+v", result)
+	}
+}
+
+func TestReconcileUpdate(t *testing.T) {
+	client, c := newFakeCluster(map[string]string{"p1-dev": "p1"})
+	r := NewReconciler([]Cluster{c}, testRoles)
+	single(t, r.Reconcile(context.TODO(), "p1", []Subject{
+		{Kind: rbacv1.UserKind, Name: "alice", Role: "developer"},
+		{Kind: rbacv1.UserKind, Name: "bob", Role: "developer"},
+	}))
+	result := single(t, r.Reconcile(context.TODO(), "p1", []Subject{
+		{Kind: rbacv1.UserKind, Name: "alice", Role: "developer"},
+		{Kind: rbacv1.UserKind, Name: "carol", Role: "developer"},
+	}))
+	if want := []string{"blade:developer"}; !reflect.DeepEqual(result.Updated, want) {
+		t.Fatalf("updated %v, want %v", result.Updated, want)
+	}
+	if len(result.Drift) != 0 {
+		t.Fatalf("update reported as drift: %v", result.Drift)
+	}
+	rb := getBinding(t, client, "p1-dev", "blade:developer")
+	if want := []string{"User/alice", "User/carol"}; !reflect.DeepEqual(subjectNames(rb), want) {
+		t.Fatalf("subjects %v, want %v", subjectNames(rb), want)
+	}
+	if rb.Annotations[hashAnnotation] != hash(rb) {
+		t.Fatal("hash annotation not updated")
+	}
+
+	// 角色对应的ClusterRole变化时，roleRef不能修改，需要重建
+	r.Roles = map[string]string{"developer": "admin"}
+	result = single(t, r.Reconcile(context.TODO(), "p1", []Subject{
+		{Kind: rbacv1.UserKind, Name: "alice", Role: "developer"},
+	}))
+	if want := []string{"blade:developer"}; !reflect.DeepEqual(result.Updated, want) {
+		t.Fatalf("updated %v, want %v", result.Updated, want)
+	}
+	rb = getBinding(t, client, "p1-dev", "blade:developer")
+	if rb.RoleRef.Name != "admin" {
+		t.Fatalf("roleRef not changed: %+v", rb.RoleRef)
+	}
+	if want := []string{"User/alice"}; !reflect.DeepEqual(subjectNames(rb), want) {
+		t.Fatalf("subjects %v, want %v", subjectNames(rb), want)
+	}
+}
+
+func TestReconcileDeleteRemovedGrants(t *testing.T) {
+	// 不是blade管理的RoleBinding不能删除
+	unmanaged := &rbacv1.RoleBinding{
+		ObjectMeta: metav1.ObjectMeta{Name: "manual", Namespace: "p1-dev"},
+		RoleRef:    rbacv1.RoleRef{APIGroup: rbacv1.GroupName, Kind: "ClusterRole", Name: "view"},
+		Subjects:   []rbacv1.Subject{{APIGroup: rbacv1.GroupName, Kind: rbacv1.UserKind, Name: "dave"}},
+	}
+	client, c := newFakeCluster(map[string]string{"p1-dev": "p1", "p1-prod": "p1"}, unmanaged)
+	r := NewReconciler([]Cluster{c}, testRoles)
+	results := r.Reconcile(context.TODO(), "p1", []Subject{
+		{Kind: rbacv1.UserKind, Name: "alice", Role: "developer"},
+		{Kind: rbacv1.UserKind, Name: "bob", Role: "viewer"},
+	})
+	if len(results) != 2 {
+		t.Fatalf("expected results for both namespaces, got %+v", results)
+	}
+	results = r.Reconcile(context.TODO(), "p1", []Subject{
+		{Kind: rbacv1.UserKind, Name: "alice", Role: "developer"},
+	})
+	if len(results) != 2 {
+		t.Fatalf("expected results for both namespaces, got %+v", results)
+	}
+	for _, result := range results {
+		if result.Error != "" {
+			t.Fatalf("reconcile error: %s", result.Error)
+		}
+		if want := []string{"blade:viewer"}; !reflect.DeepEqual(result.Deleted, want) {
+			t.Fatalf("%s: deleted %v, want %v", result.Namespace, result.Deleted, want)
+		}
+		list, err := client.RbacV1().RoleBindings(result.Namespace).List(context.TODO(), metav1.ListOptions{
+			LabelSelector: ManagedByLabel + "=" + ManagedByValue,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(list.Items) != 1 || list.Items[0].Name != "blade:developer" {
+			t.Fatalf("%s: unexpected rolebindings %+v", result.Namespace, list.Items)
+		}
+	}
+	// 项目上没有授权时删除所有blade管理的RoleBinding
+	result := r.Reconcile(context.TODO(), "p1", nil)
+	for _, res := range result {
+		if want := []string{"blade:developer"}; !reflect.DeepEqual(res.Deleted, want) {
+			t.Fatalf("%s: deleted %v, want %v", res.Namespace, res.Deleted, want)
+		}
+	}
+	getBinding(t, client, "p1-dev", "manual")
+}
+
+func TestReconcileDrift(t *testing.T) {
+	client, c := newFakeCluster(map[string]string{"p1-dev": "p1"})
+	r := NewReconciler([]Cluster{c}, testRoles)
+	subjects := []Subject{{Kind: rbacv1.UserKind, Name: "alice", Role: "viewer"}}
+	single(t, r.Reconcile(context.TODO(), "p1", subjects))
+
+	// 在blade之外给RoleBinding增加主体
+	rb := getBinding(t, client, "p1-dev", "blade:viewer")
+	rb.Subjects = append(rb.Subjects, rbacv1.Subject{APIGroup: rbacv1.GroupName, Kind: rbacv1.UserKind, Name: "mallory"})
+	if _, err := client.RbacV1().RoleBindings("p1-dev").Update(context.TODO(), rb, metav1.UpdateOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	result := single(t, r.Reconcile(context.TODO(), "p1", subjects))
+	if want := []string{"blade:viewer"}; !reflect.DeepEqual(result.Drift, want) {
+		t.Fatalf("drift %v, want %v", result.Drift, want)
+	}
+	if want := []string{"blade:viewer"}; !reflect.DeepEqual(result.Updated, want) {
+		t.Fatalf("updated %v, want %v", result.Updated, want)
+	}
+	rb = getBinding(t, client, "p1-dev", "blade:viewer")
+	if want := []string{"User/alice"}; !reflect.DeepEqual(subjectNames(rb), want) {
+		t.Fatalf("drift not reverted, subjects %v", subjectNames(rb))
+	}
+	// 恢复之后不再报告
+	result = single(t, r.Reconcile(context.TODO(), "p1", subjects))
+	if len(result.Drift)+len(result.Updated) != 0 {
+		t.Fatalf("unexpected changes after revert %+v", result)
+	}
+
+	// 修改了摘要注解同样视为被修改
+	rb.Annotations[hashAnnotation] = "tampered"
+	if _, err := client.RbacV1().RoleBindings("p1-dev").Update(context.TODO(), rb, metav1.UpdateOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	result = single(t, r.Reconcile(context.TODO(), "p1", subjects))
+	if want := []string{"blade:viewer"}; !reflect.DeepEqual(result.Drift, want) {
+		t.Fatalf("drift %v, want %v", result.Drift, want)
+	}
+	if rb = getBinding(t, client, "p1-dev", "blade:viewer"); rb.Annotations[hashAnnotation] != hash(rb) {
+		t.Fatal("hash annotation not restored")
+	}
+}
+
+func TestReconcileErrors(t *testing.T) {
+	client, c := newFakeCluster(map[string]string{"p1-dev": "p1"})
+	client.PrependReactor("create", "rolebindings", func(k8stesting.Action) (bool, runtime.Object, error) {
+		return true, nil, errors.New("forbidden")
+	})
+	broken, bc := newFakeCluster(nil)
+	broken.PrependReactor("list", "namespaces", func(k8stesting.Action) (bool, runtime.Object, error) {
+		return true, nil, errors.New("unreachable")
+	})
+	r := NewReconciler([]Cluster{c, bc}, testRoles)
+	results := r.Reconcile(context.TODO(), "p1", []Subject{{Kind: rbacv1.UserKind, Name: "alice", Role: "viewer"}})
+	if len(results) != 2 {
+		t.Fatalf("expected a result per cluster, got %+v", results)
+	}
+	if results[0].Namespace != "p1-dev" || results[0].Error != "forbidden" || len(results[0].Created) != 0 {
+		t.Fatalf("unexpected result %+v", results[0])
+	}
+	if results[1].Namespace != "" || results[1].Error != "unreachable" {
+		t.Fatalf("unexpected result %+v", results[1])
+	}
+}
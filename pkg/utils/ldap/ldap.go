@@ -0,0 +1,110 @@
+package ldap
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/go-ldap/ldap/v3"
+	"github.com/hex-techs/blade/pkg/utils/config"
+)
+
+var (
+	// ErrInvalidCredentials 用户名或密码错误
+	ErrInvalidCredentials = errors.New("ldap invalid credentials")
+	// ErrUserNotFound 用户不存在或不唯一
+	ErrUserNotFound = errors.New("ldap user not found")
+)
+
+// Entry ldap中的用户信息
+type Entry struct {
+	// 用户DN
+	DN string
+	// 用户名
+	Name string
+	// 邮箱
+	Email string
+	// 中文名称
+	CnName string
+	// 电话号码
+	Phone string
+	// 所在的用户组名
+	Groups []string
+}
+
+// Enabled 是否开启了ldap认证
+func Enabled() bool {
+	return config.Read().Ldap != nil && config.Read().Ldap.Enabled
+}
+
+// Authenticate 使用服务账号查找用户，再以用户身份绑定校验密码
+func Authenticate(name, password string) (*Entry, error) {
+	// ldap允许空密码的匿名绑定，必须提前拦截
+	if name == "" || password == "" {
+		return nil, ErrInvalidCredentials
+	}
+	cfg := config.Read().Ldap
+	conn, err := ldap.DialURL(addr(cfg.Host))
+	if err != nil {
+		return nil, fmt.Errorf("connect ldap error: %v", err)
+	}
+	defer conn.Close()
+
+	if err := conn.Bind(cfg.User, cfg.Password); err != nil {
+		return nil, fmt.Errorf("bind ldap service user error: %v", err)
+	}
+	req := ldap.NewSearchRequest(
+		cfg.BaseDN, ldap.ScopeWholeSubtree, ldap.NeverDerefAliases, 2, 0, false,
+		fmt.Sprintf(cfg.Filter, ldap.EscapeFilter(name)),
+		[]string{"dn", cfg.EmailAttr, cfg.CnNameAttr, cfg.PhoneAttr, cfg.GroupAttr},
+		nil,
+	)
+	sr, err := conn.Search(req)
+	if err != nil {
+		if ldap.IsErrorWithCode(err, ldap.LDAPResultSizeLimitExceeded) {
+			return nil, ErrUserNotFound
+		}
+		return nil, fmt.Errorf("search ldap user error: %v", err)
+	}
+	if len(sr.Entries) != 1 {
+		return nil, ErrUserNotFound
+	}
+	e := sr.Entries[0]
+	if err := conn.Bind(e.DN, password); err != nil {
+		if ldap.IsErrorWithCode(err, ldap.LDAPResultInvalidCredentials) {
+			return nil, ErrInvalidCredentials
+		}
+		return nil, fmt.Errorf("bind ldap user error: %v", err)
+	}
+	return &Entry{
+		DN:     e.DN,
+		Name:   name,
+		Email:  e.GetAttributeValue(cfg.EmailAttr),
+		CnName: e.GetAttributeValue(cfg.CnNameAttr),
+		Phone:  e.GetAttributeValue(cfg.PhoneAttr),
+		Groups: groupNames(e.GetAttributeValues(cfg.GroupAttr)),
+	}, nil
+}
+
+// groupNames 从用户组DN中取第一个RDN的值作为用户组名，如 cn=dev,ou=Groups,dc=blade,dc=cn 为 dev
+func groupNames(dns []string) []string {
+	var names []string
+	for _, v := range dns {
+		dn, err := ldap.ParseDN(v)
+		if err != nil || len(dn.RDNs) == 0 || len(dn.RDNs[0].Attributes) == 0 {
+			// 不是DN时直接作为用户组名
+			names = append(names, v)
+			continue
+		}
+		names = append(names, dn.RDNs[0].Attributes[0].Value)
+	}
+	return names
+}
+
+// addr 兼容 127.0.0.1:389 和 ldap://127.0.0.1:389 两种写法
+func addr(host string) string {
+	if strings.Contains(host, "://") {
+		return host
+	}
+	return "ldap://" + host
+}
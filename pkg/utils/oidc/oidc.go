@@ -0,0 +1,180 @@
+package oidc
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/coreos/go-oidc/v3/oidc"
+	"github.com/hex-techs/blade/pkg/utils/config"
+	"golang.org/x/oauth2"
+)
+
+// ErrNonceMismatch id token中的nonce与登录时生成的不一致
+var ErrNonceMismatch = errors.New("oidc nonce mismatch")
+
+// Identity 从id token中解析出的用户信息
+type Identity struct {
+	// 签发id token的issuer
+	Issuer string
+	// issuer中的唯一标识
+	Subject string
+	// 用户名
+	Name string
+	// 邮箱
+	Email string
+	// 中文名称
+	CnName string
+	// 用户组
+	Groups []string
+	// 是否是管理员
+	Admin bool
+}
+
+var (
+	lock     sync.Mutex
+	provider *oidc.Provider
+	// provider对应的issuer地址，配置的issuer变化后重新获取
+	issuer string
+)
+
+// Enabled 是否开启了oidc单点登录
+func Enabled() bool {
+	return config.Read().Oidc != nil && config.Read().Oidc.Enabled
+}
+
+// getProvider 首次使用时才去issuer获取discovery信息，失败后下次请求会重试
+func getProvider(ctx context.Context) (*oidc.Provider, error) {
+	lock.Lock()
+	defer lock.Unlock()
+	cfg := config.Read().Oidc
+	if provider != nil && issuer == cfg.Issuer {
+		return provider, nil
+	}
+	p, err := oidc.NewProvider(ctx, cfg.Issuer)
+	if err != nil {
+		return nil, fmt.Errorf("discover oidc issuer error: %v", err)
+	}
+	provider, issuer = p, cfg.Issuer
+	return provider, nil
+}
+
+func oauth2Config(p *oidc.Provider) *oauth2.Config {
+	cfg := config.Read().Oidc
+	scopes := []string{oidc.ScopeOpenID}
+	for _, s := range cfg.Scopes {
+		if s != oidc.ScopeOpenID {
+			scopes = append(scopes, s)
+		}
+	}
+	return &oauth2.Config{
+		ClientID:     cfg.ClientID,
+		ClientSecret: cfg.ClientSecret,
+		RedirectURL:  cfg.RedirectURL,
+		Endpoint:     p.Endpoint(),
+		Scopes:       scopes,
+	}
+}
+
+// AuthCodeURL 生成跳转到issuer的授权地址，使用S256方式的PKCE
+func AuthCodeURL(ctx context.Context, state, nonce, verifier string) (string, error) {
+	p, err := getProvider(ctx)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256([]byte(verifier))
+	return oauth2Config(p).AuthCodeURL(state,
+		oidc.Nonce(nonce),
+		oauth2.SetAuthURLParam("code_challenge", base64.RawURLEncoding.EncodeToString(sum[:])),
+		oauth2.SetAuthURLParam("code_challenge_method", "S256"),
+	), nil
+}
+
+// Exchange 使用授权码换取token，并通过issuer的JWKS校验id token
+func Exchange(ctx context.Context, code, verifier, nonce string) (*Identity, error) {
+	p, err := getProvider(ctx)
+	if err != nil {
+		return nil, err
+	}
+	oc := oauth2Config(p)
+	t, err := oc.Exchange(ctx, code, oauth2.SetAuthURLParam("code_verifier", verifier))
+	if err != nil {
+		return nil, fmt.Errorf("exchange oidc code error: %v", err)
+	}
+	raw, ok := t.Extra("id_token").(string)
+	if !ok {
+		return nil, errors.New("no id_token in oidc token response")
+	}
+	idToken, err := p.Verifier(&oidc.Config{ClientID: oc.ClientID}).Verify(ctx, raw)
+	if err != nil {
+		return nil, fmt.Errorf("verify oidc id_token error: %v", err)
+	}
+	if idToken.Nonce != nonce {
+		return nil, ErrNonceMismatch
+	}
+	var claims map[string]interface{}
+	if err := idToken.Claims(&claims); err != nil {
+		return nil, err
+	}
+	return parseIdentity(idToken.Issuer, idToken.Subject, claims)
+}
+
+// parseIdentity 按照配置的claim名称解析用户信息
+func parseIdentity(iss, sub string, claims map[string]interface{}) (*Identity, error) {
+	cfg := config.Read().Oidc
+	id := &Identity{
+		Issuer:  iss,
+		Subject: sub,
+		Name:    stringClaim(claims[cfg.NameClaim]),
+		Email:   stringClaim(claims[cfg.EmailClaim]),
+		CnName:  stringClaim(claims[cfg.CnNameClaim]),
+		Groups:  stringsClaim(claims[cfg.GroupsClaim]),
+	}
+	if id.Name == "" {
+		return nil, fmt.Errorf("oidc claim %s is empty", cfg.NameClaim)
+	}
+	if cfg.AdminClaim != "" {
+		id.Admin = isAdmin(claims[cfg.AdminClaim], cfg.AdminValues)
+	}
+	return id, nil
+}
+
+// isAdmin claim为true，或者claim的值包含任意一个AdminValues时为管理员
+func isAdmin(v interface{}, values []string) bool {
+	if b, ok := v.(bool); ok {
+		return b
+	}
+	for _, got := range stringsClaim(v) {
+		for _, want := range values {
+			if got == want {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func stringClaim(v interface{}) string {
+	s, _ := v.(string)
+	return s
+}
+
+// stringsClaim 兼容字符串和字符串数组两种claim格式
+func stringsClaim(v interface{}) []string {
+	switch t := v.(type) {
+	case string:
+		return []string{t}
+	case []interface{}:
+		var r []string
+		for _, i := range t {
+			if s, ok := i.(string); ok {
+				r = append(r, s)
+			}
+		}
+		return r
+	}
+	return nil
+}
@@ -0,0 +1,105 @@
+package password
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"fmt"
+	"strings"
+	"sync"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/pbkdf2"
+)
+
+// argon2id参数
+const (
+	// 内存，单位KiB
+	memory = 64 * 1024
+	// 迭代次数
+	iterations = 1
+	// 并行度
+	parallelism = 4
+	// 盐长度
+	saltLength = 16
+	// 哈希长度
+	keyLength = 32
+)
+
+// 旧版本使用的全局盐，只用于校验历史密码
+const legacySalt = "blade"
+
+var b64 = base64.RawStdEncoding
+
+// Hash 使用argon2id生成PHC格式的密码哈希，每个密码使用独立的随机盐
+func Hash(plain string) (string, error) {
+	salt := make([]byte, saltLength)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+	key := argon2.IDKey([]byte(plain), salt, iterations, memory, parallelism, keyLength)
+	return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s",
+		argon2.Version, memory, iterations, parallelism, b64.EncodeToString(salt), b64.EncodeToString(key)), nil
+}
+
+// Verify 校验明文密码与哈希是否匹配，兼容旧版本的pbkdf2格式
+func Verify(plain, encoded string) bool {
+	if encoded == "" {
+		return false
+	}
+	if !strings.HasPrefix(encoded, "$argon2id$") {
+		return verifyLegacy(plain, encoded)
+	}
+	var (
+		version int
+		m, t    uint32
+		p       uint8
+	)
+	parts := strings.Split(encoded, "$")
+	// "", "argon2id", "v=19", "m=65536,t=1,p=4", salt, key
+	if len(parts) != 6 {
+		return false
+	}
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return false
+	}
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &m, &t, &p); err != nil {
+		return false
+	}
+	salt, err := b64.DecodeString(parts[4])
+	if err != nil {
+		return false
+	}
+	key, err := b64.DecodeString(parts[5])
+	if err != nil {
+		return false
+	}
+	got := argon2.IDKey([]byte(plain), salt, t, m, p, uint32(len(key)))
+	return subtle.ConstantTimeCompare(got, key) == 1
+}
+
+// NeedsRehash 哈希不是使用当前算法和参数生成时，需要在登录成功后重新生成
+func NeedsRehash(encoded string) bool {
+	return !strings.HasPrefix(encoded, fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$",
+		argon2.Version, memory, iterations, parallelism))
+}
+
+var (
+	dummyOnce sync.Once
+	dummyHash string
+)
+
+// VerifyDummy 用户不存在时执行一次开销相同的校验，避免通过响应时间判断用户是否存在
+func VerifyDummy(plain string) {
+	dummyOnce.Do(func() {
+		dummyHash, _ = Hash("blade")
+	})
+	Verify(plain, dummyHash)
+}
+
+// verifyLegacy 校验旧版本使用全局盐的pbkdf2哈希
+func verifyLegacy(plain, encoded string) bool {
+	key := pbkdf2.Key([]byte(plain), []byte(legacySalt), 10000, 50, sha256.New)
+	return subtle.ConstantTimeCompare([]byte(encoded), []byte(fmt.Sprintf("%x", key))) == 1
+}
@@ -0,0 +1,160 @@
+package password
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"unicode"
+
+	"github.com/fize/go-ext/log"
+	"github.com/hex-techs/blade/pkg/utils/config"
+)
+
+// 密码规则
+const (
+	RuleLength   = "length"
+	RuleUpper    = "upper"
+	RuleLower    = "lower"
+	RuleDigit    = "digit"
+	RuleSymbol   = "symbol"
+	RuleUserInfo = "userInfo"
+	RuleHistory  = "history"
+	RuleBreached = "breached"
+)
+
+// Violation 违反的密码规则
+type Violation struct {
+	// 规则名称
+	Rule string `json:"rule"`
+	// 具体信息
+	Message string `json:"message"`
+}
+
+// Violations 违反的所有密码规则
+type Violations []Violation
+
+func (v Violations) Error() string {
+	msgs := make([]string, 0, len(v))
+	for _, i := range v {
+		msgs = append(msgs, i.Message)
+	}
+	return strings.Join(msgs, "; ")
+}
+
+// Check 按照配置的密码策略检查密码，history为用户当前及最近使用过的密码哈希
+func Check(plain, name, email string, history []string) Violations {
+	p := config.Read().PasswordPolicy
+	var v Violations
+	if len([]rune(plain)) < p.MinLength {
+		v = append(v, Violation{RuleLength, fmt.Sprintf("password must be at least %d characters", p.MinLength)})
+	}
+	var upper, lower, digit, symbol bool
+	for _, r := range plain {
+		switch {
+		case unicode.IsUpper(r):
+			upper = true
+		case unicode.IsLower(r):
+			lower = true
+		case unicode.IsDigit(r):
+			digit = true
+		case unicode.IsPunct(r) || unicode.IsSymbol(r):
+			symbol = true
+		}
+	}
+	if p.RequireUpper && !upper {
+		v = append(v, Violation{RuleUpper, "password must contain an uppercase letter"})
+	}
+	if p.RequireLower && !lower {
+		v = append(v, Violation{RuleLower, "password must contain a lowercase letter"})
+	}
+	if p.RequireDigit && !digit {
+		v = append(v, Violation{RuleDigit, "password must contain a digit"})
+	}
+	if p.RequireSymbol && !symbol {
+		v = append(v, Violation{RuleSymbol, "password must contain a symbol"})
+	}
+	if !p.AllowUserInfo && containsUserInfo(plain, name, email) {
+		v = append(v, Violation{RuleUserInfo, "password must not contain the username or email"})
+	}
+	for _, h := range history {
+		if Verify(plain, h) {
+			v = append(v, Violation{RuleHistory, fmt.Sprintf("password must not be one of the last %d passwords", p.History)})
+			break
+		}
+	}
+	if p.BreachedListFile != "" && breached(p.BreachedListFile, plain) {
+		v = append(v, Violation{RuleBreached, "password appears in a list of breached passwords"})
+	}
+	return v
+}
+
+// containsUserInfo 密码中是否包含用户名或邮箱的用户名部分，忽略大小写
+func containsUserInfo(plain, name, email string) bool {
+	lp := strings.ToLower(plain)
+	for _, s := range []string{name, email, strings.Split(email, "@")[0]} {
+		// 过短的用户名容易误判
+		if len(s) >= 3 && strings.Contains(lp, strings.ToLower(s)) {
+			return true
+		}
+	}
+	return false
+}
+
+var (
+	breachedLock sync.Mutex
+	// 已加载的泄露密码列表，以文件路径为索引
+	breachedLists = map[string]map[string]struct{}{}
+)
+
+// LoadBreachedList 启动时加载配置的泄露密码列表，文件无法读取时返回错误，避免所有密码都被静默放行
+func LoadBreachedList() error {
+	file := config.Read().PasswordPolicy.BreachedListFile
+	if file == "" {
+		return nil
+	}
+	list, err := loadBreachedList(file)
+	if err != nil {
+		return fmt.Errorf("load breached password list %s error: %v", file, err)
+	}
+	breachedLock.Lock()
+	breachedLists[file] = list
+	breachedLock.Unlock()
+	log.Infow("breached password list loaded", "file", file, "count", len(list))
+	return nil
+}
+
+// breached 密码是否在泄露密码列表中，启动时没有加载的列表在第一次使用时加载，加载失败时下次重试
+func breached(file, plain string) bool {
+	breachedLock.Lock()
+	list, ok := breachedLists[file]
+	if !ok {
+		var err error
+		list, err = loadBreachedList(file)
+		if err != nil {
+			log.Errorw("load breached password list error", "file", file, "error", err)
+		} else {
+			breachedLists[file] = list
+		}
+	}
+	breachedLock.Unlock()
+	_, found := list[plain]
+	return found
+}
+
+func loadBreachedList(file string) (map[string]struct{}, error) {
+	list := map[string]struct{}{}
+	f, err := os.Open(file)
+	if err != nil {
+		return list, err
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if line := strings.TrimSpace(scanner.Text()); line != "" {
+			list[line] = struct{}{}
+		}
+	}
+	return list, scanner.Err()
+}
@@ -76,6 +76,11 @@ func (s *Engine) Get(ctx context.Context, id uint, name string, v interface{}) e
 	return errors.New(paramError)
 }
 
+// GetBy 根据指定字段获取记录详情，field由调用方指定，不能来自用户输入
+func (s *Engine) GetBy(ctx context.Context, field string, value interface{}, v interface{}) error {
+	return s.conn.WithContext(ctx).Where(field+" = ?", value).First(v).Error
+}
+
 // Create 创建一条新纪录，如果已经存在，则返回错误
 func (s *Engine) Create(ctx context.Context, v interface{}) error {
 	return s.conn.WithContext(ctx).Create(v).Error
@@ -92,6 +97,18 @@ func (s *Engine) Update(ctx context.Context, id uint, name string, has interface
 	return errors.New(paramError)
 }
 
+// CompareAndUpdate 只有记录的field等于value时才更新，返回是否更新成功，用于一次性消费的场景
+func (s *Engine) CompareAndUpdate(ctx context.Context, id uint, field string, value interface{}, has interface{}, v interface{}) (bool, error) {
+	result := s.conn.WithContext(ctx).Model(has).Where("id = ?", id).Where(field+" = ?", value).Updates(v)
+	return result.RowsAffected == 1, result.Error
+}
+
+// UpdateWhere 根据条件更新多条记录，返回更新的记录数，query由调用方指定，参数通过args传入
+func (s *Engine) UpdateWhere(ctx context.Context, has interface{}, v interface{}, query string, args ...interface{}) (int64, error) {
+	result := s.conn.WithContext(ctx).Model(has).Where(query, args...).Updates(v)
+	return result.RowsAffected, result.Error
+}
+
 // ForceUpdate 强制更新一条记录的所有字段
 func (s *Engine) ForceUpdate(ctx context.Context, id uint, name string, has interface{}, v interface{}) error {
 	if id != 0 {
@@ -125,6 +142,16 @@ func (s *Engine) ForceDelete(ctx context.Context, id uint, name string, v interf
 	return errors.New(paramError)
 }
 
+// FindWhere 根据条件获取多条记录，query由调用方指定，参数通过args传入
+func (s *Engine) FindWhere(ctx context.Context, v interface{}, query string, args ...interface{}) error {
+	return s.conn.WithContext(ctx).Where(query, args...).Find(v).Error
+}
+
+// DeleteWhere 根据条件真正的删除多条记录，query由调用方指定，参数通过args传入
+func (s *Engine) DeleteWhere(ctx context.Context, v interface{}, query string, args ...interface{}) error {
+	return s.conn.WithContext(ctx).Unscoped().Where(query, args...).Delete(v).Error
+}
+
 // List 根据给定的数据返回一个数据列表
 // TODO: condition有sql注入风险
 func (s *Engine) List(ctx context.Context, size, current int, condition string, v interface{}) (int64, error) {
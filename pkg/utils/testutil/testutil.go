@@ -0,0 +1,47 @@
+// Package testutil 测试使用的公共环境，只能在测试中引用
+package testutil
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/fize/go-ext/log"
+	"github.com/hex-techs/blade/pkg/utils/config"
+	"github.com/hex-techs/blade/pkg/utils/storage"
+	"github.com/hex-techs/blade/pkg/utils/token"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// NewStore 在临时目录中写入配置并加载，初始化日志和jwt密钥，创建sqlite数据库并迁移tables中的表，
+// extra为追加的配置，测试结束时关闭数据库
+func NewStore(t testing.TB, extra string, tables ...interface{}) *storage.Engine {
+	t.Helper()
+	dir := t.TempDir()
+	cfg := fmt.Sprintf("db:\n  type: sqlite3\n  db: %s\nlog:\n  output: stdout\n  level: error\n%s",
+		filepath.Join(dir, "blade.db"), extra)
+	if err := os.WriteFile(filepath.Join(dir, "config.yaml"), []byte(cfg), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := config.Load(dir, "config.yaml"); err != nil {
+		t.Fatal(err)
+	}
+	log.InitLogger()
+	if err := token.LoadKeys(config.Read().Jwt); err != nil {
+		t.Fatal(err)
+	}
+	s := storage.NewEngine("", config.Read().DB.DB, "", "")
+	db := s.Client().(*gorm.DB)
+	db.Config.Logger = logger.Default.LogMode(logger.Silent)
+	if err := db.AutoMigrate(tables...); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		if c, err := db.DB(); err == nil {
+			c.Close()
+		}
+	})
+	return s
+}
@@ -1,34 +1,126 @@
 package token
 
 import (
+	"errors"
+	"net/http"
 	"time"
 
 	"github.com/dgrijalva/jwt-go"
 )
 
-const title = "blade"
+// 访问令牌的权限范围
+const (
+	// 只允许读请求
+	ScopeRead = "read"
+	// 允许所有请求
+	ScopeWrite = "write"
+)
+
+// 服务账号，token中的名称为 serviceaccount:<name>，用户名不能包含':'，因此不会与用户重名
+const KindServiceAccount = "serviceaccount"
+
+// ServiceAccountName 服务账号在token中的名称
+func ServiceAccountName(name string) string {
+	return KindServiceAccount + ":" + name
+}
+
+// 特定用途的token，不能用于访问接口
+const (
+	// 已通过密码认证，等待输入两步验证码
+	PurposeMFA = "mfa"
+	// 管理员必须开启两步验证，只能用于绑定认证器
+	PurposeMFAEnroll = "mfa_enroll"
+	// 邮箱验证链接
+	PurposeVerifyEmail = "verify_email"
+)
+
+// Actor 模拟登录时真实操作的管理员
+type Actor struct {
+	ID   uint
+	Name string
+	// 管理员的登录会话id，会话被吊销后模拟登录的token同时失效
+	SID string
+}
 
 // Claims jwt object
 type Claims struct {
 	ID    uint
 	Name  string
 	Admin bool
+	// 访问令牌的权限范围，交互式登录的token为空，表示不限制
+	Scopes []string `json:",omitempty"`
+	// 用户的token版本号，与用户当前版本号不一致时token失效
+	Version uint `json:",omitempty"`
+	// token用途，为空表示普通的访问token
+	Purpose string `json:",omitempty"`
+	// 邮箱验证token中待验证的邮箱
+	Email string `json:",omitempty"`
+	// 登录会话id，会话被吊销后token失效
+	SID string `json:",omitempty"`
+	// 主体类型，为空表示用户，服务账号的ID为0，避免与用户id比较时混淆
+	Kind string `json:",omitempty"`
+	// 模拟登录时真实操作的管理员，ID、Name和Admin为被模拟的用户，鉴权以被模拟的用户为准
+	Actor *Actor `json:",omitempty"`
 	jwt.StandardClaims
 }
 
-// GenerateJWTToken 生成jwt格式token
+// Allow 判断权限范围是否允许该请求方法
+func (c *Claims) Allow(method string) bool {
+	if len(c.Scopes) == 0 {
+		return true
+	}
+	for _, s := range c.Scopes {
+		switch s {
+		case ScopeWrite:
+			return true
+		case ScopeRead:
+			if method == http.MethodGet || method == http.MethodHead || method == http.MethodOptions {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// IsServiceAccount 是否是服务账号
+func (c *Claims) IsServiceAccount() bool {
+	return c.Kind == KindServiceAccount
+}
+
+// IsImpersonated 是否是管理员模拟的用户
+func (c *Claims) IsImpersonated() bool {
+	return c.Actor != nil
+}
+
+// IsAccessToken 是否通过访问令牌认证，而不是交互式登录
+func (c *Claims) IsAccessToken() bool {
+	return len(c.Scopes) > 0
+}
+
+// GenerateJWTToken 生成jwt格式token，设置过期时间、签发时间和唯一id
 func GenerateJWTToken(claims *Claims, exp int64) (string, int64, error) {
-	expires := time.Now().Add(time.Second * time.Duration(exp)).Unix()
-	tokenClaims := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	token, err := tokenClaims.SignedString([]byte(title))
+	now := time.Now()
+	expires := now.Add(time.Second * time.Duration(exp)).Unix()
+	jti, err := RandomString(16)
+	if err != nil {
+		return "", 0, err
+	}
+	claims.ExpiresAt = expires
+	claims.IssuedAt = now.Unix()
+	claims.NotBefore = now.Unix()
+	claims.Id = jti
+	if active == nil {
+		return "", 0, errors.New("jwt signing key not loaded")
+	}
+	tokenClaims := jwt.NewWithClaims(active.method, claims)
+	tokenClaims.Header["kid"] = active.id
+	token, err := tokenClaims.SignedString(active.sign)
 	return token, expires, err
 }
 
 // ParseJWTToken validate jwt token
 func ParseJWTToken(token string) (*Claims, error) {
-	tokenClaims, err := jwt.ParseWithClaims(token, &Claims{}, func(token *jwt.Token) (interface{}, error) {
-		return []byte(title), nil
-	})
+	tokenClaims, err := jwt.ParseWithClaims(token, &Claims{}, keyFunc)
 	if tokenClaims != nil {
 		if claims, ok := tokenClaims.Claims.(*Claims); ok && tokenClaims.Valid {
 			return claims, nil
@@ -37,3 +129,15 @@ func ParseJWTToken(token string) (*Claims, error) {
 
 	return nil, err
 }
+
+// ParsePurposeToken 解析特定用途的jwt token，用途不一致时返回错误
+func ParsePurposeToken(token, purpose string) (*Claims, error) {
+	claims, err := ParseJWTToken(token)
+	if err != nil {
+		return nil, err
+	}
+	if claims.Purpose != purpose {
+		return nil, errors.New("token purpose invalid")
+	}
+	return claims, nil
+}
@@ -0,0 +1,175 @@
+package token
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/fize/go-ext/log"
+	"github.com/hex-techs/blade/pkg/utils/config"
+)
+
+// 未配置签名密钥时生成的临时key id
+const ephemeralKeyID = "ephemeral"
+
+// signingKey 签名密钥
+type signingKey struct {
+	id     string
+	method jwt.SigningMethod
+	// 签名使用的密钥
+	sign interface{}
+	// 校验使用的密钥，HS256时与sign相同
+	verify interface{}
+}
+
+var (
+	// 所有可用于校验的key，以kid为索引
+	keys map[string]*signingKey
+	// 当前用于签发的key
+	active *signingKey
+)
+
+// LoadKeys 加载签名密钥，只在程序启动时加载一次
+func LoadKeys(cfg *config.Jwt) error {
+	keys = map[string]*signingKey{}
+	active = nil
+	if cfg == nil || len(cfg.Keys) == 0 {
+		// 没有配置密钥时生成临时密钥，重启或多副本部署时token会失效
+		log.Warn("no jwt signing key configured, using an ephemeral key")
+		pk, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		if err != nil {
+			return err
+		}
+		active = &signingKey{id: ephemeralKeyID, method: jwt.SigningMethodES256, sign: pk, verify: &pk.PublicKey}
+		keys[active.id] = active
+		return nil
+	}
+	for _, kc := range cfg.Keys {
+		k, err := parseKey(kc)
+		if err != nil {
+			return fmt.Errorf("load jwt key %s error: %v", kc.ID, err)
+		}
+		if _, ok := keys[k.id]; ok {
+			return fmt.Errorf("duplicate jwt key id %s", k.id)
+		}
+		keys[k.id] = k
+		if active == nil || k.id == cfg.ActiveKey {
+			active = k
+		}
+	}
+	if cfg.ActiveKey != "" && active.id != cfg.ActiveKey {
+		return fmt.Errorf("active jwt key %s not found", cfg.ActiveKey)
+	}
+	return nil
+}
+
+// parseKey 根据算法解析密钥
+func parseKey(kc config.JwtKey) (*signingKey, error) {
+	if kc.ID == "" {
+		return nil, errors.New("key id is empty")
+	}
+	pem := []byte(kc.PrivateKey)
+	if kc.PrivateKeyFile != "" {
+		b, err := os.ReadFile(kc.PrivateKeyFile)
+		if err != nil {
+			return nil, err
+		}
+		pem = b
+	}
+	k := &signingKey{id: kc.ID}
+	switch kc.Algorithm {
+	case "HS256", "":
+		if len(kc.Secret) < 32 {
+			return nil, errors.New("HS256 secret must be at least 32 characters")
+		}
+		k.method = jwt.SigningMethodHS256
+		k.sign = []byte(kc.Secret)
+		k.verify = k.sign
+	case "RS256":
+		pk, err := jwt.ParseRSAPrivateKeyFromPEM(pem)
+		if err != nil {
+			return nil, err
+		}
+		k.method = jwt.SigningMethodRS256
+		k.sign = pk
+		k.verify = &pk.PublicKey
+	case "ES256":
+		pk, err := jwt.ParseECPrivateKeyFromPEM(pem)
+		if err != nil {
+			return nil, err
+		}
+		if pk.Curve != elliptic.P256() {
+			return nil, errors.New("ES256 key must use the P-256 curve")
+		}
+		k.method = jwt.SigningMethodES256
+		k.sign = pk
+		k.verify = &pk.PublicKey
+	default:
+		return nil, fmt.Errorf("unsupported algorithm %s", kc.Algorithm)
+	}
+	return k, nil
+}
+
+// keyFunc 根据jwt header中的kid选择校验密钥，并且算法必须与密钥一致
+func keyFunc(t *jwt.Token) (interface{}, error) {
+	kid, _ := t.Header["kid"].(string)
+	k, ok := keys[kid]
+	if !ok {
+		return nil, fmt.Errorf("unknown signing key %q", kid)
+	}
+	if t.Method.Alg() != k.method.Alg() {
+		return nil, fmt.Errorf("unexpected signing method %s", t.Method.Alg())
+	}
+	return k.verify, nil
+}
+
+// JWK json web key
+type JWK struct {
+	Kty string `json:"kty"`
+	Use string `json:"use"`
+	Kid string `json:"kid"`
+	Alg string `json:"alg"`
+	// RSA公钥
+	N string `json:"n,omitempty"`
+	E string `json:"e,omitempty"`
+	// EC公钥
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+	Y   string `json:"y,omitempty"`
+}
+
+// JWKS json web key set
+type JWKS struct {
+	Keys []JWK `json:"keys"`
+}
+
+// PublicKeys 返回所有非对称密钥的公钥，HS256密钥不会公开
+func PublicKeys() *JWKS {
+	set := &JWKS{Keys: []JWK{}}
+	for _, k := range keys {
+		enc := base64.RawURLEncoding.EncodeToString
+		switch pub := k.verify.(type) {
+		case *rsa.PublicKey:
+			set.Keys = append(set.Keys, JWK{
+				Kty: "RSA", Use: "sig", Kid: k.id, Alg: k.method.Alg(),
+				N: enc(pub.N.Bytes()),
+				E: enc(big.NewInt(int64(pub.E)).Bytes()),
+			})
+		case *ecdsa.PublicKey:
+			size := (pub.Curve.Params().BitSize + 7) / 8
+			set.Keys = append(set.Keys, JWK{
+				Kty: "EC", Use: "sig", Kid: k.id, Alg: k.method.Alg(), Crv: pub.Curve.Params().Name,
+				X: enc(pub.X.FillBytes(make([]byte, size))),
+				Y: enc(pub.Y.FillBytes(make([]byte, size))),
+			})
+		}
+	}
+	return set
+}
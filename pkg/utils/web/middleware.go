@@ -1,7 +1,9 @@
 package web
 
 import (
+	"errors"
 	"net/http"
+	"strings"
 
 	"github.com/gin-gonic/gin"
 	"github.com/hex-techs/blade/pkg/utils/token"
@@ -9,29 +11,174 @@ import (
 
 const CurrentUser = "user"
 
+// TokenResolver 解析带有特定前缀的非jwt令牌，返回令牌所属用户的信息
+type TokenResolver func(t string) (*token.Claims, error)
+
+// 令牌前缀与解析函数的对应关系，在启动时注册
+var resolvers = map[string]TokenResolver{}
+
+// RegisterTokenResolver 注册一种前缀令牌的解析函数
+func RegisterTokenResolver(prefix string, r TokenResolver) {
+	resolvers[prefix] = r
+}
+
+// ClaimsValidator 校验jwt中的用户信息是否仍然有效，如token是否已被吊销
+type ClaimsValidator func(claims *token.Claims) error
+
+// jwt校验函数，在启动时注册
+var validators []ClaimsValidator
+
+// RegisterClaimsValidator 注册jwt校验函数
+func RegisterClaimsValidator(v ClaimsValidator) {
+	validators = append(validators, v)
+}
+
+// ResolveToken 根据前缀选择解析方式，没有匹配的前缀时按jwt解析
+func ResolveToken(t string) (*token.Claims, error) {
+	for prefix, r := range resolvers {
+		if strings.HasPrefix(t, prefix) {
+			return r(t)
+		}
+	}
+	claims, err := token.ParseJWTToken(t)
+	if err != nil {
+		return nil, err
+	}
+	// 特定用途的token不能用于访问接口
+	if claims.Purpose != "" {
+		return nil, errors.New("token purpose invalid")
+	}
+	for _, v := range validators {
+		if err := v(claims); err != nil {
+			return nil, err
+		}
+	}
+	return claims, nil
+}
+
+// RequestRecorder 记录模拟登录期间的请求，在请求处理完成后调用
+type RequestRecorder func(c *gin.Context, claims *token.Claims)
+
+// 模拟登录请求的记录函数，在启动时注册
+var recorders []RequestRecorder
+
+// RegisterImpersonationRecorder 注册模拟登录请求的记录函数
+func RegisterImpersonationRecorder(r RequestRecorder) {
+	recorders = append(recorders, r)
+}
+
+// GetCurrentUser 返回生效的用户信息，模拟登录时为被模拟的用户，真实的管理员在 Actor 中
 func GetCurrentUser(c *gin.Context) *token.Claims {
 	return c.MustGet(CurrentUser).(*token.Claims)
 }
 
+// Authenticator 从请求中识别用户，请求中没有该方式的凭据时返回nil，交给下一个认证方式
+type Authenticator func(c *gin.Context) (*token.Claims, error)
+
+// 认证方式，按顺序尝试，第一个识别出用户的生效
+var authenticators = []Authenticator{BearerAuthenticator}
+
+// RegisterAuthenticator 在启动时注册一种认证方式，排在已注册的认证方式之后
+func RegisterAuthenticator(a Authenticator) {
+	authenticators = append(authenticators, a)
+}
+
+// BearerAuthenticator 从Authorization header中解析token，兼容Bearer格式
+func BearerAuthenticator(c *gin.Context) (*token.Claims, error) {
+	t := strings.TrimPrefix(c.Request.Header.Get("Authorization"), "Bearer ")
+	if t == "" {
+		return nil, nil
+	}
+	return ResolveToken(t)
+}
+
 // 登录验证中间件
 func LoginRequired() gin.HandlerFunc {
 	return func(c *gin.Context) {
-		// 从header中获取token
-		t := c.Request.Header.Get("Authorization")
-		if t == "" {
+		var claims *token.Claims
+		for _, a := range authenticators {
+			var err error
+			claims, err = a(c)
+			if err != nil {
+				c.JSON(http.StatusUnauthorized, ExceptResponse(http.StatusUnauthorized, err))
+				c.Abort()
+				return
+			}
+			if claims != nil {
+				break
+			}
+		}
+		if claims == nil {
 			c.JSON(http.StatusUnauthorized, ExceptResponse(http.StatusUnauthorized, "need login"))
 			c.Abort()
 			return
 		}
-		// 解析token
-		claims, err := token.ParseJWTToken(t)
-		if err != nil {
-			c.JSON(http.StatusUnauthorized, ExceptResponse(http.StatusUnauthorized, err))
+		if !claims.Allow(c.Request.Method) {
+			c.JSON(http.StatusForbidden, ExceptResponse(http.StatusForbidden, "token scope not allowed"))
 			c.Abort()
 			return
 		}
 		// 将用户信息保存到上下文中
-		c.Set("user", claims)
+		c.Set(CurrentUser, claims)
+		c.Next()
+		if claims.IsImpersonated() {
+			for _, r := range recorders {
+				r(c, claims)
+			}
+		}
+	}
+}
+
+// Authorizer 判断主体是否可以对资源执行操作
+type Authorizer interface {
+	Authorize(claims *token.Claims, obj, act string) (bool, error)
+}
+
+// 启动时设置，为空时拒绝所有需要鉴权的请求
+var authorizer Authorizer
+
+// SetAuthorizer 设置鉴权方式
+func SetAuthorizer(a Authorizer) {
+	authorizer = a
+}
+
+// Authorize 鉴权中间件，需要放在LoginRequired之后，没有登录信息或者没有设置鉴权方式时拒绝请求
+func Authorize(obj, act string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		v, ok := c.Get(CurrentUser)
+		if !ok {
+			c.JSON(http.StatusUnauthorized, ExceptResponse(http.StatusUnauthorized, "need login"))
+			c.Abort()
+			return
+		}
+		if authorizer == nil {
+			c.JSON(http.StatusForbidden, ExceptResponse(http.StatusForbidden, "no authorizer configured"))
+			c.Abort()
+			return
+		}
+		allowed, err := authorizer.Authorize(v.(*token.Claims), obj, act)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, ExceptResponse(http.StatusInternalServerError, err))
+			c.Abort()
+			return
+		}
+		if !allowed {
+			c.JSON(http.StatusForbidden, ExceptResponse(http.StatusForbidden, "no permission"))
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
+
+// 模拟登录时禁止访问的中间件，用于删除用户等危险操作
+func NoImpersonation() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if GetCurrentUser(c).IsImpersonated() {
+			c.JSON(http.StatusForbidden, ExceptResponse(http.StatusForbidden, "not allowed while impersonating"))
+			c.Abort()
+			return
+		}
 		c.Next()
 	}
 }
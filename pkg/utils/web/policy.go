@@ -0,0 +1,158 @@
+package web
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/hex-techs/blade/pkg/utils/token"
+)
+
+// 字段的写入策略，通过模型字段的 write 标签声明，如 `write:"readonly"`
+const (
+	// WriteReadOnly 只读字段，由服务端维护，不能通过接口写入
+	WriteReadOnly = "readonly"
+	// WriteAdmin 只有管理员可以写入
+	WriteAdmin = "admin"
+	// WriteEndpoint 只能在创建时写入，之后只能通过专门的接口修改，如密码
+	WriteEndpoint = "endpoint"
+)
+
+// Modeler 声明控制器写入的模型，Install 时根据模型字段的 write 标签校验创建和更新请求
+type Modeler interface {
+	Model() interface{}
+}
+
+// FieldPolicy 模型字段的写入策略，key为json字段名
+type FieldPolicy map[string]string
+
+// FieldViolation 违反写入策略的字段
+type FieldViolation struct {
+	// json字段名
+	Field string `json:"field"`
+	// 字段的写入策略
+	Policy string `json:"policy"`
+	// 拒绝的原因
+	Reason string `json:"reason"`
+}
+
+func (v FieldViolation) String() string {
+	return fmt.Sprintf("field %q %s", v.Field, v.Reason)
+}
+
+// NewFieldPolicy 解析模型的 write 标签，包括嵌入的结构体，标签值不合法时panic
+func NewFieldPolicy(model interface{}) FieldPolicy {
+	p := FieldPolicy{}
+	p.parse(reflect.TypeOf(model))
+	return p
+}
+
+func (p FieldPolicy) parse(t reflect.Type) {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t.Kind() != reflect.Struct {
+		return
+	}
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		name := strings.Split(f.Tag.Get("json"), ",")[0]
+		if f.Anonymous && name == "" {
+			p.parse(f.Type)
+			continue
+		}
+		policy, ok := f.Tag.Lookup("write")
+		if !ok || name == "-" {
+			continue
+		}
+		switch policy {
+		case WriteReadOnly, WriteAdmin, WriteEndpoint:
+		default:
+			panic(fmt.Sprintf("invalid write policy %q on %s.%s", policy, t.Name(), f.Name))
+		}
+		if name == "" {
+			name = f.Name
+		}
+		p[name] = policy
+	}
+}
+
+// Check 校验请求体中写入的字段，method为CREATE、UPDATE或PATCH，返回所有违反策略的字段
+func (p FieldPolicy) Check(fields []string, method string, admin bool) []FieldViolation {
+	var violations []FieldViolation
+	for _, f := range fields {
+		policy, ok := p.lookup(f)
+		if !ok {
+			continue
+		}
+		switch {
+		case policy == WriteReadOnly:
+			violations = append(violations, FieldViolation{Field: f, Policy: policy, Reason: "is read-only"})
+		case policy == WriteAdmin && !admin:
+			violations = append(violations, FieldViolation{Field: f, Policy: policy,
+				Reason: "can only be written by administrators"})
+		case policy == WriteEndpoint && method != CREATE:
+			violations = append(violations, FieldViolation{Field: f, Policy: policy,
+				Reason: "can only be changed through its dedicated endpoint"})
+		}
+	}
+	return violations
+}
+
+// lookup 与json绑定一样不区分大小写匹配字段名，避免通过改变大小写绕过策略
+func (p FieldPolicy) lookup(field string) (string, bool) {
+	if policy, ok := p[field]; ok {
+		return policy, true
+	}
+	for name, policy := range p {
+		if strings.EqualFold(name, field) {
+			return policy, true
+		}
+	}
+	return "", false
+}
+
+// WritePolicy 拒绝写入受保护字段的请求，请求体会被保留，后续的handler可以正常绑定
+func WritePolicy(p FieldPolicy, method string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		body, err := io.ReadAll(c.Request.Body)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, ExceptResponse(http.StatusBadRequest, err))
+			c.Abort()
+			return
+		}
+		c.Request.Body = io.NopCloser(bytes.NewReader(body))
+		c.Set(gin.BodyBytesKey, body)
+		// 不是json对象时交给handler的绑定报错
+		var raw map[string]json.RawMessage
+		if err := json.Unmarshal(body, &raw); err != nil {
+			c.Next()
+			return
+		}
+		fields := make([]string, 0, len(raw))
+		for k := range raw {
+			fields = append(fields, k)
+		}
+		sort.Strings(fields)
+		var admin bool
+		if v, ok := c.Get(CurrentUser); ok {
+			admin = v.(*token.Claims).Admin
+		}
+		if violations := p.Check(fields, method, admin); len(violations) > 0 {
+			msgs := make([]string, 0, len(violations))
+			for _, v := range violations {
+				msgs = append(msgs, v.String())
+			}
+			c.JSON(http.StatusForbidden, ExceptDataResponse(http.StatusForbidden, violations, strings.Join(msgs, "; ")))
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
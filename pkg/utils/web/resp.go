@@ -31,6 +31,17 @@ func ExceptResponse(code int, msg ...interface{}) *Response {
 	}
 }
 
+// ExceptDataResponse 携带详细信息的异常响应，如逐条列出校验失败的规则
+func ExceptDataResponse(code int, data interface{}, msg ...interface{}) *Response {
+	return &Response{
+		State: State{
+			Code: code,
+			Msg:  fmt.Sprint(msg...),
+		},
+		Data: data,
+	}
+}
+
 // DataResponse 单一数据响应
 func DataResponse(data interface{}) *Response {
 	return &Response{
@@ -3,6 +3,7 @@ package web
 import (
 	"errors"
 	"fmt"
+	"strings"
 
 	"github.com/gin-gonic/gin"
 )
@@ -65,67 +66,63 @@ func (r *RestfulAPI) Install(e *gin.Engine, rc RestController) {
 	r.handleParameter(rc)
 	hmm := r.handleMiddlewares(rc)
 	if post, err := rc.Create(); err == nil {
-		if ms, ok := hmm[CREATE]; ok {
-			ms = append(ms, post)
-			versionAPIGroup.POST(r.path, ms...)
-		} else {
-			versionAPIGroup.POST(r.path, post)
-		}
+		versionAPIGroup.POST(r.path, append(hmm[CREATE], post)...)
 	}
 	if del, err := rc.Delete(); err == nil {
-		if ms, ok := hmm[DELETE]; ok {
-			ms = append(ms, del)
-			versionAPIGroup.DELETE(r.longpath, ms...)
-		} else {
-			versionAPIGroup.DELETE(r.longpath, del)
-		}
+		versionAPIGroup.DELETE(r.longpath, append(hmm[DELETE], del)...)
 	}
 	if put, err := rc.Update(); err == nil {
-		if ms, ok := hmm[UPDATE]; ok {
-			ms = append(ms, put)
-			versionAPIGroup.PUT(r.longpath, ms...)
-		} else {
-			versionAPIGroup.PUT(r.longpath, put)
-		}
+		versionAPIGroup.PUT(r.longpath, append(hmm[UPDATE], put)...)
 	}
 	if patch, err := rc.Patch(); err == nil {
-		if ms, ok := hmm[PATCH]; ok {
-			ms = append(ms, patch)
-			versionAPIGroup.PATCH(r.longpath, ms...)
-		} else {
-			versionAPIGroup.PATCH(r.longpath, patch)
-		}
+		versionAPIGroup.PATCH(r.longpath, append(hmm[PATCH], patch)...)
 	}
 	if get, err := rc.Get(); err == nil {
-		if ms, ok := hmm[GET]; ok {
-			ms = append(ms, get)
-			versionAPIGroup.GET(r.longpath, ms...)
-		} else {
-			versionAPIGroup.GET(r.longpath, get)
-		}
+		versionAPIGroup.GET(r.longpath, append(hmm[GET], get)...)
 	}
 	if list, err := rc.List(); err == nil {
-		if ms, ok := hmm[LIST]; ok {
-			ms = append(ms, list)
-			versionAPIGroup.GET(r.path, ms...)
-		} else {
-			versionAPIGroup.GET(r.path, list)
-		}
+		versionAPIGroup.GET(r.path, append(hmm[LIST], list)...)
 	}
 }
 
+// handleMiddlewares 每个方法的中间件，没有声明中间件的方法默认需要登录，
+// 所有方法都在登录之后自动追加鉴权中间件，声明了模型的控制器在鉴权之后校验写入的字段
 func (r *RestfulAPI) handleMiddlewares(rc RestController) map[string][]gin.HandlerFunc {
-	hmr := rc.Middlewares()
-	if hmr != nil {
-		mmap := map[string][]gin.HandlerFunc{}
-		for _, hm := range hmr {
-			for _, method := range hm.Methods {
-				mmap[method] = hm.Middlewares
-			}
+	mmap := map[string][]gin.HandlerFunc{}
+	for _, hm := range rc.Middlewares() {
+		for _, method := range hm.Methods {
+			mmap[method] = append(mmap[method], hm.Middlewares...)
 		}
-		return mmap
 	}
-	return nil
+	var policy FieldPolicy
+	if m, ok := rc.(Modeler); ok {
+		policy = NewFieldPolicy(m.Model())
+	}
+	obj := r.object(rc)
+	for _, method := range []string{CREATE, DELETE, UPDATE, PATCH, GET, LIST} {
+		// 复制一份，避免多个方法共用同一个切片
+		ms := make([]gin.HandlerFunc, 0, len(mmap[method])+3)
+		if len(mmap[method]) == 0 {
+			ms = append(ms, LoginRequired())
+		}
+		ms = append(ms, mmap[method]...)
+		// 资源为控制器名称，操作为方法
+		ms = append(ms, Authorize(obj, method))
+		if policy != nil && (method == CREATE || method == UPDATE || method == PATCH) {
+			ms = append(ms, WritePolicy(policy, method))
+		}
+		mmap[method] = ms
+	}
+	return mmap
+}
+
+// object 鉴权使用的资源名称，嵌套资源带上父资源，如 user/token
+func (r *RestfulAPI) object(rc RestController) string {
+	if r.PreParameter == "" {
+		return rc.Name()
+	}
+	parent := strings.SplitN(strings.Trim(r.PreParameter, "/"), "/", 2)[0]
+	return parent + "/" + rc.Name()
 }
 
 func (r *RestfulAPI) handleParameter(rc RestController) {
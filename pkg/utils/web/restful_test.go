@@ -0,0 +1,116 @@
+package web
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/hex-techs/blade/pkg/utils/token"
+)
+
+// testUserHeader 测试中识别用户的header
+const testUserHeader = "X-Test-User"
+
+func init() {
+	RegisterAuthenticator(func(c *gin.Context) (*token.Claims, error) {
+		if name := c.GetHeader(testUserHeader); name != "" {
+			return &token.Claims{Name: name}, nil
+		}
+		return nil, nil
+	})
+}
+
+// thingController 只为list声明了中间件，get使用默认的中间件
+type thingController struct {
+	DefaultController
+}
+
+func (*thingController) Name() string {
+	return "thing"
+}
+
+func (*thingController) Get() (gin.HandlerFunc, error) {
+	return func(c *gin.Context) { c.Status(http.StatusOK) }, nil
+}
+
+func (*thingController) List() (gin.HandlerFunc, error) {
+	return func(c *gin.Context) { c.Status(http.StatusOK) }, nil
+}
+
+func (*thingController) Middlewares() []MiddlewaresObject {
+	return []MiddlewaresObject{
+		{
+			Methods:     []string{LIST},
+			Middlewares: []gin.HandlerFunc{LoginRequired()},
+		},
+	}
+}
+
+// recordAuthorizer 记录鉴权的资源和操作，只允许allow中的用户
+type recordAuthorizer struct {
+	allow string
+	obj   string
+	act   string
+}
+
+func (a *recordAuthorizer) Authorize(claims *token.Claims, obj, act string) (bool, error) {
+	a.obj, a.act = obj, act
+	return claims.Name == a.allow, nil
+}
+
+func serve(r *gin.Engine, path, user string) int {
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, path, nil)
+	if user != "" {
+		req.Header.Set(testUserHeader, user)
+	}
+	r.ServeHTTP(w, req)
+	return w.Code
+}
+
+func TestInstallAuthorizesEveryMethod(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	api := RestfulAPI{PreParameter: "user/:id", PostParameter: "/:tid"}
+	api.Install(r, &thingController{})
+	defer SetAuthorizer(nil)
+
+	// 没有声明中间件的方法也需要登录
+	if code := serve(r, "/api/v1/user/1/thing/2", ""); code != http.StatusUnauthorized {
+		t.Fatalf("anonymous get: code %d, want %d", code, http.StatusUnauthorized)
+	}
+	// 没有设置鉴权方式时拒绝
+	SetAuthorizer(nil)
+	for _, path := range []string{"/api/v1/user/1/thing/2", "/api/v1/user/1/thing"} {
+		if code := serve(r, path, "alice"); code != http.StatusForbidden {
+			t.Fatalf("%s without authorizer: code %d, want %d", path, code, http.StatusForbidden)
+		}
+	}
+
+	a := &recordAuthorizer{allow: "alice"}
+	SetAuthorizer(a)
+	for path, act := range map[string]string{"/api/v1/user/1/thing/2": GET, "/api/v1/user/1/thing": LIST} {
+		if code := serve(r, path, "alice"); code != http.StatusOK {
+			t.Fatalf("%s by alice: code %d, want %d", path, code, http.StatusOK)
+		}
+		if a.obj != "user/thing" || a.act != act {
+			t.Fatalf("%s authorized as %s %s, want user/thing %s", path, a.obj, a.act, act)
+		}
+		if code := serve(r, path, "bob"); code != http.StatusForbidden {
+			t.Fatalf("%s by bob: code %d, want %d", path, code, http.StatusForbidden)
+		}
+	}
+}
+
+func TestAuthorizeWithoutUser(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	SetAuthorizer(&recordAuthorizer{allow: "alice"})
+	defer SetAuthorizer(nil)
+	// 没有经过LoginRequired的路由同样拒绝
+	r.GET("/thing", Authorize("thing", GET), func(c *gin.Context) { c.Status(http.StatusOK) })
+	if code := serve(r, "/thing", "alice"); code != http.StatusUnauthorized {
+		t.Fatalf("code %d, want %d", code, http.StatusUnauthorized)
+	}
+}
@@ -0,0 +1,301 @@
+package view
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/hex-techs/blade/pkg/models"
+	"github.com/hex-techs/blade/pkg/utils/storage"
+	"github.com/hex-techs/blade/pkg/utils/token"
+)
+
+// Grant 模块上生效的角色绑定，包括从上级模块继承的
+type Grant struct {
+	// 角色绑定id
+	ID uint `json:"id"`
+	// 用户id，绑定用户组或服务账号时为0
+	UserID uint `json:"userID"`
+	// 用户名
+	UserName string `json:"userName,omitempty"`
+	// 用户组id，绑定用户或服务账号时为0
+	GroupID uint `json:"groupID"`
+	// 用户组名
+	GroupName string `json:"groupName,omitempty"`
+	// 服务账号id，绑定用户或用户组时为0
+	ServiceAccountID uint `json:"serviceAccountID"`
+	// 服务账号名称
+	ServiceAccountName string `json:"serviceAccountName,omitempty"`
+	// 角色
+	Role string `json:"role"`
+	// 角色绑定所在的模块id
+	ModuleID uint `json:"moduleID"`
+	// 角色绑定所在的模块全称
+	ModuleName string `json:"moduleName"`
+	// 只在该项目上生效的角色绑定，为0时在整个模块上生效
+	ProjectID uint `json:"projectID,omitempty"`
+	// 是否从上级模块继承
+	Inherited bool `json:"inherited"`
+	// 临时角色的过期时间
+	ExpiresAt *time.Time `json:"expiresAt,omitempty"`
+}
+
+// 模块上的角色绑定变化时的回调，参数为模块id，下级模块及其项目也受影响
+var grantListeners []func(moduleID uint)
+
+// RegisterGrantListener 注册模块角色绑定变化的回调
+func RegisterGrantListener(f func(moduleID uint)) {
+	grantListeners = append(grantListeners, f)
+}
+
+// NotifyGrantChanged 通知模块上的角色绑定发生了变化
+func NotifyGrantChanged(moduleID uint) {
+	for _, f := range grantListeners {
+		f(moduleID)
+	}
+}
+
+// ModuleChain 返回模块及其所有上级模块，从自身开始
+func ModuleChain(s *storage.Engine, id uint) ([]models.Module, error) {
+	var chain []models.Module
+	for id != 0 {
+		// 模块最多5级，超过说明parent_id形成了环
+		if len(chain) > 5 {
+			return nil, fmt.Errorf("module %d parent loop", chain[0].ID)
+		}
+		var m models.Module
+		if err := s.Get(context.TODO(), id, "", &m); err != nil {
+			return nil, err
+		}
+		chain = append(chain, m)
+		id = m.ParentID
+	}
+	return chain, nil
+}
+
+// ModuleDescendants 返回模块及其所有下级模块的id
+func ModuleDescendants(s *storage.Engine, ids []uint) ([]uint, error) {
+	result := append([]uint{}, ids...)
+	// 模块最多5级
+	for level := 0; level < 5 && len(ids) > 0; level++ {
+		var children []models.Module
+		if err := s.FindWhere(context.TODO(), &children, "parent_id IN ?", ids); err != nil {
+			return nil, err
+		}
+		var next []uint
+		for _, m := range children {
+			next = append(next, m.ID)
+		}
+		result = append(result, next...)
+		ids = next
+	}
+	return result, nil
+}
+
+// subject 角色绑定主体的查询条件，query为空时返回所有主体的角色绑定
+type subject struct {
+	query string
+	args  []interface{}
+}
+
+// userSubject 用户直接或通过用户组获得的角色绑定，userID为0时不过滤
+func userSubject(userID uint) subject {
+	if userID == 0 {
+		return subject{}
+	}
+	return subject{
+		query: "(user_id = ? OR group_id IN (SELECT group_id FROM group_members WHERE user_id = ? AND deleted_at IS NULL))",
+		args:  []interface{}{userID, userID},
+	}
+}
+
+// claimsSubject token对应主体的角色绑定，服务账号按名称查找
+func claimsSubject(s *storage.Engine, u *token.Claims) (subject, error) {
+	if !u.IsServiceAccount() {
+		if u.ID == 0 {
+			return subject{}, errors.New("token user invalid")
+		}
+		return userSubject(u.ID), nil
+	}
+	var sa models.ServiceAccount
+	if err := s.Get(context.TODO(), 0, strings.TrimPrefix(u.Name, token.ServiceAccountName("")), &sa); err != nil {
+		return subject{}, err
+	}
+	return subject{query: "service_account_id = ?", args: []interface{}{sa.ID}}, nil
+}
+
+// ModuleGrants 返回模块上生效的角色绑定，userID不为0时只返回该用户直接或通过用户组获得的
+func ModuleGrants(s *storage.Engine, moduleID, userID uint) ([]Grant, error) {
+	return grants(s, moduleID, 0, userSubject(userID))
+}
+
+// ProjectGrants 返回项目上生效的角色绑定，包括所属模块的和只在该项目上生效的
+func ProjectGrants(s *storage.Engine, projectID, userID uint) ([]Grant, error) {
+	moduleID, err := ProjectModule(s, projectID)
+	if err != nil {
+		return nil, err
+	}
+	return grants(s, moduleID, projectID, userSubject(userID))
+}
+
+// grants 返回模块上生效的角色绑定，projectID不为0时包括只在该项目上生效的，已过期的临时角色不生效
+func grants(s *storage.Engine, moduleID, projectID uint, sub subject) ([]Grant, error) {
+	chain, err := ModuleChain(s, moduleID)
+	if err != nil {
+		return nil, err
+	}
+	names := map[uint]string{}
+	var ids []uint
+	for _, m := range chain {
+		names[m.ID] = m.FullName
+		ids = append(ids, m.ID)
+	}
+	var members []models.ModuleMember
+	condition := "module_id IN ? AND (project_id = 0 OR project_id = ?) AND (expires_at IS NULL OR expires_at > ?)"
+	args := []interface{}{ids, projectID, time.Now()}
+	if sub.query != "" {
+		condition += " AND " + sub.query
+		args = append(args, sub.args...)
+	}
+	if err := s.FindWhere(context.TODO(), &members, condition, args...); err != nil {
+		return nil, err
+	}
+	users := map[uint]string{}
+	groups := map[uint]string{}
+	sas := map[uint]string{}
+	grants := make([]Grant, 0, len(members))
+	for _, m := range members {
+		if _, ok := users[m.UserID]; !ok && m.UserID != 0 {
+			var u models.User
+			if err := s.Get(context.TODO(), m.UserID, "", &u); err == nil {
+				users[m.UserID] = u.Name
+			}
+		}
+		if _, ok := groups[m.GroupID]; !ok && m.GroupID != 0 {
+			var g models.Group
+			if err := s.Get(context.TODO(), m.GroupID, "", &g); err == nil {
+				groups[m.GroupID] = g.Name
+			}
+		}
+		if _, ok := sas[m.ServiceAccountID]; !ok && m.ServiceAccountID != 0 {
+			var sa models.ServiceAccount
+			if err := s.Get(context.TODO(), m.ServiceAccountID, "", &sa); err == nil {
+				sas[m.ServiceAccountID] = sa.Name
+			}
+		}
+		grants = append(grants, Grant{
+			ID:                 m.ID,
+			UserID:             m.UserID,
+			UserName:           users[m.UserID],
+			GroupID:            m.GroupID,
+			GroupName:          groups[m.GroupID],
+			ServiceAccountID:   m.ServiceAccountID,
+			ServiceAccountName: sas[m.ServiceAccountID],
+			Role:               m.Role,
+			ModuleID:           m.ModuleID,
+			ModuleName:         names[m.ModuleID],
+			ProjectID:          m.ProjectID,
+			Inherited:          m.ModuleID != moduleID,
+			ExpiresAt:          m.ExpiresAt,
+		})
+	}
+	return grants, nil
+}
+
+// HighestRole 返回角色绑定中最高的角色，没有角色绑定时为空
+func HighestRole(grants []Grant) string {
+	var role string
+	for _, g := range grants {
+		if models.RoleRank(g.Role) > models.RoleRank(role) {
+			role = g.Role
+		}
+	}
+	return role
+}
+
+// ModuleAllowed 管理员，或者在模块上的有效角色不低于min时返回true，服务账号按其角色绑定判断
+func ModuleAllowed(s *storage.Engine, u *token.Claims, moduleID uint, min string) bool {
+	if u.Admin {
+		return true
+	}
+	sub, err := claimsSubject(s, u)
+	if err != nil {
+		return false
+	}
+	grants, err := grants(s, moduleID, 0, sub)
+	if err != nil {
+		return false
+	}
+	return models.RoleRank(HighestRole(grants)) >= models.RoleRank(min)
+}
+
+// ProjectAllowed 管理员，或者在项目上的有效角色不低于min时返回true，项目负责人在项目上至少是maintainer
+func ProjectAllowed(s *storage.Engine, u *token.Claims, projectID uint, min string) bool {
+	if u.Admin {
+		return true
+	}
+	sub, err := claimsSubject(s, u)
+	if err != nil {
+		return false
+	}
+	moduleID, err := ProjectModule(s, projectID)
+	if err != nil {
+		return false
+	}
+	grants, err := grants(s, moduleID, projectID, sub)
+	if err != nil {
+		return false
+	}
+	role := HighestRole(grants)
+	if models.RoleRank(role) < models.RoleRank(models.RoleMaintainer) && !u.IsServiceAccount() &&
+		ProjectOwner(s, u, projectID) {
+		role = models.RoleMaintainer
+	}
+	return models.RoleRank(role) >= models.RoleRank(min)
+}
+
+// ProjectOwner 用户本身或其所在的用户组是否是项目的负责人
+func ProjectOwner(s *storage.Engine, u *token.Claims, projectID uint) bool {
+	var p models.Project
+	if err := s.Get(context.TODO(), projectID, "", &p); err != nil {
+		return false
+	}
+	groups, err := UserGroupNames(s, u.ID)
+	if err != nil {
+		return false
+	}
+	return p.HasOwner(u.Name, groups)
+}
+
+// ServiceAccountManageable 管理员，或者在服务账号所属模块或项目上的有效角色为owner、maintainer时可以管理服务账号
+func ServiceAccountManageable(s *storage.Engine, u *token.Claims, sa *models.ServiceAccount) bool {
+	if u.Admin {
+		return true
+	}
+	if u.IsServiceAccount() {
+		return false
+	}
+	if sa.ProjectID != 0 {
+		return ProjectAllowed(s, u, sa.ProjectID, models.RoleMaintainer)
+	}
+	return ModuleAllowed(s, u, sa.ModuleID, models.RoleMaintainer)
+}
+
+// ServiceAccountModule 返回服务账号所属的模块id，属于项目的服务账号返回项目所属的模块
+func ServiceAccountModule(s *storage.Engine, sa *models.ServiceAccount) (uint, error) {
+	if sa.ProjectID != 0 {
+		return ProjectModule(s, sa.ProjectID)
+	}
+	return sa.ModuleID, nil
+}
+
+// ProjectModule 返回项目所属的模块id，项目继承模块上的角色绑定
+func ProjectModule(s *storage.Engine, projectID uint) (uint, error) {
+	var p models.Project
+	if err := s.Get(context.TODO(), projectID, "", &p); err != nil {
+		return 0, err
+	}
+	return p.ModuleID, nil
+}
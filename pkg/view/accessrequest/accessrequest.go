@@ -0,0 +1,395 @@
+package accessrequest
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/fize/go-ext/log"
+	"github.com/gin-gonic/gin"
+	"github.com/hex-techs/blade/pkg/models"
+	"github.com/hex-techs/blade/pkg/utils/config"
+	"github.com/hex-techs/blade/pkg/utils/storage"
+	"github.com/hex-techs/blade/pkg/utils/token"
+	"github.com/hex-techs/blade/pkg/utils/web"
+	"github.com/hex-techs/blade/pkg/view"
+)
+
+// 审计日志中的资源类型
+const auditResource = "accessrequest"
+
+// AccessRequestController 临时权限申请控制器，模块的owner审批，批准后创建带有过期时间的角色绑定
+type AccessRequestController struct {
+	web.DefaultController
+	Store *storage.Engine
+}
+
+// NewAccessRequestController return a new access request controller
+func NewAccessRequestController(s *storage.Engine) *AccessRequestController {
+	return &AccessRequestController{
+		Store: s,
+	}
+}
+
+// 资源名
+func (*AccessRequestController) Name() string {
+	return "accessrequest"
+}
+
+// 写入的模型，按字段的write标签校验创建和更新请求
+func (*AccessRequestController) Model() interface{} {
+	return &models.AccessRequest{}
+}
+
+// Create 申请在模块或项目上临时拥有某个角色
+func (ac *AccessRequestController) Create() (gin.HandlerFunc, error) {
+	return func(c *gin.Context) {
+		u := web.GetCurrentUser(c)
+		if u.IsServiceAccount() {
+			c.JSON(http.StatusOK, web.ExceptResponse(errorMap[ErrByServiceAccount], ErrByServiceAccount))
+			return
+		}
+		var f RequestForm
+		if err := c.ShouldBindJSON(&f); err != nil {
+			c.JSON(http.StatusBadRequest, web.ExceptResponse(errorMap[ErrInvalidParam], err))
+			return
+		}
+		if (f.ModuleID == 0) == (f.ProjectID == 0) {
+			c.JSON(http.StatusBadRequest, web.ExceptResponse(errorMap[ErrInvalidParam], "exactly one of moduleID and projectID is required"))
+			return
+		}
+		if max := config.Read().Authz.MaxGrantDuration; f.Duration > max {
+			c.JSON(http.StatusOK, web.ExceptResponse(errorMap[ErrDurationTooLong], fmt.Sprintf("%s: %ds", ErrDurationTooLong, max)))
+			return
+		}
+		var (
+			grants []view.Grant
+			err    error
+		)
+		if f.ProjectID != 0 {
+			f.ModuleID, err = view.ProjectModule(ac.Store, f.ProjectID)
+			if err == nil {
+				grants, err = view.ProjectGrants(ac.Store, f.ProjectID, u.ID)
+			}
+		} else {
+			grants, err = view.ModuleGrants(ac.Store, f.ModuleID, u.ID)
+		}
+		if err != nil {
+			c.JSON(http.StatusOK, web.ExceptResponse(errorMap[ErrTargetNotFound], err))
+			return
+		}
+		if models.RoleRank(view.HighestRole(grants)) >= models.RoleRank(f.Role) {
+			c.JSON(http.StatusOK, web.ExceptResponse(errorMap[ErrAlreadyGranted], ErrAlreadyGranted))
+			return
+		}
+		r := models.AccessRequest{
+			UserID:        u.ID,
+			UserName:      u.Name,
+			ModuleID:      f.ModuleID,
+			ProjectID:     f.ProjectID,
+			Role:          f.Role,
+			Duration:      f.Duration,
+			Justification: f.Justification,
+			Status:        models.AccessPending,
+		}
+		log.Infow("create access request", "user", u.Name, "module", r.ModuleID, "project", r.ProjectID,
+			"role", r.Role, "duration", r.Duration)
+		if err := ac.Store.Create(context.TODO(), &r); err != nil {
+			c.JSON(http.StatusOK, web.ExceptResponse(errorMap[ErrCreateRequestFailed], err))
+			return
+		}
+		ac.audit(c, models.AuditAccessRequest, &r, r.Justification)
+		c.JSON(http.StatusOK, web.DataResponse(r))
+	}, nil
+}
+
+// Delete 申请人撤回等待审批的申请
+func (ac *AccessRequestController) Delete() (gin.HandlerFunc, error) {
+	return func(c *gin.Context) {
+		r, ok := ac.request(c)
+		if !ok {
+			return
+		}
+		if r.UserID != web.GetCurrentUser(c).ID {
+			c.JSON(http.StatusOK, web.ExceptResponse(errorMap[ErrNoPermission], ErrNoPermission))
+			return
+		}
+		ok, err := ac.Store.CompareAndUpdate(context.TODO(), r.ID, "status", models.AccessPending, &models.AccessRequest{},
+			map[string]interface{}{"status": models.AccessCancelled})
+		if err != nil {
+			c.JSON(http.StatusOK, web.ExceptResponse(errorMap[ErrReviewFailed], err))
+			return
+		}
+		if !ok {
+			c.JSON(http.StatusOK, web.ExceptResponse(errorMap[ErrRequestNotPending], ErrRequestNotPending))
+			return
+		}
+		ac.audit(c, models.AuditAccessCancel, r, "")
+		c.JSON(http.StatusOK, web.OkResponse())
+	}, nil
+}
+
+// Get 获取申请详情和每一步的记录，申请人、审批人和管理员可以查看
+func (ac *AccessRequestController) Get() (gin.HandlerFunc, error) {
+	return func(c *gin.Context) {
+		r, ok := ac.request(c)
+		if !ok {
+			return
+		}
+		u := web.GetCurrentUser(c)
+		if r.UserID != u.ID && !u.Admin && !canReview(ac.Store, u, r) {
+			c.JSON(http.StatusOK, web.ExceptResponse(errorMap[ErrNoPermission], ErrNoPermission))
+			return
+		}
+		detail := RequestDetail{AccessRequest: *r}
+		if err := ac.Store.FindWhere(context.TODO(), &detail.History, "resource = ? AND resource_id = ?",
+			auditResource, r.ID); err != nil {
+			c.JSON(http.StatusOK, web.ExceptResponse(errorMap[ErrGetRequestFailed], err))
+			return
+		}
+		c.JSON(http.StatusOK, web.DataResponse(detail))
+	}, nil
+}
+
+// List 获取自己的申请，或者自己可以审批的申请
+func (ac *AccessRequestController) List() (gin.HandlerFunc, error) {
+	return func(c *gin.Context) {
+		var req web.Request
+		var q RequestQuery
+		if err := c.ShouldBindQuery(&req); err != nil {
+			c.JSON(http.StatusBadRequest, web.ExceptResponse(errorMap[ErrInvalidParam], err))
+			return
+		}
+		if err := c.ShouldBindQuery(&q); err != nil {
+			c.JSON(http.StatusBadRequest, web.ExceptResponse(errorMap[ErrInvalidParam], err))
+			return
+		}
+		req.Default()
+		u := web.GetCurrentUser(c)
+		if !q.Review {
+			condition := fmt.Sprintf("user_id = %d", u.ID)
+			if q.Status != "" {
+				condition += fmt.Sprintf(" AND status = '%s'", q.Status)
+			}
+			var requests []models.AccessRequest
+			total, err := ac.Store.List(context.TODO(), req.Limit, req.Page, condition, &requests)
+			if err != nil {
+				c.JSON(http.StatusOK, web.ExceptResponse(errorMap[ErrGetRequestListFailed], err))
+				return
+			}
+			c.JSON(http.StatusOK, web.ListResponse(int(total), requests))
+			return
+		}
+		// 审批人由模块上的角色决定，只能逐个判断，默认只返回等待审批的
+		if q.Status == "" {
+			q.Status = models.AccessPending
+		}
+		var requests []models.AccessRequest
+		if err := ac.Store.FindWhere(context.TODO(), &requests, "status = ?", q.Status); err != nil {
+			c.JSON(http.StatusOK, web.ExceptResponse(errorMap[ErrGetRequestListFailed], err))
+			return
+		}
+		result := []models.AccessRequest{}
+		for i := range requests {
+			if canReview(ac.Store, u, &requests[i]) {
+				result = append(result, requests[i])
+			}
+		}
+		c.JSON(http.StatusOK, web.ListResponse(len(result), result))
+	}, nil
+}
+
+func (ac *AccessRequestController) Middlewares() []web.MiddlewaresObject {
+	return []web.MiddlewaresObject{
+		{
+			Methods:     []string{web.CREATE, web.DELETE, web.GET, web.LIST},
+			Middlewares: []gin.HandlerFunc{web.LoginRequired()},
+		},
+	}
+}
+
+// Approve 批准申请，在模块或项目上创建带有过期时间的角色绑定，过期时间从批准时开始计算
+func (ac *AccessRequestController) Approve(c *gin.Context) {
+	r, f, ok := ac.review(c)
+	if !ok {
+		return
+	}
+	u := web.GetCurrentUser(c)
+	now := time.Now()
+	expires := now.Add(time.Duration(r.Duration) * time.Second)
+	ok, err := ac.Store.CompareAndUpdate(context.TODO(), r.ID, "status", models.AccessPending, &models.AccessRequest{},
+		map[string]interface{}{
+			"status":         models.AccessApproved,
+			"reviewer_id":    u.ID,
+			"reviewer_name":  u.Name,
+			"review_comment": f.Comment,
+			"reviewed_at":    now,
+			"expires_at":     expires,
+		})
+	if err != nil {
+		c.JSON(http.StatusOK, web.ExceptResponse(errorMap[ErrReviewFailed], err))
+		return
+	}
+	if !ok {
+		c.JSON(http.StatusOK, web.ExceptResponse(errorMap[ErrRequestNotPending], ErrRequestNotPending))
+		return
+	}
+	m := models.ModuleMember{
+		ModuleID:  r.ModuleID,
+		ProjectID: r.ProjectID,
+		UserID:    r.UserID,
+		RequestID: r.ID,
+		Role:      r.Role,
+		ExpiresAt: &expires,
+	}
+	log.Infow("approve access request", "request", r.ID, "user", r.UserName, "role", r.Role, "expires", expires,
+		"operator", u.Name)
+	if err := ac.Store.Create(context.TODO(), &m); err != nil {
+		// 恢复为等待审批，可以再次审批
+		if err := ac.Store.Update(context.TODO(), r.ID, "", &models.AccessRequest{},
+			map[string]interface{}{"status": models.AccessPending}); err != nil {
+			log.Errorw("restore access request error", "request", r.ID, "error", err)
+		}
+		c.JSON(http.StatusOK, web.ExceptResponse(errorMap[ErrReviewFailed], err))
+		return
+	}
+	ac.audit(c, models.AuditAccessApprove, r, f.Comment)
+	view.NotifyGrantChanged(r.ModuleID)
+	c.JSON(http.StatusOK, web.OkResponse())
+}
+
+// Deny 拒绝申请
+func (ac *AccessRequestController) Deny(c *gin.Context) {
+	r, f, ok := ac.review(c)
+	if !ok {
+		return
+	}
+	u := web.GetCurrentUser(c)
+	ok, err := ac.Store.CompareAndUpdate(context.TODO(), r.ID, "status", models.AccessPending, &models.AccessRequest{},
+		map[string]interface{}{
+			"status":         models.AccessDenied,
+			"reviewer_id":    u.ID,
+			"reviewer_name":  u.Name,
+			"review_comment": f.Comment,
+			"reviewed_at":    time.Now(),
+		})
+	if err != nil {
+		c.JSON(http.StatusOK, web.ExceptResponse(errorMap[ErrReviewFailed], err))
+		return
+	}
+	if !ok {
+		c.JSON(http.StatusOK, web.ExceptResponse(errorMap[ErrRequestNotPending], ErrRequestNotPending))
+		return
+	}
+	ac.audit(c, models.AuditAccessDeny, r, f.Comment)
+	c.JSON(http.StatusOK, web.OkResponse())
+}
+
+// Revoke 在到期前收回临时权限，审批人、管理员或申请人自己可以操作
+func (ac *AccessRequestController) Revoke(c *gin.Context) {
+	r, ok := ac.request(c)
+	if !ok {
+		return
+	}
+	var f ReviewForm
+	if err := c.ShouldBindJSON(&f); err != nil {
+		c.JSON(http.StatusBadRequest, web.ExceptResponse(errorMap[ErrInvalidParam], err))
+		return
+	}
+	u := web.GetCurrentUser(c)
+	if r.UserID != u.ID && !canReview(ac.Store, u, r) {
+		c.JSON(http.StatusOK, web.ExceptResponse(errorMap[ErrNoPermission], ErrNoPermission))
+		return
+	}
+	ok, err := ac.Store.CompareAndUpdate(context.TODO(), r.ID, "status", models.AccessApproved, &models.AccessRequest{},
+		map[string]interface{}{"status": models.AccessRevoked})
+	if err != nil {
+		c.JSON(http.StatusOK, web.ExceptResponse(errorMap[ErrRevokeFailed], err))
+		return
+	}
+	if !ok {
+		c.JSON(http.StatusOK, web.ExceptResponse(errorMap[ErrRequestNotApproved], ErrRequestNotApproved))
+		return
+	}
+	log.Infow("revoke access", "request", r.ID, "user", r.UserName, "role", r.Role, "operator", u.Name)
+	if err := ac.Store.DeleteWhere(context.TODO(), &models.ModuleMember{}, "request_id = ?", r.ID); err != nil {
+		c.JSON(http.StatusOK, web.ExceptResponse(errorMap[ErrRevokeFailed], err))
+		return
+	}
+	ac.audit(c, models.AuditAccessRevoke, r, f.Comment)
+	view.NotifyGrantChanged(r.ModuleID)
+	c.JSON(http.StatusOK, web.OkResponse())
+}
+
+// request 获取路径中的申请
+func (ac *AccessRequestController) request(c *gin.Context) (*models.AccessRequest, bool) {
+	id, err := view.GetID(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, web.ExceptResponse(errorMap[ErrID], err))
+		return nil, false
+	}
+	var r models.AccessRequest
+	if err := ac.Store.Get(context.TODO(), id, "", &r); err != nil {
+		c.JSON(http.StatusOK, web.ExceptResponse(errorMap[ErrGetRequestFailed], err))
+		return nil, false
+	}
+	return &r, true
+}
+
+// review 获取路径中的申请，并校验当前用户可以审批
+func (ac *AccessRequestController) review(c *gin.Context) (*models.AccessRequest, *ReviewForm, bool) {
+	r, ok := ac.request(c)
+	if !ok {
+		return nil, nil, false
+	}
+	var f ReviewForm
+	if err := c.ShouldBindJSON(&f); err != nil {
+		c.JSON(http.StatusBadRequest, web.ExceptResponse(errorMap[ErrInvalidParam], err))
+		return nil, nil, false
+	}
+	u := web.GetCurrentUser(c)
+	if r.UserID == u.ID {
+		c.JSON(http.StatusOK, web.ExceptResponse(errorMap[ErrReviewOwn], ErrReviewOwn))
+		return nil, nil, false
+	}
+	if !canReview(ac.Store, u, r) {
+		c.JSON(http.StatusOK, web.ExceptResponse(errorMap[ErrNoPermission], ErrNoPermission))
+		return nil, nil, false
+	}
+	return r, &f, true
+}
+
+// audit 记录申请的一步操作，写入失败不影响操作本身
+func (ac *AccessRequestController) audit(c *gin.Context, action string, r *models.AccessRequest, detail string) {
+	u := web.GetCurrentUser(c)
+	record(ac.Store, &models.AuditLog{
+		Action:    action,
+		ActorID:   u.ID,
+		ActorName: u.Name,
+		Method:    c.Request.Method,
+		Path:      c.Request.URL.Path,
+		Status:    http.StatusOK,
+		IP:        c.ClientIP(),
+		Detail:    detail,
+	}, r)
+}
+
+// record 写入申请的审计日志，生效的用户为申请人
+func record(s *storage.Engine, audit *models.AuditLog, r *models.AccessRequest) {
+	audit.UserID = r.UserID
+	audit.UserName = r.UserName
+	audit.Resource = auditResource
+	audit.ResourceID = r.ID
+	if err := s.Create(context.TODO(), audit); err != nil {
+		log.Errorw("record access request audit log error", "request", r.ID, "action", audit.Action, "error", err)
+	}
+}
+
+// canReview 管理员或者在模块上拥有owner角色的其他用户可以审批，项目的申请由所属模块的owner审批
+func canReview(s *storage.Engine, u *token.Claims, r *models.AccessRequest) bool {
+	if u.IsServiceAccount() || u.ID == r.UserID {
+		return false
+	}
+	return view.ModuleAllowed(s, u, r.ModuleID, models.RoleOwner)
+}
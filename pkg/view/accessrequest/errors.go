@@ -0,0 +1,52 @@
+package accessrequest
+
+const (
+	// 创建申请失败
+	ErrCreateRequestFailed = "create access request failed"
+	// 获取申请失败
+	ErrGetRequestFailed = "get access request failed"
+	// 获取申请列表失败
+	ErrGetRequestListFailed = "get access request list failed"
+	// id错误
+	ErrID = "id error"
+	// 无效的参数
+	ErrInvalidParam = "invalid param"
+	// 没有权限
+	ErrNoPermission = "no permission on access request"
+	// 申请不是等待审批状态
+	ErrRequestNotPending = "access request is not pending"
+	// 已经拥有申请的角色
+	ErrAlreadyGranted = "role already granted"
+	// 申请的时长超过上限
+	ErrDurationTooLong = "duration exceeds the maximum"
+	// 不能审批自己的申请
+	ErrReviewOwn = "can not review your own access request"
+	// 审批失败
+	ErrReviewFailed = "review access request failed"
+	// 申请不是已批准状态
+	ErrRequestNotApproved = "access request is not approved"
+	// 收回临时权限失败
+	ErrRevokeFailed = "revoke access failed"
+	// 模块或项目不存在
+	ErrTargetNotFound = "module or project not found"
+	// 服务账号不能申请权限
+	ErrByServiceAccount = "service account can not request access"
+)
+
+var errorMap = map[string]int{
+	ErrCreateRequestFailed:  80001,
+	ErrGetRequestFailed:     80002,
+	ErrGetRequestListFailed: 80003,
+	ErrID:                   80004,
+	ErrInvalidParam:         80005,
+	ErrNoPermission:         80006,
+	ErrRequestNotPending:    80007,
+	ErrAlreadyGranted:       80008,
+	ErrDurationTooLong:      80009,
+	ErrReviewOwn:            80010,
+	ErrReviewFailed:         80011,
+	ErrRequestNotApproved:   80012,
+	ErrRevokeFailed:         80013,
+	ErrTargetNotFound:       80014,
+	ErrByServiceAccount:     80015,
+}
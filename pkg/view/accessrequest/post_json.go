@@ -0,0 +1,33 @@
+package accessrequest
+
+import "github.com/hex-techs/blade/pkg/models"
+
+// RequestForm 申请临时权限的表单，模块id和项目id必须且只能指定一个
+type RequestForm struct {
+	ModuleID  uint   `json:"moduleID"`
+	ProjectID uint   `json:"projectID"`
+	Role      string `json:"role" binding:"required,oneof=owner maintainer developer viewer"`
+	// 申请的时长，单位秒，不能超过 authz.maxGrantDuration
+	Duration int64 `json:"duration" binding:"required,min=60"`
+	// 申请理由
+	Justification string `json:"justification" binding:"required,max=1024"`
+}
+
+// ReviewForm 审批或收回权限的表单
+type ReviewForm struct {
+	Comment string `json:"comment" binding:"max=1024"`
+}
+
+// RequestQuery 查询申请的参数
+type RequestQuery struct {
+	// 按状态过滤
+	Status string `form:"status" binding:"omitempty,oneof=pending approved denied cancelled revoked expired"`
+	// 为true时返回当前用户可以审批的申请，否则返回自己的申请
+	Review bool `form:"review"`
+}
+
+// RequestDetail 申请详情以及每一步的审计记录
+type RequestDetail struct {
+	models.AccessRequest
+	History []models.AuditLog `json:"history"`
+}
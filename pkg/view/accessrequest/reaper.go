@@ -0,0 +1,60 @@
+package accessrequest
+
+import (
+	"context"
+	"time"
+
+	"github.com/fize/go-ext/log"
+	"github.com/hex-techs/blade/pkg/models"
+	"github.com/hex-techs/blade/pkg/utils/storage"
+	"github.com/hex-techs/blade/pkg/view"
+)
+
+// StartReaper 按照间隔删除已过期的临时角色，过期的角色在删除前已经不再生效
+func StartReaper(s *storage.Engine, interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for range ticker.C {
+			if err := Reap(s); err != nil {
+				log.Errorw("reap expired grants error", "error", err)
+			}
+		}
+	}()
+}
+
+// Reap 删除已过期的临时角色，通过申请获得的将申请标记为已到期，多个副本同时执行时只记录一次
+func Reap(s *storage.Engine) error {
+	var members []models.ModuleMember
+	if err := s.FindWhere(context.TODO(), &members, "expires_at IS NOT NULL AND expires_at <= ?", time.Now()); err != nil {
+		return err
+	}
+	for _, m := range members {
+		log.Infow("remove expired grant", "module", m.ModuleID, "project", m.ProjectID, "user", m.UserID,
+			"group", m.GroupID, "role", m.Role, "request", m.RequestID)
+		if err := s.ForceDelete(context.TODO(), m.ID, "", &models.ModuleMember{}); err != nil {
+			return err
+		}
+		view.NotifyGrantChanged(m.ModuleID)
+		if m.RequestID == 0 {
+			continue
+		}
+		ok, err := s.CompareAndUpdate(context.TODO(), m.RequestID, "status", models.AccessApproved,
+			&models.AccessRequest{}, map[string]interface{}{"status": models.AccessExpired})
+		if err != nil {
+			return err
+		}
+		if !ok {
+			continue
+		}
+		var r models.AccessRequest
+		if err := s.Get(context.TODO(), m.RequestID, "", &r); err != nil {
+			return err
+		}
+		record(s, &models.AuditLog{
+			Action:    models.AuditAccessExpire,
+			ActorName: models.AuditActorSystem,
+		}, &r)
+	}
+	return nil
+}
@@ -2,18 +2,21 @@ package authentication
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"net/http"
 	"strings"
 
 	"github.com/fize/go-ext/log"
-	"github.com/fize/go-ext/sendmail"
 	"github.com/gin-gonic/gin"
 	"github.com/hex-techs/blade/pkg/models"
 	"github.com/hex-techs/blade/pkg/utils/config"
+	"github.com/hex-techs/blade/pkg/utils/ldap"
+	"github.com/hex-techs/blade/pkg/utils/password"
 	"github.com/hex-techs/blade/pkg/utils/storage"
 	"github.com/hex-techs/blade/pkg/utils/token"
 	"github.com/hex-techs/blade/pkg/utils/web"
+	"github.com/hex-techs/blade/pkg/view"
 )
 
 // Authn 认证结构体
@@ -25,53 +28,105 @@ func NewAuthn(s *storage.Engine) *Authn {
 	return &Authn{Store: s}
 }
 
-// 登录
+// 登录，开启ldap时除内置管理员外都通过ldap认证
 func (a *Authn) Login(c *gin.Context) {
 	var f LoginForm
-	var user models.User
 	if err := c.ShouldBindJSON(&f); err != nil {
 		c.JSON(http.StatusBadRequest, web.ExceptResponse(errorMap[ErrInvalidParam], err))
 		return
 	}
-	log.Debugf("login user: %v", f)
-	if err := a.Store.Get(context.TODO(), 0, f.Name, &user); err != nil {
-		if err.Error() != "record not found" {
-			c.JSON(http.StatusOK, web.ExceptResponse(errorMap[ErrOther], err))
-			return
-		}
-		c.JSON(http.StatusOK, web.ExceptResponse(errorMap[ErrAccountNotFound], ErrAccountNotFound))
+	log.Debugf("login user: %s", f.Name)
+	if a.checkLocked(c, f.Name) {
 		return
 	}
-	if user.ValidatePassword(f.Password) {
-		if err := user.GenUser(); err != nil {
-			c.JSON(http.StatusOK, web.ExceptResponse(errorMap[ErrGenerateToken], err))
-			return
-		}
+	var (
+		user   *models.User
+		errKey string
+		err    error
+	)
+	if ldap.Enabled() && f.Name != models.AdminName {
+		user, errKey, err = a.ldapLogin(f.Name, f.Password)
 	} else {
-		c.JSON(http.StatusOK, web.ExceptResponse(errorMap[ErrPasswordInvalid], ErrPasswordInvalid))
+		user, errKey, err = a.localLogin(f.Name, f.Password)
+	}
+	if err != nil {
+		switch errKey {
+		case ErrAccountNotFound, ErrPasswordInvalid:
+			// 不区分用户不存在和密码错误，避免枚举用户
+			a.recordFailure(c, f.Name)
+			c.JSON(http.StatusOK, web.ExceptResponse(errorMap[ErrInvalidCredentials], ErrInvalidCredentials))
+		case ErrOther:
+			c.JSON(http.StatusOK, web.ExceptResponse(errorMap[errKey], err))
+		default:
+			c.JSON(http.StatusOK, web.ExceptResponse(errorMap[errKey], errKey))
+		}
 		return
 	}
-	user.TruncatePassword()
-	c.JSON(http.StatusOK, web.DataResponse(user))
+	a.clearFailures(f.Name)
+	a.respondLogin(c, user)
+}
+
+// localLogin 使用本地存储的密码认证用户
+func (a *Authn) localLogin(name, plain string) (*models.User, string, error) {
+	var user models.User
+	if err := a.Store.Get(context.TODO(), 0, name, &user); err != nil {
+		if err.Error() != "record not found" {
+			return nil, ErrOther, err
+		}
+		password.VerifyDummy(plain)
+		return nil, ErrAccountNotFound, err
+	}
+	if !user.ValidatePassword(plain) {
+		return nil, ErrPasswordInvalid, errors.New(ErrPasswordInvalid)
+	}
+	// 旧格式的密码哈希在登录成功后升级，失败不影响登录
+	if user.NeedRehash() {
+		upgraded := models.User{Password: plain}
+		if err := upgraded.EncodePasswd(); err == nil {
+			if err := a.Store.Update(context.TODO(), user.ID, "", &models.User{},
+				map[string]interface{}{"password": upgraded.Password}); err != nil {
+				log.Warnw("upgrade password hash error", "user", name, "error", err)
+			}
+		}
+	}
+	return &user, "", nil
 }
 
-// 注册用户
+// 注册用户，自助注册的用户需要验证邮箱，通过邀请注册的用户直接生效
 func (a *Authn) Register(c *gin.Context) {
 	var f RegisterForm
 	if err := c.ShouldBindJSON(&f); err != nil {
 		c.JSON(http.StatusBadRequest, web.ExceptResponse(errorMap[ErrInvalidParam], err))
 		return
 	}
-	log.Debugf("register user: %v", f)
-	// 判断邮箱是否可以注册
-	l := strings.Split(f.Email, "@")
-	company := l[1]
-	if config.Read().Service.Company != "" {
-		if company != config.Read().Service.Company {
+	log.Debugw("register user", "name", f.Name, "email", f.Email)
+	var inv *models.Invitation
+	if f.InviteToken != "" {
+		var i models.Invitation
+		if err := a.Store.GetBy(context.TODO(), "hash", token.Hash(f.InviteToken), &i); err != nil || !i.Match(f.Email) {
+			c.JSON(http.StatusOK, web.ExceptResponse(errorMap[ErrInvitationInvalid], ErrInvitationInvalid))
+			return
+		}
+		inv = &i
+	}
+	switch config.Read().Service.RegistrationMode {
+	case config.RegistrationInvite:
+		if inv == nil {
+			c.JSON(http.StatusOK, web.ExceptResponse(errorMap[ErrInvitationRequired], ErrInvitationRequired))
+			return
+		}
+	case config.RegistrationDomain:
+		// 受邀用户不受邮箱后缀限制
+		if inv == nil && !strings.EqualFold(emailDomain(f.Email), config.Read().Service.Company) {
 			c.JSON(http.StatusOK, web.ExceptResponse(errorMap[ErrEmailNotAllowed], ErrEmailNotAllowed))
 			return
 		}
 	}
+	// 无法发送验证邮件时用户永远无法激活，直接拒绝
+	if inv == nil && !view.EmailEnabled() {
+		c.JSON(http.StatusOK, web.ExceptResponse(errorMap[ErrSendVerifyEmailFailed], view.ErrEmailNotConfigured))
+		return
+	}
 	user := models.User{
 		Name:     f.Name,
 		Email:    f.Email,
@@ -79,13 +134,152 @@ func (a *Authn) Register(c *gin.Context) {
 		Password: f.Password,
 		Phone:    f.Phone,
 		IM:       f.IM,
+		Pending:  inv == nil,
+	}
+	if !a.checkPassword(c, &user, f.Password) {
+		return
+	}
+	if err := user.EncodePasswd(); err != nil {
+		c.JSON(http.StatusOK, web.ExceptResponse(errorMap[ErrRegisterFailed], err))
+		return
 	}
-	user.EncodePasswd()
 	if err := a.Store.Create(context.TODO(), &user); err != nil {
 		c.JSON(http.StatusOK, web.ExceptResponse(errorMap[ErrRegisterFailed], err))
-	} else {
+		return
+	}
+	if err := view.RecordPassword(a.Store, &user); err != nil {
+		log.Warnw("record password history error", "user", user.Name, "error", err)
+	}
+	if inv != nil {
+		if !a.acceptInvitation(c, inv, &user) {
+			return
+		}
 		c.JSON(http.StatusOK, web.OkResponse())
+		return
+	}
+	// 发送失败时用户保持待验证状态，可以重新发送验证邮件
+	if err := view.SendVerifyEmail(&user, user.Email); err != nil {
+		c.JSON(http.StatusOK, web.ExceptResponse(errorMap[ErrSendVerifyEmailFailed], err))
+		return
+	}
+	c.JSON(http.StatusOK, web.OkResponse())
+}
+
+// acceptInvitation 消费邀请并加入预先分配的模块，邀请已被使用时删除刚创建的用户
+func (a *Authn) acceptInvitation(c *gin.Context, inv *models.Invitation, user *models.User) bool {
+	ok, err := a.Store.CompareAndUpdate(context.TODO(), inv.ID, "used", false, &models.Invitation{},
+		map[string]interface{}{"used": true, "user_id": user.ID})
+	if err != nil || !ok {
+		if err := a.Store.ForceDelete(context.TODO(), user.ID, "", &models.User{}); err != nil {
+			log.Errorw("delete user of used invitation error", "user", user.Name, "error", err)
+		}
+		if err != nil {
+			c.JSON(http.StatusOK, web.ExceptResponse(errorMap[ErrRegisterFailed], err))
+		} else {
+			c.JSON(http.StatusOK, web.ExceptResponse(errorMap[ErrInvitationInvalid], ErrInvitationInvalid))
+		}
+		return false
+	}
+	for _, g := range inv.Modules {
+		m := models.ModuleMember{ModuleID: g.ModuleID, UserID: user.ID, Role: g.Role}
+		if err := a.Store.Create(context.TODO(), &m); err != nil {
+			log.Warnw("add invited user to module error", "user", user.Name, "module", g.ModuleID, "error", err)
+			continue
+		}
+		view.NotifyGrantChanged(g.ModuleID)
+	}
+	log.Infow("invitation accepted", "user", user.Name, "invitation", inv.ID, "invitedBy", inv.InvitedBy)
+	return true
+}
+
+// VerifyEmail 验证邮箱，自助注册的用户验证后才能登录，验证的邮箱与当前邮箱不同时修改为新邮箱
+func (a *Authn) VerifyEmail(c *gin.Context) {
+	claims, err := token.ParsePurposeToken(c.Param("token"), token.PurposeVerifyEmail)
+	if err != nil {
+		c.JSON(http.StatusOK, web.ExceptResponse(errorMap[ErrVerifyTokenInvalid], ErrVerifyTokenInvalid))
+		return
+	}
+	var u models.User
+	if err := a.Store.Get(context.TODO(), claims.ID, "", &u); err != nil || u.TokenVersion != claims.Version {
+		c.JSON(http.StatusOK, web.ExceptResponse(errorMap[ErrVerifyTokenInvalid], ErrVerifyTokenInvalid))
+		return
+	}
+	if !strings.EqualFold(u.Email, claims.Email) {
+		a.changeEmail(c, &u, claims.Email)
+		return
+	}
+	if u.Pending {
+		if err := a.Store.Update(context.TODO(), u.ID, "", &models.User{},
+			map[string]interface{}{"pending": false}); err != nil {
+			c.JSON(http.StatusOK, web.ExceptResponse(errorMap[ErrOther], err))
+			return
+		}
+		log.Infow("email verified", "user", u.Name)
+	}
+	c.JSON(http.StatusOK, web.OkResponse())
+}
+
+// changeEmail 新邮箱验证通过后修改邮箱，待验证的用户和身份源同步的用户不能修改
+func (a *Authn) changeEmail(c *gin.Context, u *models.User, email string) {
+	if u.Pending || u.Source != models.SourceLocal {
+		c.JSON(http.StatusOK, web.ExceptResponse(errorMap[ErrVerifyTokenInvalid], ErrVerifyTokenInvalid))
+		return
+	}
+	// 发送验证邮件后邮箱可能已被其他用户使用
+	if err := a.Store.GetBy(context.TODO(), "email", email, &models.User{}); err == nil {
+		c.JSON(http.StatusOK, web.ExceptResponse(errorMap[ErrEmailRegistered], ErrEmailRegistered))
+		return
+	}
+	if err := a.Store.Update(context.TODO(), u.ID, "", &models.User{},
+		map[string]interface{}{"email": email}); err != nil {
+		c.JSON(http.StatusOK, web.ExceptResponse(errorMap[ErrChangeEmailFailed], err))
+		return
+	}
+	log.Infow("email changed", "user", u.Name, "old", u.Email, "new", email)
+	// 请求路径中带有验证链接，只记录路由
+	audit := models.AuditLog{
+		Action:     models.AuditEmailChange,
+		ActorID:    u.ID,
+		ActorName:  u.Name,
+		UserID:     u.ID,
+		UserName:   u.Name,
+		Method:     c.Request.Method,
+		Path:       c.FullPath(),
+		Status:     http.StatusOK,
+		IP:         c.ClientIP(),
+		Detail:     fmt.Sprintf("%s -> %s", u.Email, email),
+		Resource:   "user",
+		ResourceID: u.ID,
+	}
+	if err := a.Store.Create(context.TODO(), &audit); err != nil {
+		log.Errorw("record email change error", "user", u.Name, "error", err)
+	}
+	c.JSON(http.StatusOK, web.OkResponse())
+}
+
+// ResendVerifyEmail 重新发送验证邮件，不论用户是否存在都返回成功，避免枚举用户
+func (a *Authn) ResendVerifyEmail(c *gin.Context) {
+	var f ResendVerifyEmailForm
+	if err := c.ShouldBindJSON(&f); err != nil {
+		c.JSON(http.StatusBadRequest, web.ExceptResponse(errorMap[ErrInvalidParam], err))
+		return
 	}
+	var u models.User
+	if err := a.Store.Get(context.TODO(), 0, f.Name, &u); err == nil && u.Pending {
+		if err := view.SendVerifyEmail(&u, u.Email); err != nil {
+			log.Errorw("send verify email error", "user", u.Name, "error", err)
+		}
+	}
+	c.JSON(http.StatusOK, web.OkResponse())
+}
+
+// emailDomain 返回邮箱的域名部分，不是合法邮箱时返回空字符串
+func emailDomain(email string) string {
+	i := strings.LastIndex(email, "@")
+	if i < 0 {
+		return ""
+	}
+	return email[i+1:]
 }
 
 // 修改密码
@@ -103,12 +297,30 @@ func (a *Authn) ChangePassword(c *gin.Context) {
 		return
 	}
 	if user.ValidatePassword(f.OldPassword) {
+		if !a.checkPassword(c, &user, f.NewPassword) {
+			return
+		}
 		user.Password = f.NewPassword
-		user.EncodePasswd()
+		if err := user.EncodePasswd(); err != nil {
+			c.JSON(http.StatusOK, web.ExceptResponse(errorMap[ErrChangePasswordFailed], err))
+			return
+		}
 		if err := a.Store.Update(context.TODO(), user.ID, user.Name, &user, &user); err != nil {
 			c.JSON(http.StatusOK, web.ExceptResponse(errorMap[ErrChangePasswordFailed], err))
 			return
 		}
+		// 修改密码后之前签发的token和访问令牌全部失效
+		if err := view.RevokeUserTokens(a.Store, user.ID); err != nil {
+			c.JSON(http.StatusOK, web.ExceptResponse(errorMap[ErrChangePasswordFailed], err))
+			return
+		}
+		if err := view.RevokeAccessTokens(a.Store, user.ID); err != nil {
+			c.JSON(http.StatusOK, web.ExceptResponse(errorMap[ErrChangePasswordFailed], err))
+			return
+		}
+		if err := view.RecordPassword(a.Store, &user); err != nil {
+			log.Warnw("record password history error", "user", user.Name, "error", err)
+		}
 	} else {
 		c.JSON(http.StatusOK, web.ExceptResponse(errorMap[ErrPasswordInvalid], ErrPasswordInvalid))
 		return
@@ -116,7 +328,7 @@ func (a *Authn) ChangePassword(c *gin.Context) {
 	c.JSON(http.StatusOK, web.OkResponse())
 }
 
-// 请求重置密码
+// 请求重置密码，新的请求会使之前的重置链接失效，无论用户是否存在都返回成功，避免通过该接口探测账号
 func (a *Authn) ResetPasswordRequest(c *gin.Context) {
 	var f ForgetPasswordForm
 	var user models.User
@@ -125,53 +337,114 @@ func (a *Authn) ResetPasswordRequest(c *gin.Context) {
 		return
 	}
 	log.Debugw("reset password request", "user", f)
-	if err := a.Store.Get(context.TODO(), 0, f.Name, &user); err != nil {
-		c.JSON(http.StatusOK, web.ExceptResponse(errorMap[ErrAccountNotFound], err))
+	// 邮件配置与用户无关，可以直接返回错误
+	if !view.EmailEnabled() {
+		c.JSON(http.StatusOK, web.ExceptResponse(errorMap[ErrSendResetEmailFailed], view.ErrEmailNotConfigured))
 		return
 	}
-	mc := config.Read().Email
-	// if mc != nil && mc.Enabled {
-	body := fmt.Sprintf("重置密码链接： %s%s/%s，有效时间%d秒。",
-		config.Read().Service.Domain, config.Read().Service.ResetPath,
-		token.GenerateCustomToken(f.Name, int(config.Read().Service.URLExpired)), config.Read().Service.URLExpired)
-	if err := sendmail.SendEmail("blade", mc.SMTP, mc.Account, mc.Password, user.Email, "Reset Password", body, mc.Port); err != nil {
-		c.JSON(http.StatusOK, web.ExceptResponse(errorMap[ErrSendResetEmailFailed], err))
+	if err := a.Store.Get(context.TODO(), 0, f.Name, &user); err != nil {
+		log.Debugw("reset password for unknown account", "name", f.Name, "error", err)
+		c.JSON(http.StatusOK, web.OkResponse())
 		return
 	}
-	// } else {
-	// 	c.JSON(http.StatusOK, web.DataResponse("未开启邮件服务，请联系管理员重置密码！"))
-	// 	return
-	// }
+	if err := a.sendResetEmail(&user); err != nil {
+		log.Errorw("send reset password email error", "user", user.Name, "error", err)
+	}
 	c.JSON(http.StatusOK, web.OkResponse())
 }
 
-// 重置密码
+// sendResetEmail 删除用户之前的重置令牌，生成新的令牌并发送重置链接
+func (a *Authn) sendResetEmail(user *models.User) error {
+	rt, err := models.NewPasswordResetToken(user, config.Read().Service.URLExpired)
+	if err != nil {
+		return err
+	}
+	if err := a.Store.DeleteWhere(context.TODO(), &models.PasswordResetToken{}, "user_id = ?", user.ID); err != nil {
+		return err
+	}
+	if err := a.Store.Create(context.TODO(), rt); err != nil {
+		return err
+	}
+	body := fmt.Sprintf("重置密码链接： %s%s/%s，有效时间%d秒。",
+		config.Read().Service.Domain, config.Read().Service.ResetPath,
+		rt.Token, config.Read().Service.URLExpired)
+	return view.SendEmail(user.Email, "Reset Password", body)
+}
+
+// 重置密码，令牌只能使用一次，且用户密码变化后失效
 func (a *Authn) ResetPassword(c *gin.Context) {
 	var f ResetPasswordForm
 	if err := c.ShouldBindJSON(&f); err != nil {
 		c.JSON(http.StatusBadRequest, web.ExceptResponse(errorMap[ErrInvalidParam], err))
 		return
 	}
-	log.Debugf("reset password: %v", f)
-	if f.Token == "" {
+	var rt models.PasswordResetToken
+	if err := a.Store.GetBy(context.TODO(), "hash", token.Hash(f.Token), &rt); err != nil {
 		c.JSON(http.StatusOK, web.ExceptResponse(errorMap[ErrResetTokenInvalid], ErrResetTokenInvalid))
 		return
 	}
-	name, err := token.ParseCustomToken(f.Token)
-	if err != nil {
-		c.JSON(http.StatusOK, web.ExceptResponse(errorMap[ErrResetTokenInvalid], err))
+	var u models.User
+	if err := a.Store.Get(context.TODO(), rt.UserID, "", &u); err != nil {
+		c.JSON(http.StatusOK, web.ExceptResponse(errorMap[ErrResetTokenInvalid], ErrResetTokenInvalid))
 		return
 	}
-	var u models.User
-	if err := a.Store.Get(context.TODO(), 0, name, &u); err != nil {
+	if !rt.Match(&u) {
+		c.JSON(http.StatusOK, web.ExceptResponse(errorMap[ErrResetTokenInvalid], ErrResetTokenInvalid))
+		return
+	}
+	// 不符合密码策略时不消费令牌，用户可以继续使用同一个链接
+	if !a.checkPassword(c, &u, f.Password) {
+		return
+	}
+	// 并发使用同一个令牌时只有一个请求能成功
+	ok, err := a.Store.CompareAndUpdate(context.TODO(), rt.ID, "used", false, &models.PasswordResetToken{},
+		map[string]interface{}{"used": true})
+	if err != nil {
 		c.JSON(http.StatusOK, web.ExceptResponse(errorMap[ErrResetPasswordFailed], err))
 		return
 	}
+	if !ok {
+		c.JSON(http.StatusOK, web.ExceptResponse(errorMap[ErrResetTokenInvalid], ErrResetTokenInvalid))
+		return
+	}
+	log.Debugw("reset password", "user", u.Name)
 	u.Password = f.Password
-	u.EncodePasswd()
+	if err := u.EncodePasswd(); err != nil {
+		c.JSON(http.StatusOK, web.ExceptResponse(errorMap[ErrResetPasswordFailed], err))
+		return
+	}
 	if err := a.Store.Update(context.TODO(), u.ID, u.Name, &u, &u); err != nil {
 		c.JSON(http.StatusOK, web.ExceptResponse(errorMap[ErrResetPasswordFailed], err))
 		return
 	}
+	if err := view.RevokeUserTokens(a.Store, u.ID); err != nil {
+		c.JSON(http.StatusOK, web.ExceptResponse(errorMap[ErrResetPasswordFailed], err))
+		return
+	}
+	// 重置密码通常意味着账号可能已泄露，访问令牌一并吊销
+	if err := view.RevokeAccessTokens(a.Store, u.ID); err != nil {
+		c.JSON(http.StatusOK, web.ExceptResponse(errorMap[ErrResetPasswordFailed], err))
+		return
+	}
+	if err := view.RecordPassword(a.Store, &u); err != nil {
+		log.Warnw("record password history error", "user", u.Name, "error", err)
+	}
+	if err := a.Store.DeleteWhere(context.TODO(), &models.PasswordResetToken{}, "user_id = ?", u.ID); err != nil {
+		log.Warnw("clean password reset token error", "user", u.Name, "error", err)
+	}
 	c.JSON(http.StatusOK, web.OkResponse())
 }
+
+// checkPassword 按照密码策略检查新密码，不符合时逐条返回违反的规则
+func (a *Authn) checkPassword(c *gin.Context, u *models.User, plain string) bool {
+	violations, err := view.CheckPassword(a.Store, u, plain)
+	if err != nil {
+		c.JSON(http.StatusOK, web.ExceptResponse(errorMap[ErrOther], err))
+		return false
+	}
+	if len(violations) > 0 {
+		c.JSON(http.StatusOK, web.ExceptDataResponse(errorMap[ErrPasswordPolicy], violations, ErrPasswordPolicy))
+		return false
+	}
+	return true
+}
@@ -23,18 +23,108 @@ const (
 	ErrInvalidParam = "invalid param"
 	// 其他错误
 	ErrOther = "other error"
+	// ldap认证失败
+	ErrLdapFailed = "ldap authenticate failed"
+	// 未开启oidc
+	ErrOidcDisabled = "oidc not enabled"
+	// oidc认证失败
+	ErrOidcFailed = "oidc authenticate failed"
+	// oidc state无效
+	ErrOidcStateInvalid = "oidc state invalid"
+	// refresh token无效
+	ErrRefreshTokenInvalid = "refresh token invalid"
+	// 注销失败
+	ErrLogoutFailed = "logout failed"
+	// 密码不符合密码策略
+	ErrPasswordPolicy = "password does not meet the password policy"
+	// 两步验证token无效
+	ErrMFATokenInvalid = "mfa token invalid"
+	// 验证码或恢复码无效
+	ErrMFACodeInvalid = "mfa code invalid"
+	// 已开启两步验证
+	ErrMFAAlreadyEnabled = "mfa already enabled"
+	// 未绑定认证器
+	ErrMFANotEnrolled = "mfa not enrolled"
+	// 管理员必须开启两步验证
+	ErrMFARequired = "mfa is required for admin"
+	// 两步验证操作失败
+	ErrMFAFailed = "mfa operation failed"
+	// 用户名或密码错误
+	ErrInvalidCredentials = "invalid username or password"
+	// 登录失败次数过多
+	ErrLoginLocked = "too many failed login attempts, try again later"
+	// 邮箱未验证
+	ErrAccountPending = "email not verified"
+	// 发送验证邮件失败
+	ErrSendVerifyEmailFailed = "send verify email failed"
+	// 邮箱验证链接无效
+	ErrVerifyTokenInvalid = "verify email token invalid"
+	// 邀请无效
+	ErrInvitationInvalid = "invitation invalid or expired"
+	// 只能通过邀请注册
+	ErrInvitationRequired = "registration requires an invitation"
+	// 用户已被禁用
+	ErrAccountDisabled = "account disabled"
+	// 不能管理其他用户的会话
+	ErrSessionOther = "can not manage other user's sessions"
+	// 会话不存在
+	ErrSessionNotFound = "session not found"
+	// 会话操作失败
+	ErrSessionFailed = "session operation failed"
+	// 不能模拟自己或其他管理员
+	ErrImpersonateNotAllowed = "can not impersonate yourself or other administrators"
+	// 模拟登录需要交互式登录
+	ErrImpersonateByToken = "impersonation requires interactive login"
+	// 模拟登录失败
+	ErrImpersonateFailed = "impersonate failed"
+	// 邮箱已经被其他用户使用
+	ErrEmailRegistered = "email already registered"
+	// 修改邮箱失败
+	ErrChangeEmailFailed = "change email failed"
+	// 已经存在来自其他来源的同名用户
+	ErrSourceConflict = "account already exists with another source"
 )
 
 var errorMap = map[string]int{
-	ErrAccountNotFound:      10001,
-	ErrGenerateToken:        10002,
-	ErrPasswordInvalid:      10003,
-	ErrEmailNotAllowed:      10004,
-	ErrRegisterFailed:       10005,
-	ErrSendResetEmailFailed: 10006,
-	ErrResetTokenInvalid:    10007,
-	ErrResetPasswordFailed:  10008,
-	ErrChangePasswordFailed: 10009,
-	ErrInvalidParam:         10010,
-	ErrOther:                10011,
+	ErrAccountNotFound:       10001,
+	ErrGenerateToken:         10002,
+	ErrPasswordInvalid:       10003,
+	ErrEmailNotAllowed:       10004,
+	ErrRegisterFailed:        10005,
+	ErrSendResetEmailFailed:  10006,
+	ErrResetTokenInvalid:     10007,
+	ErrResetPasswordFailed:   10008,
+	ErrChangePasswordFailed:  10009,
+	ErrInvalidParam:          10010,
+	ErrOther:                 10011,
+	ErrLdapFailed:            10012,
+	ErrOidcDisabled:          10013,
+	ErrOidcFailed:            10014,
+	ErrOidcStateInvalid:      10015,
+	ErrRefreshTokenInvalid:   10016,
+	ErrLogoutFailed:          10017,
+	ErrPasswordPolicy:        10018,
+	ErrMFATokenInvalid:       10019,
+	ErrMFACodeInvalid:        10020,
+	ErrMFAAlreadyEnabled:     10021,
+	ErrMFANotEnrolled:        10022,
+	ErrMFARequired:           10023,
+	ErrMFAFailed:             10024,
+	ErrInvalidCredentials:    10025,
+	ErrLoginLocked:           10026,
+	ErrAccountPending:        10027,
+	ErrSendVerifyEmailFailed: 10028,
+	ErrVerifyTokenInvalid:    10029,
+	ErrInvitationInvalid:     10030,
+	ErrInvitationRequired:    10031,
+	ErrAccountDisabled:       10032,
+	ErrSessionOther:          10033,
+	ErrSessionNotFound:       10034,
+	ErrSessionFailed:         10035,
+	ErrImpersonateNotAllowed: 10036,
+	ErrImpersonateByToken:    10037,
+	ErrImpersonateFailed:     10038,
+	ErrEmailRegistered:       10039,
+	ErrChangeEmailFailed:     10040,
+	ErrSourceConflict:        10041,
 }
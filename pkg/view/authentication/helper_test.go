@@ -0,0 +1,20 @@
+package authentication
+
+import (
+	"testing"
+
+	"github.com/hex-techs/blade/pkg/models"
+	"github.com/hex-techs/blade/pkg/utils/testutil"
+)
+
+// newTestAuthn 使用临时目录中的配置和sqlite数据库创建Authn，extra为追加的配置
+func newTestAuthn(t *testing.T, extra string) *Authn {
+	t.Helper()
+	s := testutil.NewStore(t, extra, &models.User{}, &models.Module{}, &models.Project{}, &models.PersonalAccessToken{},
+		&models.RefreshToken{}, &models.Session{}, &models.PasswordResetToken{},
+		&models.PasswordHistory{}, &models.MFARecoveryCode{}, &models.LoginAttempt{},
+		&models.ModuleMember{}, &models.Invitation{}, &models.ServiceAccount{},
+		&models.ServiceAccountToken{}, &models.AuditLog{}, &models.PolicyRevision{},
+		&models.Group{}, &models.GroupMember{}, &models.AccessRequest{})
+	return NewAuthn(s)
+}
@@ -0,0 +1,130 @@
+package authentication
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/fize/go-ext/log"
+	"github.com/gin-gonic/gin"
+	"github.com/hex-techs/blade/pkg/models"
+	"github.com/hex-techs/blade/pkg/utils/token"
+	"github.com/hex-techs/blade/pkg/utils/web"
+	"github.com/hex-techs/blade/pkg/view"
+)
+
+// Impersonate 管理员模拟其他用户，签发有效期较短且不能刷新的token，鉴权以被模拟的用户为准
+func (a *Authn) Impersonate(c *gin.Context) {
+	u := web.GetCurrentUser(c)
+	// 模拟登录绑定在管理员的会话上，访问令牌没有会话
+	if u.IsAccessToken() || u.SID == "" {
+		c.JSON(http.StatusForbidden, web.ExceptResponse(errorMap[ErrImpersonateByToken], ErrImpersonateByToken))
+		return
+	}
+	id, err := view.GetID(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, web.ExceptResponse(errorMap[ErrInvalidParam], err))
+		return
+	}
+	var f ImpersonateForm
+	if err := c.ShouldBindJSON(&f); err != nil {
+		c.JSON(http.StatusBadRequest, web.ExceptResponse(errorMap[ErrInvalidParam], err))
+		return
+	}
+	var user models.User
+	if err := a.Store.Get(context.TODO(), id, "", &user); err != nil {
+		c.JSON(http.StatusOK, web.ExceptResponse(errorMap[ErrAccountNotFound], ErrAccountNotFound))
+		return
+	}
+	if user.ID == u.ID || user.Admin {
+		c.JSON(http.StatusOK, web.ExceptResponse(errorMap[ErrImpersonateNotAllowed], ErrImpersonateNotAllowed))
+		return
+	}
+	if !user.Enabled {
+		c.JSON(http.StatusOK, web.ExceptResponse(errorMap[ErrAccountDisabled], ErrAccountDisabled))
+		return
+	}
+	log.Infow("impersonate user", "user", user.Name, "operator", u.Name, "reason", f.Reason)
+	audit := models.AuditLog{
+		Action:    models.AuditImpersonate,
+		ActorID:   u.ID,
+		ActorName: u.Name,
+		UserID:    user.ID,
+		UserName:  user.Name,
+		Method:    c.Request.Method,
+		Path:      c.Request.URL.Path,
+		Status:    http.StatusOK,
+		IP:        c.ClientIP(),
+		Detail:    f.Reason,
+	}
+	// 审计日志写入失败时不签发token
+	if err := a.Store.Create(context.TODO(), &audit); err != nil {
+		c.JSON(http.StatusOK, web.ExceptResponse(errorMap[ErrImpersonateFailed], err))
+		return
+	}
+	if err := user.GenImpersonation(&token.Actor{ID: u.ID, Name: u.Name, SID: u.SID}); err != nil {
+		c.JSON(http.StatusOK, web.ExceptResponse(errorMap[ErrGenerateToken], err))
+		return
+	}
+	user.TruncatePassword()
+	c.JSON(http.StatusOK, web.DataResponse(user))
+}
+
+// RecordImpersonation 记录模拟登录期间的请求，供 web.LoginRequired 使用
+func (a *Authn) RecordImpersonation(c *gin.Context, claims *token.Claims) {
+	audit := models.AuditLog{
+		Action:    models.AuditImpersonatedRequest,
+		ActorID:   claims.Actor.ID,
+		ActorName: claims.Actor.Name,
+		UserID:    claims.ID,
+		UserName:  claims.Name,
+		Method:    c.Request.Method,
+		Path:      c.Request.URL.Path,
+		Status:    c.Writer.Status(),
+		IP:        c.ClientIP(),
+	}
+	if err := a.Store.Create(context.TODO(), &audit); err != nil {
+		log.Errorw("record impersonated request error", "actor", claims.Actor.Name, "user", claims.Name,
+			"path", audit.Path, "error", err)
+	}
+}
+
+// ListAuditLogs 获取审计日志，可以按真实操作人、生效的用户、操作类型和资源过滤
+func (a *Authn) ListAuditLogs(c *gin.Context) {
+	var req web.Request
+	var q AuditLogQuery
+	if err := c.ShouldBindQuery(&req); err != nil {
+		c.JSON(http.StatusBadRequest, web.ExceptResponse(errorMap[ErrInvalidParam], err))
+		return
+	}
+	if err := c.ShouldBindQuery(&q); err != nil {
+		c.JSON(http.StatusBadRequest, web.ExceptResponse(errorMap[ErrInvalidParam], err))
+		return
+	}
+	req.Default()
+	var conditions []string
+	if q.ActorID != 0 {
+		conditions = append(conditions, fmt.Sprintf("actor_id = %d", q.ActorID))
+	}
+	if q.UserID != 0 {
+		conditions = append(conditions, fmt.Sprintf("user_id = %d", q.UserID))
+	}
+	// 字符串参数已经通过oneof校验
+	if q.Action != "" {
+		conditions = append(conditions, fmt.Sprintf("action = '%s'", q.Action))
+	}
+	if q.Resource != "" {
+		conditions = append(conditions, fmt.Sprintf("resource = '%s'", q.Resource))
+	}
+	if q.ResourceID != 0 {
+		conditions = append(conditions, fmt.Sprintf("resource_id = %d", q.ResourceID))
+	}
+	var logs []models.AuditLog
+	total, err := a.Store.List(context.TODO(), req.Limit, req.Page, strings.Join(conditions, " AND "), &logs)
+	if err != nil {
+		c.JSON(http.StatusOK, web.ExceptResponse(errorMap[ErrOther], err))
+		return
+	}
+	c.JSON(http.StatusOK, web.ListResponse(int(total), logs))
+}
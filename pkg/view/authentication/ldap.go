@@ -0,0 +1,84 @@
+package authentication
+
+import (
+	"context"
+	"errors"
+
+	"github.com/fize/go-ext/log"
+	"github.com/hex-techs/blade/pkg/models"
+	"github.com/hex-techs/blade/pkg/utils/config"
+	"github.com/hex-techs/blade/pkg/utils/ldap"
+	"github.com/hex-techs/blade/pkg/view"
+	"gorm.io/gorm"
+)
+
+// ldapLogin 通过ldap认证用户，并创建或刷新本地用户记录
+func (a *Authn) ldapLogin(name, password string) (*models.User, string, error) {
+	entry, err := ldap.Authenticate(name, password)
+	if err != nil {
+		switch {
+		case errors.Is(err, ldap.ErrInvalidCredentials):
+			return nil, ErrPasswordInvalid, err
+		case errors.Is(err, ldap.ErrUserNotFound):
+			return nil, ErrAccountNotFound, err
+		default:
+			log.Errorw("ldap authenticate error", "name", name, "error", err)
+			return nil, ErrLdapFailed, err
+		}
+	}
+	user, err := a.syncLdapUser(entry)
+	if errors.Is(err, errSourceConflict) {
+		log.Warnw("ldap user conflicts with existing account", "name", name, "dn", entry.DN)
+		return nil, ErrSourceConflict, err
+	}
+	if err != nil {
+		return nil, ErrOther, err
+	}
+	if err := view.SyncGroups(a.Store, user.ID, models.SourceLdap, entry.Groups); err != nil {
+		log.Errorw("sync ldap groups error", "name", name, "error", err)
+		return nil, ErrOther, err
+	}
+	return user, "", nil
+}
+
+// errSourceConflict 同名用户来自其他来源，不能自动关联
+var errSourceConflict = errors.New(ErrSourceConflict)
+
+// syncLdapUser 首次登录时创建本地用户，之后每次登录刷新邮箱、中文名和电话
+func (a *Authn) syncLdapUser(entry *ldap.Entry) (*models.User, error) {
+	var user models.User
+	err := a.Store.Get(context.TODO(), 0, entry.Name, &user)
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, err
+	}
+	// 同名的本地用户只有明确配置后才能关联，其他来源的用户不能关联
+	if err == nil && user.Source != models.SourceLdap &&
+		(user.Source != models.SourceLocal || !config.Read().Ldap.LinkLocalAccounts) {
+		return nil, errSourceConflict
+	}
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		user = models.User{
+			Name:   entry.Name,
+			CnName: entry.CnName,
+			Email:  entry.Email,
+			Phone:  entry.Phone,
+			Source: models.SourceLdap,
+		}
+		log.Infow("create user from ldap", "name", entry.Name, "dn", entry.DN)
+		if err := a.Store.Create(context.TODO(), &user); err != nil {
+			return nil, err
+		}
+		return &user, nil
+	}
+	// 只刷新ldap中有值的字段
+	refresh := models.User{
+		CnName: entry.CnName,
+		Email:  entry.Email,
+		Phone:  entry.Phone,
+		Source: models.SourceLdap,
+	}
+	if err := a.Store.Update(context.TODO(), user.ID, "", &models.User{}, &refresh); err != nil {
+		return nil, err
+	}
+	return &user, a.Store.Get(context.TODO(), user.ID, "", &user)
+}
@@ -0,0 +1,287 @@
+package authentication
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+
+	ber "github.com/go-asn1-ber/asn1-ber"
+	"github.com/go-ldap/ldap/v3"
+	"github.com/hex-techs/blade/pkg/models"
+	"github.com/hex-techs/blade/pkg/utils/config"
+	"github.com/hex-techs/blade/pkg/view"
+)
+
+const (
+	testLdapAdmin    = "cn=admin,dc=blade,dc=cn"
+	testLdapPassword = "secret"
+)
+
+// ldapEntry 测试ldap服务中的用户
+type ldapEntry struct {
+	dn       string
+	password string
+	attrs    map[string][]string
+}
+
+// fakeLdap 进程内的ldap服务，只实现简单绑定和按 (uid=xxx) 查询
+type fakeLdap struct {
+	ln      net.Listener
+	mu      sync.Mutex
+	entries map[string]*ldapEntry
+}
+
+func newFakeLdap(t *testing.T) *fakeLdap {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f := &fakeLdap{ln: ln, entries: map[string]*ldapEntry{}}
+	t.Cleanup(func() { ln.Close() })
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go f.serve(conn)
+		}
+	}()
+	return f
+}
+
+// add 添加或替换用户
+func (f *fakeLdap) add(uid, password string, attrs map[string][]string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.entries[uid] = &ldapEntry{
+		dn:       fmt.Sprintf("uid=%s,ou=Users,dc=blade,dc=cn", uid),
+		password: password,
+		attrs:    attrs,
+	}
+}
+
+func (f *fakeLdap) serve(conn net.Conn) {
+	defer conn.Close()
+	for {
+		req, err := ber.ReadPacket(conn)
+		if err != nil || len(req.Children) < 2 {
+			return
+		}
+		id := req.Children[0].Value.(int64)
+		op := req.Children[1]
+		var resps []*ber.Packet
+		switch op.Tag {
+		case ldap.ApplicationBindRequest:
+			resps = append(resps, result(ldap.ApplicationBindResponse, f.bind(op)))
+		case ldap.ApplicationSearchRequest:
+			resps = f.search(op)
+		default:
+			// 解绑和其他请求都结束连接
+			return
+		}
+		for _, resp := range resps {
+			msg := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "message")
+			msg.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagInteger, id, "id"))
+			msg.AppendChild(resp)
+			if _, err := conn.Write(msg.Bytes()); err != nil {
+				return
+			}
+		}
+	}
+}
+
+func (f *fakeLdap) bind(op *ber.Packet) uint16 {
+	dn := op.Children[1].Value.(string)
+	password := op.Children[2].Data.String()
+	if dn == testLdapAdmin && password == testLdapPassword {
+		return ldap.LDAPResultSuccess
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, e := range f.entries {
+		if e.dn == dn && e.password == password {
+			return ldap.LDAPResultSuccess
+		}
+	}
+	return ldap.LDAPResultInvalidCredentials
+}
+
+func (f *fakeLdap) search(op *ber.Packet) []*ber.Packet {
+	filter, err := ldap.DecompileFilter(op.Children[6])
+	if err != nil || !strings.HasPrefix(filter, "(uid=") {
+		return []*ber.Packet{result(ldap.ApplicationSearchResultDone, ldap.LDAPResultUnwillingToPerform)}
+	}
+	uid := strings.TrimSuffix(strings.TrimPrefix(filter, "(uid="), ")")
+	var resps []*ber.Packet
+	f.mu.Lock()
+	if e, ok := f.entries[uid]; ok {
+		entry := ber.Encode(ber.ClassApplication, ber.TypeConstructed, ldap.ApplicationSearchResultEntry, nil, "entry")
+		entry.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, e.dn, "dn"))
+		attrs := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "attributes")
+		for name, values := range e.attrs {
+			attr := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "attribute")
+			attr.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, name, "type"))
+			set := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSet, nil, "values")
+			for _, v := range values {
+				set.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, v, "value"))
+			}
+			attr.AppendChild(set)
+			attrs.AppendChild(attr)
+		}
+		entry.AppendChild(attrs)
+		resps = append(resps, entry)
+	}
+	f.mu.Unlock()
+	return append(resps, result(ldap.ApplicationSearchResultDone, ldap.LDAPResultSuccess))
+}
+
+// result 构造只有结果码的响应
+func result(tag ber.Tag, code uint16) *ber.Packet {
+	p := ber.Encode(ber.ClassApplication, ber.TypeConstructed, tag, nil, "result")
+	p.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagEnumerated, int64(code), "code"))
+	p.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, "", "matchedDN"))
+	p.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, "", "message"))
+	return p
+}
+
+// newLdapAuthn 启动测试ldap服务，并开启ldap认证
+func newLdapAuthn(t *testing.T, extra string) (*Authn, *fakeLdap) {
+	t.Helper()
+	f := newFakeLdap(t)
+	a := newTestAuthn(t, fmt.Sprintf("ldap:\n  enabled: true\n  host: %s\n  baseDN: ou=Users,dc=blade,dc=cn\n"+
+		"  user: %s\n  password: %s\n%s", f.ln.Addr(), testLdapAdmin, testLdapPassword, extra))
+	f.add("alice", "alice-pass", map[string][]string{
+		"mail":        {"alice@example.com"},
+		"displayName": {"爱丽丝"},
+		"mobile":      {"13800000000"},
+		"memberOf":    {"cn=dev,ou=Groups,dc=blade,dc=cn", "cn=ops,ou=Groups,dc=blade,dc=cn"},
+	})
+	return a, f
+}
+
+func groupsOf(t *testing.T, a *Authn, userID uint) []string {
+	t.Helper()
+	names, err := view.UserGroupNames(a.Store, userID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func TestLdapLogin(t *testing.T) {
+	a, _ := newLdapAuthn(t, "")
+	user, errKey, err := a.ldapLogin("alice", "alice-pass")
+	if err != nil {
+		t.Fatalf("login failed: %s %v", errKey, err)
+	}
+	if user.ID == 0 || user.Name != "alice" || user.Source != models.SourceLdap {
+		t.Fatalf("unexpected user %+v", user)
+	}
+	// 属性映射到本地用户
+	var saved models.User
+	if err := a.Store.Get(context.TODO(), user.ID, "", &saved); err != nil {
+		t.Fatal(err)
+	}
+	if saved.Email != "alice@example.com" || saved.CnName != "爱丽丝" || saved.Phone != "13800000000" {
+		t.Fatalf("attributes not mapped: %+v", saved)
+	}
+	// memberOf的DN取第一个RDN作为用户组名
+	if got, want := groupsOf(t, a, user.ID), []string{"dev", "ops"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("groups = %v, want %v", got, want)
+	}
+}
+
+func TestLdapLoginBindFailure(t *testing.T) {
+	a, _ := newLdapAuthn(t, "")
+	cases := []struct {
+		name, user, password, errKey string
+	}{
+		{"wrong password", "alice", "wrong", ErrPasswordInvalid},
+		{"empty password", "alice", "", ErrPasswordInvalid},
+		{"unknown user", "nobody", "alice-pass", ErrAccountNotFound},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			user, errKey, err := a.ldapLogin(c.user, c.password)
+			if err == nil || errKey != c.errKey {
+				t.Fatalf("got user %v, errKey %q, err %v; want %q", user, errKey, err, c.errKey)
+			}
+		})
+	}
+	if count := a.Store.Count("", &[]models.User{}); count != 0 {
+		t.Fatalf("failed logins created %d users", count)
+	}
+}
+
+func TestLdapLoginServiceBindFailure(t *testing.T) {
+	a, _ := newLdapAuthn(t, "")
+	config.Read().Ldap.Password = "wrong"
+	if _, errKey, err := a.ldapLogin("alice", "alice-pass"); err == nil || errKey != ErrLdapFailed {
+		t.Fatalf("errKey %q, err %v; want %q", errKey, err, ErrLdapFailed)
+	}
+}
+
+func TestLdapLoginRefresh(t *testing.T) {
+	a, f := newLdapAuthn(t, "")
+	first, _, err := a.ldapLogin("alice", "alice-pass")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// ldap中的属性和用户组变化后，再次登录时同步
+	f.add("alice", "alice-pass", map[string][]string{
+		"mail":        {"alice@corp.example.com"},
+		"displayName": {"爱丽丝"},
+		"memberOf":    {"cn=ops,ou=Groups,dc=blade,dc=cn", "cn=sre,ou=Groups,dc=blade,dc=cn"},
+	})
+	user, _, err := a.ldapLogin("alice", "alice-pass")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if user.ID != first.ID {
+		t.Fatalf("relogin created a new user %d, want %d", user.ID, first.ID)
+	}
+	if user.Email != "alice@corp.example.com" || user.Phone != "13800000000" {
+		t.Fatalf("attributes not refreshed: %+v", user)
+	}
+	if got, want := groupsOf(t, a, user.ID), []string{"ops", "sre"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("groups = %v, want %v", got, want)
+	}
+}
+
+func TestLdapLoginLocalConflict(t *testing.T) {
+	a, _ := newLdapAuthn(t, "")
+	local := models.User{Name: "alice", CnName: "本地", Email: "local@example.com", Source: models.SourceLocal}
+	if err := a.Store.Create(context.TODO(), &local); err != nil {
+		t.Fatal(err)
+	}
+	_, errKey, err := a.ldapLogin("alice", "alice-pass")
+	if !errors.Is(err, errSourceConflict) || errKey != ErrSourceConflict {
+		t.Fatalf("errKey %q, err %v; want %q", errKey, err, ErrSourceConflict)
+	}
+	var saved models.User
+	if err := a.Store.Get(context.TODO(), local.ID, "", &saved); err != nil {
+		t.Fatal(err)
+	}
+	if saved.Source != models.SourceLocal || saved.Email != "local@example.com" {
+		t.Fatalf("local user was modified: %+v", saved)
+	}
+
+	// 配置后允许关联同名的本地用户
+	config.Read().Ldap.LinkLocalAccounts = true
+	user, _, err := a.ldapLogin("alice", "alice-pass")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if user.ID != local.ID || user.Source != models.SourceLdap || user.Email != "alice@example.com" {
+		t.Fatalf("local user not linked: %+v", user)
+	}
+}
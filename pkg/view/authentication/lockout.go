@@ -0,0 +1,149 @@
+package authentication
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/fize/go-ext/log"
+	"github.com/gin-gonic/gin"
+	"github.com/hex-techs/blade/pkg/models"
+	"github.com/hex-techs/blade/pkg/utils/config"
+	"github.com/hex-techs/blade/pkg/utils/web"
+	"github.com/hex-techs/blade/pkg/view"
+	"gorm.io/gorm"
+)
+
+// LoginLocked 登录被锁定时的响应
+type LoginLocked struct {
+	// 多少秒后可以重试
+	RetryAfter int64 `json:"retryAfter"`
+}
+
+// checkLocked 账号或来源IP处于锁定状态时返回错误响应
+func (a *Authn) checkLocked(c *gin.Context, name string) bool {
+	var attempts []models.LoginAttempt
+	now := time.Now()
+	if err := a.Store.FindWhere(context.TODO(), &attempts,
+		"((kind = ? AND subject = ?) OR (kind = ? AND subject = ?)) AND locked_until > ?",
+		models.AttemptAccount, name, models.AttemptIP, c.ClientIP(), now); err != nil {
+		// 计数不可用时不影响登录
+		log.Errorw("get login attempts error", "name", name, "error", err)
+		return false
+	}
+	var until time.Time
+	for _, la := range attempts {
+		if la.LockedUntil.After(until) {
+			until = la.LockedUntil
+		}
+	}
+	if until.IsZero() {
+		return false
+	}
+	retry := int64(until.Sub(now)/time.Second) + 1
+	c.Header("Retry-After", fmt.Sprint(retry))
+	c.JSON(http.StatusTooManyRequests, web.ExceptDataResponse(errorMap[ErrLoginLocked],
+		LoginLocked{RetryAfter: retry}, ErrLoginLocked))
+	return true
+}
+
+// recordFailure 账号和来源IP的失败次数各加一
+func (a *Authn) recordFailure(c *gin.Context, name string) {
+	p := config.Read().LoginProtection
+	if err := a.fail(models.AttemptAccount, name, p.MaxAttempts); err != nil {
+		log.Errorw("record login failure error", "name", name, "error", err)
+	}
+	if err := a.fail(models.AttemptIP, c.ClientIP(), p.IPMaxAttempts); err != nil {
+		log.Errorw("record login failure error", "ip", c.ClientIP(), "error", err)
+	}
+}
+
+// fail 在数据库中原子地增加失败次数，达到上限后按失败次数指数增加锁定时间
+func (a *Authn) fail(kind, subject string, max int) error {
+	p := config.Read().LoginProtection
+	now := time.Now()
+	stale := now.Add(-time.Duration(p.ResetAfter) * time.Second)
+	updates := map[string]interface{}{
+		// 长时间没有失败时重新计数
+		"failures":     gorm.Expr("CASE WHEN last_failure < ? THEN 1 ELSE failures + 1 END", stale),
+		"last_failure": now,
+	}
+	n, err := a.Store.UpdateWhere(context.TODO(), &models.LoginAttempt{}, updates,
+		"kind = ? AND subject = ?", kind, subject)
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		la := models.LoginAttempt{Kind: kind, Subject: subject, Failures: 1, LastFailure: now}
+		// 其他副本同时创建时违反唯一索引，改为累加
+		if err := a.Store.Create(context.TODO(), &la); err != nil {
+			if _, err := a.Store.UpdateWhere(context.TODO(), &models.LoginAttempt{}, updates,
+				"kind = ? AND subject = ?", kind, subject); err != nil {
+				return err
+			}
+		}
+	}
+	var attempts []models.LoginAttempt
+	if err := a.Store.FindWhere(context.TODO(), &attempts, "kind = ? AND subject = ?", kind, subject); err != nil {
+		return err
+	}
+	if len(attempts) == 0 || attempts[0].Failures < max {
+		return nil
+	}
+	la := attempts[0]
+	lockout := time.Duration(p.MaxLockout) * time.Second
+	// 避免移位溢出，超过上限的部分直接使用最长锁定时间
+	if exp := la.Failures - max; exp < 32 {
+		if d := time.Duration(p.Lockout) * time.Second << exp; d < lockout {
+			lockout = d
+		}
+	}
+	log.Warnw("login locked", "kind", kind, "subject", subject, "failures", la.Failures, "lockout", lockout)
+	return a.Store.Update(context.TODO(), la.ID, "", &models.LoginAttempt{},
+		map[string]interface{}{"locked_until": now.Add(lockout)})
+}
+
+// clearFailures 登录成功后清除账号的失败次数，来源IP的计数只随时间重置
+func (a *Authn) clearFailures(name string) {
+	if err := a.Store.DeleteWhere(context.TODO(), &models.LoginAttempt{},
+		"kind = ? AND subject = ?", models.AttemptAccount, name); err != nil {
+		log.Errorw("clear login failures error", "name", name, "error", err)
+	}
+}
+
+// ListLoginAttempts 管理员查看登录失败计数和锁定状态
+func (a *Authn) ListLoginAttempts(c *gin.Context) {
+	var req web.Request
+	if err := c.ShouldBindQuery(&req); err != nil {
+		c.JSON(http.StatusBadRequest, web.ExceptResponse(errorMap[ErrInvalidParam], err))
+		return
+	}
+	req.Default()
+	var attempts []models.LoginAttempt
+	total, err := a.Store.List(context.TODO(), req.Limit, req.Page, "", &attempts)
+	if err != nil {
+		c.JSON(http.StatusOK, web.ExceptResponse(errorMap[ErrOther], err))
+		return
+	}
+	now := time.Now()
+	for i := range attempts {
+		attempts[i].Locked = attempts[i].IsLocked(now)
+	}
+	c.JSON(http.StatusOK, web.ListResponse(int(total), attempts))
+}
+
+// ClearLoginAttempt 管理员解除锁定并清除失败次数
+func (a *Authn) ClearLoginAttempt(c *gin.Context) {
+	id, err := view.GetID(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, web.ExceptResponse(errorMap[ErrInvalidParam], err))
+		return
+	}
+	log.Infow("clear login attempt", "id", id, "operator", web.GetCurrentUser(c).Name)
+	if err := a.Store.ForceDelete(context.TODO(), id, "", &models.LoginAttempt{}); err != nil {
+		c.JSON(http.StatusOK, web.ExceptResponse(errorMap[ErrOther], err))
+		return
+	}
+	c.JSON(http.StatusOK, web.OkResponse())
+}
@@ -0,0 +1,365 @@
+package authentication
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/fize/go-ext/log"
+	"github.com/gin-gonic/gin"
+	"github.com/hex-techs/blade/pkg/models"
+	"github.com/hex-techs/blade/pkg/utils/config"
+	"github.com/hex-techs/blade/pkg/utils/token"
+	"github.com/hex-techs/blade/pkg/utils/totp"
+	"github.com/hex-techs/blade/pkg/utils/web"
+	"github.com/hex-techs/blade/pkg/view"
+)
+
+// 通过绑定token访问时在上下文中设置的标记
+const mfaEnrollKey = "mfaEnroll"
+
+// MFAChallenge 需要两步验证时登录接口的响应
+type MFAChallenge struct {
+	// 需要输入验证码
+	MFARequired bool `json:"mfaRequired"`
+	// 需要先绑定认证器
+	EnrollRequired bool `json:"enrollRequired"`
+	// 用于提交验证码或绑定认证器的token
+	MFAToken string `json:"mfaToken"`
+	// 过期时间
+	Expired int64 `json:"expired"`
+}
+
+// MFAEnrollment 绑定认证器需要的信息
+type MFAEnrollment struct {
+	// base32编码的密钥，用于手动输入
+	Secret string `json:"secret"`
+	// otpauth://地址，用于生成二维码
+	URI string `json:"uri"`
+}
+
+// MFARecoveryCodes 恢复码，只在生成时返回一次
+type MFARecoveryCodes struct {
+	RecoveryCodes []string `json:"recoveryCodes"`
+	// 通过绑定token完成绑定时，同时返回登录信息
+	User *models.User `json:"user,omitempty"`
+}
+
+// respondLogin 密码认证通过后，根据两步验证状态返回token或者验证挑战
+func (a *Authn) respondLogin(c *gin.Context, user *models.User) {
+	// 凭据正确后才返回账号状态，避免泄露账号是否存在
+	if !user.Enabled {
+		c.JSON(http.StatusOK, web.ExceptResponse(errorMap[ErrAccountDisabled], ErrAccountDisabled))
+		return
+	}
+	if user.Pending {
+		c.JSON(http.StatusOK, web.ExceptResponse(errorMap[ErrAccountPending], ErrAccountPending))
+		return
+	}
+	var purpose string
+	switch {
+	case user.MFAEnabled:
+		purpose = token.PurposeMFA
+	case user.Admin && config.Read().MFA.RequireAdmin:
+		purpose = token.PurposeMFAEnroll
+	}
+	if purpose != "" {
+		claims := &token.Claims{
+			ID:      user.ID,
+			Name:    user.Name,
+			Version: user.TokenVersion,
+			Purpose: purpose,
+		}
+		t, e, err := token.GenerateJWTToken(claims, config.Read().MFA.ChallengeExpired)
+		if err != nil {
+			c.JSON(http.StatusOK, web.ExceptResponse(errorMap[ErrGenerateToken], err))
+			return
+		}
+		c.JSON(http.StatusOK, web.DataResponse(MFAChallenge{
+			MFARequired:    purpose == token.PurposeMFA,
+			EnrollRequired: purpose == token.PurposeMFAEnroll,
+			MFAToken:       t,
+			Expired:        e,
+		}))
+		return
+	}
+	if err := a.issueToken(c, user, nil); err != nil {
+		c.JSON(http.StatusOK, web.ExceptResponse(errorMap[ErrGenerateToken], err))
+		return
+	}
+	user.TruncatePassword()
+	c.JSON(http.StatusOK, web.DataResponse(user))
+}
+
+// VerifyMFA 登录第二步，校验验证码或恢复码后签发token
+func (a *Authn) VerifyMFA(c *gin.Context) {
+	var f MFAVerifyForm
+	if err := c.ShouldBindJSON(&f); err != nil {
+		c.JSON(http.StatusBadRequest, web.ExceptResponse(errorMap[ErrInvalidParam], err))
+		return
+	}
+	claims, err := token.ParsePurposeToken(f.MFAToken, token.PurposeMFA)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, web.ExceptResponse(errorMap[ErrMFATokenInvalid], err))
+		return
+	}
+	var user models.User
+	if err := a.Store.Get(context.TODO(), claims.ID, "", &user); err != nil ||
+		user.TokenVersion != claims.Version || !user.Enabled {
+		c.JSON(http.StatusUnauthorized, web.ExceptResponse(errorMap[ErrMFATokenInvalid], ErrMFATokenInvalid))
+		return
+	}
+	// 验证码错误与密码错误共用失败计数，避免在挑战有效期内穷举验证码
+	if a.checkLocked(c, user.Name) {
+		return
+	}
+	if !a.checkMFACode(c, &user, f.Code, f.RecoveryCode) {
+		a.recordFailure(c, user.Name)
+		return
+	}
+	a.clearFailures(user.Name)
+	if err := a.issueToken(c, &user, nil); err != nil {
+		c.JSON(http.StatusOK, web.ExceptResponse(errorMap[ErrGenerateToken], err))
+		return
+	}
+	user.TruncatePassword()
+	c.JSON(http.StatusOK, web.DataResponse(user))
+}
+
+// MFAEnrollRequired 绑定认证器的认证中间件，除正常登录外，还接受强制绑定时签发的token
+func (a *Authn) MFAEnrollRequired() gin.HandlerFunc {
+	login := web.LoginRequired()
+	return func(c *gin.Context) {
+		t := strings.TrimPrefix(c.Request.Header.Get("Authorization"), "Bearer ")
+		if claims, err := token.ParsePurposeToken(t, token.PurposeMFAEnroll); err == nil {
+			if err := a.ValidateClaims(claims); err != nil {
+				c.JSON(http.StatusUnauthorized, web.ExceptResponse(http.StatusUnauthorized, err))
+				c.Abort()
+				return
+			}
+			c.Set(web.CurrentUser, claims)
+			c.Set(mfaEnrollKey, true)
+			c.Next()
+			return
+		}
+		login(c)
+	}
+}
+
+// EnrollMFA 生成新的密钥，确认前不会生效
+func (a *Authn) EnrollMFA(c *gin.Context) {
+	user, ok := a.mfaUser(c)
+	if !ok {
+		return
+	}
+	if user.MFAEnabled {
+		c.JSON(http.StatusOK, web.ExceptResponse(errorMap[ErrMFAAlreadyEnabled], ErrMFAAlreadyEnabled))
+		return
+	}
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		c.JSON(http.StatusOK, web.ExceptResponse(errorMap[ErrMFAFailed], err))
+		return
+	}
+	if err := a.Store.Update(context.TODO(), user.ID, "", &models.User{},
+		map[string]interface{}{"mfa_secret": secret, "mfa_last_step": 0}); err != nil {
+		c.JSON(http.StatusOK, web.ExceptResponse(errorMap[ErrMFAFailed], err))
+		return
+	}
+	c.JSON(http.StatusOK, web.DataResponse(MFAEnrollment{
+		Secret: secret,
+		URI:    totp.URI(config.Read().MFA.Issuer, user.Name, secret),
+	}))
+}
+
+// ConfirmMFA 使用第一个验证码确认绑定，开启两步验证并返回恢复码
+func (a *Authn) ConfirmMFA(c *gin.Context) {
+	var f MFACodeForm
+	if err := c.ShouldBindJSON(&f); err != nil || f.Code == "" {
+		c.JSON(http.StatusBadRequest, web.ExceptResponse(errorMap[ErrInvalidParam], "code is required"))
+		return
+	}
+	user, ok := a.mfaUser(c)
+	if !ok {
+		return
+	}
+	if user.MFAEnabled {
+		c.JSON(http.StatusOK, web.ExceptResponse(errorMap[ErrMFAAlreadyEnabled], ErrMFAAlreadyEnabled))
+		return
+	}
+	if user.MFASecret == "" {
+		c.JSON(http.StatusOK, web.ExceptResponse(errorMap[ErrMFANotEnrolled], ErrMFANotEnrolled))
+		return
+	}
+	if !a.checkMFACode(c, user, f.Code, "") {
+		return
+	}
+	if err := a.Store.Update(context.TODO(), user.ID, "", &models.User{},
+		map[string]interface{}{"mfa_enabled": true}); err != nil {
+		c.JSON(http.StatusOK, web.ExceptResponse(errorMap[ErrMFAFailed], err))
+		return
+	}
+	codes, err := a.resetRecoveryCodes(user.ID)
+	if err != nil {
+		c.JSON(http.StatusOK, web.ExceptResponse(errorMap[ErrMFAFailed], err))
+		return
+	}
+	resp := MFARecoveryCodes{RecoveryCodes: codes}
+	// 强制绑定的情况下，绑定完成即登录完成
+	if c.GetBool(mfaEnrollKey) {
+		if err := a.issueToken(c, user, nil); err != nil {
+			c.JSON(http.StatusOK, web.ExceptResponse(errorMap[ErrGenerateToken], err))
+			return
+		}
+		user.MFAEnabled = true
+		user.TruncatePassword()
+		resp.User = user
+	}
+	c.JSON(http.StatusOK, web.DataResponse(resp))
+}
+
+// DisableMFA 用户关闭自己的两步验证，需要提供验证码或恢复码
+func (a *Authn) DisableMFA(c *gin.Context) {
+	var f MFACodeForm
+	if err := c.ShouldBindJSON(&f); err != nil {
+		c.JSON(http.StatusBadRequest, web.ExceptResponse(errorMap[ErrInvalidParam], err))
+		return
+	}
+	user, ok := a.mfaUser(c)
+	if !ok {
+		return
+	}
+	if !user.MFAEnabled {
+		c.JSON(http.StatusOK, web.ExceptResponse(errorMap[ErrMFANotEnrolled], ErrMFANotEnrolled))
+		return
+	}
+	if user.Admin && config.Read().MFA.RequireAdmin {
+		c.JSON(http.StatusOK, web.ExceptResponse(errorMap[ErrMFARequired], ErrMFARequired))
+		return
+	}
+	if !a.checkMFACode(c, user, f.Code, f.RecoveryCode) {
+		return
+	}
+	if err := a.clearMFA(user.ID); err != nil {
+		c.JSON(http.StatusOK, web.ExceptResponse(errorMap[ErrMFAFailed], err))
+		return
+	}
+	c.JSON(http.StatusOK, web.OkResponse())
+}
+
+// RegenerateRecoveryCodes 重新生成恢复码，之前的恢复码全部失效
+func (a *Authn) RegenerateRecoveryCodes(c *gin.Context) {
+	var f MFACodeForm
+	if err := c.ShouldBindJSON(&f); err != nil || f.Code == "" {
+		c.JSON(http.StatusBadRequest, web.ExceptResponse(errorMap[ErrInvalidParam], "code is required"))
+		return
+	}
+	user, ok := a.mfaUser(c)
+	if !ok {
+		return
+	}
+	if !user.MFAEnabled {
+		c.JSON(http.StatusOK, web.ExceptResponse(errorMap[ErrMFANotEnrolled], ErrMFANotEnrolled))
+		return
+	}
+	if !a.checkMFACode(c, user, f.Code, "") {
+		return
+	}
+	codes, err := a.resetRecoveryCodes(user.ID)
+	if err != nil {
+		c.JSON(http.StatusOK, web.ExceptResponse(errorMap[ErrMFAFailed], err))
+		return
+	}
+	c.JSON(http.StatusOK, web.DataResponse(MFARecoveryCodes{RecoveryCodes: codes}))
+}
+
+// ResetMFA 管理员重置用户的两步验证，用户丢失认证器时使用
+func (a *Authn) ResetMFA(c *gin.Context) {
+	id, err := view.GetID(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, web.ExceptResponse(errorMap[ErrInvalidParam], err))
+		return
+	}
+	log.Infow("reset user mfa", "user", id, "operator", web.GetCurrentUser(c).Name)
+	if err := a.clearMFA(id); err != nil {
+		c.JSON(http.StatusOK, web.ExceptResponse(errorMap[ErrMFAFailed], err))
+		return
+	}
+	c.JSON(http.StatusOK, web.OkResponse())
+}
+
+// mfaUser 获取当前登录的用户，访问令牌不能管理两步验证
+func (a *Authn) mfaUser(c *gin.Context) (*models.User, bool) {
+	u := web.GetCurrentUser(c)
+	if u.IsAccessToken() {
+		c.JSON(http.StatusForbidden, web.ExceptResponse(http.StatusForbidden, "access token can not manage mfa"))
+		return nil, false
+	}
+	var user models.User
+	if err := a.Store.Get(context.TODO(), u.ID, "", &user); err != nil {
+		c.JSON(http.StatusOK, web.ExceptResponse(errorMap[ErrMFAFailed], err))
+		return nil, false
+	}
+	return &user, true
+}
+
+// checkMFACode 校验验证码或恢复码，验证码的时间步和恢复码都只能使用一次
+func (a *Authn) checkMFACode(c *gin.Context, user *models.User, code, recoveryCode string) bool {
+	if code != "" {
+		step, ok := totp.Validate(user.MFASecret, code, time.Now())
+		if ok && step > user.MFALastStep {
+			ok, err := a.Store.CompareAndUpdate(context.TODO(), user.ID, "mfa_last_step", user.MFALastStep,
+				&models.User{}, map[string]interface{}{"mfa_last_step": step})
+			if err != nil {
+				c.JSON(http.StatusOK, web.ExceptResponse(errorMap[ErrMFAFailed], err))
+				return false
+			}
+			if ok {
+				user.MFALastStep = step
+				return true
+			}
+		}
+	} else if recoveryCode != "" {
+		var rc models.MFARecoveryCode
+		err := a.Store.GetBy(context.TODO(), "hash", models.RecoveryCodeHash(recoveryCode), &rc)
+		if err == nil && rc.UserID == user.ID && !rc.Used {
+			ok, err := a.Store.CompareAndUpdate(context.TODO(), rc.ID, "used", false,
+				&models.MFARecoveryCode{}, map[string]interface{}{"used": true})
+			if err != nil {
+				c.JSON(http.StatusOK, web.ExceptResponse(errorMap[ErrMFAFailed], err))
+				return false
+			}
+			if ok {
+				log.Infow("mfa recovery code used", "user", user.Name)
+				return true
+			}
+		}
+	}
+	c.JSON(http.StatusOK, web.ExceptResponse(errorMap[ErrMFACodeInvalid], ErrMFACodeInvalid))
+	return false
+}
+
+// resetRecoveryCodes 删除旧的恢复码并生成新的恢复码
+func (a *Authn) resetRecoveryCodes(id uint) ([]string, error) {
+	codes, records, err := models.NewRecoveryCodes(id)
+	if err != nil {
+		return nil, err
+	}
+	if err := a.Store.DeleteWhere(context.TODO(), &models.MFARecoveryCode{}, "user_id = ?", id); err != nil {
+		return nil, err
+	}
+	if err := a.Store.Create(context.TODO(), &records); err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+// clearMFA 关闭两步验证并删除密钥和恢复码
+func (a *Authn) clearMFA(id uint) error {
+	if err := a.Store.Update(context.TODO(), id, "", &models.User{},
+		map[string]interface{}{"mfa_enabled": false, "mfa_secret": "", "mfa_last_step": 0}); err != nil {
+		return err
+	}
+	return a.Store.DeleteWhere(context.TODO(), &models.MFARecoveryCode{}, "user_id = ?", id)
+}
@@ -0,0 +1,184 @@
+package authentication
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/fize/go-ext/log"
+	"github.com/gin-gonic/gin"
+	"github.com/hex-techs/blade/pkg/models"
+	"github.com/hex-techs/blade/pkg/utils/config"
+	"github.com/hex-techs/blade/pkg/utils/oidc"
+	"github.com/hex-techs/blade/pkg/utils/token"
+	"github.com/hex-techs/blade/pkg/utils/web"
+	"github.com/hex-techs/blade/pkg/view"
+	"gorm.io/gorm"
+)
+
+const (
+	// 保存state、nonce和PKCE verifier的cookie
+	oidcCookie = "blade_oidc"
+	// cookie的作用路径
+	oidcCookiePath = "/api/v1/auth/oidc"
+)
+
+// OidcLogin 跳转到issuer进行授权码+PKCE登录
+func (a *Authn) OidcLogin(c *gin.Context) {
+	if !oidc.Enabled() {
+		c.JSON(http.StatusOK, web.ExceptResponse(errorMap[ErrOidcDisabled], ErrOidcDisabled))
+		return
+	}
+	var values [3]string
+	for i := range values {
+		v, err := token.RandomString(32)
+		if err != nil {
+			c.JSON(http.StatusOK, web.ExceptResponse(errorMap[ErrOther], err))
+			return
+		}
+		values[i] = v
+	}
+	state, nonce, verifier := values[0], values[1], values[2]
+	url, err := oidc.AuthCodeURL(c.Request.Context(), state, nonce, verifier)
+	if err != nil {
+		c.JSON(http.StatusOK, web.ExceptResponse(errorMap[ErrOidcFailed], err))
+		return
+	}
+	c.SetSameSite(http.SameSiteLaxMode)
+	c.SetCookie(oidcCookie, strings.Join(values[:], "."), int(config.Read().Service.URLExpired),
+		oidcCookiePath, "", c.Request.TLS != nil, true)
+	c.Redirect(http.StatusFound, url)
+}
+
+// OidcCallback 校验issuer的回调，创建或刷新本地用户后返回token
+func (a *Authn) OidcCallback(c *gin.Context) {
+	if !oidc.Enabled() {
+		c.JSON(http.StatusOK, web.ExceptResponse(errorMap[ErrOidcDisabled], ErrOidcDisabled))
+		return
+	}
+	if e := c.Query("error"); e != "" {
+		c.JSON(http.StatusOK, web.ExceptResponse(errorMap[ErrOidcFailed], e, ": ", c.Query("error_description")))
+		return
+	}
+	cookie, err := c.Cookie(oidcCookie)
+	// state只能使用一次
+	c.SetCookie(oidcCookie, "", -1, oidcCookiePath, "", c.Request.TLS != nil, true)
+	values := strings.Split(cookie, ".")
+	if err != nil || len(values) != 3 ||
+		subtle.ConstantTimeCompare([]byte(values[0]), []byte(c.Query("state"))) != 1 {
+		c.JSON(http.StatusOK, web.ExceptResponse(errorMap[ErrOidcStateInvalid], ErrOidcStateInvalid))
+		return
+	}
+	id, err := oidc.Exchange(c.Request.Context(), c.Query("code"), values[2], values[1])
+	if err != nil {
+		c.JSON(http.StatusOK, web.ExceptResponse(errorMap[ErrOidcFailed], err))
+		return
+	}
+	log.Debugw("oidc login", "subject", id.Subject, "name", id.Name, "groups", id.Groups)
+	user, err := a.syncOidcUser(id)
+	if errors.Is(err, errSourceConflict) {
+		log.Warnw("oidc user conflicts with existing account", "name", id.Name, "subject", id.Subject)
+		c.JSON(http.StatusOK, web.ExceptResponse(errorMap[ErrSourceConflict], ErrSourceConflict))
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusOK, web.ExceptResponse(errorMap[ErrOidcFailed], err))
+		return
+	}
+	if err := view.SyncGroups(a.Store, user.ID, models.SourceOidc, id.Groups); err != nil {
+		c.JSON(http.StatusOK, web.ExceptResponse(errorMap[ErrOidcFailed], err))
+		return
+	}
+	a.respondLogin(c, user)
+}
+
+// syncOidcUser 按issuer和subject查找用户，首次登录时创建或关联用户，之后每次登录刷新信息，配置了AdminClaim时同步管理员状态
+func (a *Authn) syncOidcUser(id *oidc.Identity) (*models.User, error) {
+	// 内置管理员只能本地登录
+	if id.Name == models.AdminName {
+		return nil, errors.New("builtin administrator can not login with oidc")
+	}
+	user, err := a.findOidcUser(id)
+	if err != nil {
+		return nil, err
+	}
+	if user == nil {
+		user = &models.User{
+			Name:        id.Name,
+			CnName:      id.CnName,
+			Email:       id.Email,
+			Admin:       id.Admin,
+			Source:      models.SourceOidc,
+			OidcIssuer:  id.Issuer,
+			OidcSubject: &id.Subject,
+		}
+		log.Infow("create user from oidc", "name", id.Name, "subject", id.Subject)
+		if err := a.Store.Create(context.TODO(), user); err != nil {
+			return nil, err
+		}
+		return user, nil
+	}
+	// 只更新变化的字段，关联的本地用户保留原来的来源
+	updates := map[string]interface{}{}
+	if user.OidcSubject == nil {
+		log.Infow("link user to oidc", "name", user.Name, "source", user.Source, "subject", id.Subject)
+		updates["oidc_issuer"], updates["oidc_subject"] = id.Issuer, id.Subject
+	}
+	if id.CnName != "" && id.CnName != user.CnName {
+		updates["cn_name"] = id.CnName
+	}
+	if id.Email != "" && id.Email != user.Email {
+		updates["email"] = id.Email
+	}
+	demoted := false
+	if config.Read().Oidc.AdminClaim != "" && id.Admin != user.Admin {
+		updates["admin"] = id.Admin
+		demoted = !id.Admin
+	}
+	if len(updates) > 0 {
+		if err := a.Store.Update(context.TODO(), user.ID, "", &models.User{}, updates); err != nil {
+			return nil, err
+		}
+	}
+	// 身份源取消管理员后，之前签发的管理员token全部失效
+	if demoted {
+		log.Infow("revoke tokens of demoted oidc user", "name", user.Name)
+		if err := view.RevokeUserTokens(a.Store, user.ID); err != nil {
+			return nil, err
+		}
+	}
+	return user, a.Store.Get(context.TODO(), user.ID, "", user)
+}
+
+// findOidcUser 先按issuer和subject查找，找不到时查找可以关联的同名用户，都没有时返回nil
+func (a *Authn) findOidcUser(id *oidc.Identity) (*models.User, error) {
+	var users []models.User
+	if err := a.Store.FindWhere(context.TODO(), &users, "oidc_issuer = ? AND oidc_subject = ?",
+		id.Issuer, id.Subject); err != nil {
+		return nil, err
+	}
+	if len(users) > 0 {
+		return &users[0], nil
+	}
+	var user models.User
+	err := a.Store.Get(context.TODO(), 0, id.Name, &user)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	// 同名用户已关联其他subject，用户名在身份源中被复用
+	case user.OidcSubject != nil:
+	// 保存subject之前创建的oidc用户，首次登录时关联
+	case user.Source == models.SourceOidc:
+		return &user, nil
+	// 同名的本地用户只有明确配置后才能关联
+	case user.Source == models.SourceLocal && config.Read().Oidc.LinkLocalAccounts:
+		return &user, nil
+	}
+	return nil, errSourceConflict
+}
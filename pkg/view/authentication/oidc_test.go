@@ -0,0 +1,381 @@
+package authentication
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-jose/go-jose/v3"
+	"github.com/hex-techs/blade/pkg/models"
+	"github.com/hex-techs/blade/pkg/utils/config"
+	"github.com/hex-techs/blade/pkg/utils/token"
+	"github.com/hex-techs/blade/pkg/utils/web"
+)
+
+const (
+	testOidcClientID = "blade"
+	testOidcRedirect = "http://blade.test/api/v1/auth/oidc/callback"
+)
+
+// oidcGrant 授权后签发的id token内容
+type oidcGrant struct {
+	// id token中的subject
+	sub string
+	// 额外的claims
+	claims map[string]interface{}
+	// 不为空时替换授权请求中的nonce
+	nonce string
+	// 不为空时使用该密钥签名，模拟伪造的id token
+	key *rsa.PrivateKey
+}
+
+// authRequest 授权请求中需要在换取token时校验的参数
+type authRequest struct {
+	grant     oidcGrant
+	nonce     string
+	challenge string
+}
+
+// mockIssuer 本地的oidc issuer，实现discovery、JWKS和授权码换取token
+type mockIssuer struct {
+	srv   *httptest.Server
+	key   *rsa.PrivateKey
+	mu    sync.Mutex
+	codes map[string]*authRequest
+}
+
+func newMockIssuer(t *testing.T) *mockIssuer {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := &mockIssuer{key: key, codes: map[string]*authRequest{}}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, map[string]interface{}{
+			"issuer":                                m.srv.URL,
+			"authorization_endpoint":                m.srv.URL + "/authorize",
+			"token_endpoint":                        m.srv.URL + "/token",
+			"jwks_uri":                              m.srv.URL + "/keys",
+			"id_token_signing_alg_values_supported": []string{"RS256"},
+		})
+	})
+	mux.HandleFunc("/keys", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, jose.JSONWebKeySet{Keys: []jose.JSONWebKey{
+			{Key: &m.key.PublicKey, KeyID: "k1", Algorithm: "RS256", Use: "sig"},
+		}})
+	})
+	mux.HandleFunc("/token", m.token)
+	m.srv = httptest.NewServer(mux)
+	t.Cleanup(m.srv.Close)
+	return m
+}
+
+// authorize 模拟用户在issuer完成授权，校验授权地址后返回授权码
+func (m *mockIssuer) authorize(t *testing.T, location string, grant oidcGrant) string {
+	t.Helper()
+	u, err := url.Parse(location)
+	if err != nil {
+		t.Fatal(err)
+	}
+	q := u.Query()
+	if got := u.Scheme + "://" + u.Host + u.Path; got != m.srv.URL+"/authorize" {
+		t.Fatalf("redirected to %s", got)
+	}
+	if q.Get("client_id") != testOidcClientID || q.Get("redirect_uri") != testOidcRedirect ||
+		q.Get("response_type") != "code" || !strings.Contains(q.Get("scope"), "openid") {
+		t.Fatalf("invalid authorization request %s", location)
+	}
+	if q.Get("code_challenge_method") != "S256" || q.Get("code_challenge") == "" || q.Get("nonce") == "" {
+		t.Fatalf("authorization request without pkce or nonce %s", location)
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	code := fmt.Sprintf("code-%d", len(m.codes)+1)
+	m.codes[code] = &authRequest{grant: grant, nonce: q.Get("nonce"), challenge: q.Get("code_challenge")}
+	return code
+}
+
+// token 授权码只能使用一次，code_verifier必须与授权时的code_challenge匹配
+func (m *mockIssuer) token(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_request"})
+		return
+	}
+	m.mu.Lock()
+	req, ok := m.codes[r.PostForm.Get("code")]
+	delete(m.codes, r.PostForm.Get("code"))
+	m.mu.Unlock()
+	sum := sha256.Sum256([]byte(r.PostForm.Get("code_verifier")))
+	if !ok || r.PostForm.Get("grant_type") != "authorization_code" ||
+		base64.RawURLEncoding.EncodeToString(sum[:]) != req.challenge {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_grant"})
+		return
+	}
+	claims := map[string]interface{}{
+		"iss":   m.srv.URL,
+		"sub":   req.grant.sub,
+		"aud":   testOidcClientID,
+		"iat":   time.Now().Unix(),
+		"exp":   time.Now().Add(time.Minute).Unix(),
+		"nonce": req.nonce,
+	}
+	if req.grant.nonce != "" {
+		claims["nonce"] = req.grant.nonce
+	}
+	for k, v := range req.grant.claims {
+		claims[k] = v
+	}
+	key := m.key
+	if req.grant.key != nil {
+		key = req.grant.key
+	}
+	idToken, err := sign(key, claims)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"access_token": "access-token",
+		"token_type":   "Bearer",
+		"expires_in":   60,
+		"id_token":     idToken,
+	})
+}
+
+func sign(key *rsa.PrivateKey, claims map[string]interface{}) (string, error) {
+	signer, err := jose.NewSigner(jose.SigningKey{Algorithm: jose.RS256, Key: jose.JSONWebKey{Key: key, KeyID: "k1"}},
+		(&jose.SignerOptions{}).WithType("JWT"))
+	if err != nil {
+		return "", err
+	}
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+	jws, err := signer.Sign(payload)
+	if err != nil {
+		return "", err
+	}
+	return jws.CompactSerialize()
+}
+
+func writeJSON(w http.ResponseWriter, code int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(v)
+}
+
+// oidcResult 回调接口的响应
+type oidcResult struct {
+	State web.State   `json:"state"`
+	Data  models.User `json:"data"`
+}
+
+// newOidcAuthn 启动本地issuer，并开启oidc登录
+func newOidcAuthn(t *testing.T) (*Authn, *mockIssuer, *gin.Engine) {
+	t.Helper()
+	m := newMockIssuer(t)
+	a := newTestAuthn(t, fmt.Sprintf("oidc:\n  enabled: true\n  issuer: %s\n  clientID: %s\n  clientSecret: secret\n"+
+		"  redirectURL: %s\n  scopes: [\"profile\", \"email\", \"groups\"]\n  adminClaim: groups\n"+
+		"  adminValues: [\"blade-admins\"]\n", m.srv.URL, testOidcClientID, testOidcRedirect))
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.GET("/api/v1/auth/oidc/login", a.OidcLogin)
+	r.GET("/api/v1/auth/oidc/callback", a.OidcCallback)
+	return a, m, r
+}
+
+// oidcLogin 走完整的登录流程，state为空时使用跳转地址中的state
+func oidcLogin(t *testing.T, m *mockIssuer, r *gin.Engine, grant oidcGrant, state string) oidcResult {
+	t.Helper()
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/v1/auth/oidc/login", nil))
+	location := w.Header().Get("Location")
+	if w.Code != http.StatusFound || location == "" {
+		t.Fatalf("login: code %d, body %s", w.Code, w.Body.String())
+	}
+	code := m.authorize(t, location, grant)
+	if state == "" {
+		u, _ := url.Parse(location)
+		state = u.Query().Get("state")
+	}
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/auth/oidc/callback?"+
+		url.Values{"code": {code}, "state": {state}}.Encode(), nil)
+	for _, c := range w.Result().Cookies() {
+		req.AddCookie(c)
+	}
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	var result oidcResult
+	if err := json.Unmarshal(w.Body.Bytes(), &result); err != nil {
+		t.Fatalf("callback: %v, body %s", err, w.Body.String())
+	}
+	return result
+}
+
+func grantFor(sub, name string, groups ...string) oidcGrant {
+	return oidcGrant{sub: sub, claims: map[string]interface{}{
+		"preferred_username": name,
+		"email":              name + "@example.com",
+		"name":               strings.ToUpper(name),
+		"groups":             groups,
+	}}
+}
+
+func expectOidcError(t *testing.T, result oidcResult, errKey string) {
+	t.Helper()
+	if result.State.Code != errorMap[errKey] {
+		t.Fatalf("state %+v, want %q", result.State, errKey)
+	}
+}
+
+func TestOidcLogin(t *testing.T) {
+	a, m, r := newOidcAuthn(t)
+	result := oidcLogin(t, m, r, grantFor("sub-alice", "alice", "dev", "blade-admins"), "")
+	if result.State.Code != 0 || result.Data.Token == nil || result.Data.Token.Token == "" {
+		t.Fatalf("login failed: %+v", result.State)
+	}
+	claims, err := token.ParseJWTToken(result.Data.Token.Token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := a.ValidateClaims(claims); err != nil {
+		t.Fatalf("issued token invalid: %v", err)
+	}
+	var user models.User
+	if err := a.Store.Get(context.TODO(), claims.ID, "", &user); err != nil {
+		t.Fatal(err)
+	}
+	if user.Name != "alice" || user.Email != "alice@example.com" || user.CnName != "ALICE" ||
+		user.Source != models.SourceOidc || !user.Admin || !claims.Admin {
+		t.Fatalf("unexpected user %+v", user)
+	}
+	if user.OidcIssuer != m.srv.URL || user.OidcSubject == nil || *user.OidcSubject != "sub-alice" {
+		t.Fatalf("oidc identity not stored: %q %v", user.OidcIssuer, user.OidcSubject)
+	}
+	if got := groupsOf(t, a, user.ID); strings.Join(got, ",") != "blade-admins,dev" {
+		t.Fatalf("groups = %v", got)
+	}
+}
+
+func TestOidcLoginRejected(t *testing.T) {
+	_, m, r := newOidcAuthn(t)
+	forged, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	grant := grantFor("sub-alice", "alice")
+	cases := []struct {
+		name   string
+		modify func(*oidcGrant)
+		state  string
+		errKey string
+	}{
+		{"state mismatch", func(*oidcGrant) {}, "forged-state", ErrOidcStateInvalid},
+		{"nonce mismatch", func(g *oidcGrant) { g.nonce = "replayed-nonce" }, "", ErrOidcFailed},
+		{"forged signature", func(g *oidcGrant) { g.key = forged }, "", ErrOidcFailed},
+		{"missing username", func(g *oidcGrant) { g.claims = map[string]interface{}{} }, "", ErrOidcFailed},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			g := grant
+			c.modify(&g)
+			expectOidcError(t, oidcLogin(t, m, r, g, c.state), c.errKey)
+		})
+	}
+}
+
+func TestOidcAdminDemotion(t *testing.T) {
+	a, m, r := newOidcAuthn(t)
+	first := oidcLogin(t, m, r, grantFor("sub-alice", "alice", "blade-admins"), "")
+	if first.State.Code != 0 || !first.Data.Admin {
+		t.Fatalf("admin login failed: %+v", first)
+	}
+	old, err := token.ParseJWTToken(first.Data.Token.Token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 身份源中移出管理员组后，再次登录时取消管理员，之前签发的token失效
+	second := oidcLogin(t, m, r, grantFor("sub-alice", "alice", "dev"), "")
+	if second.State.Code != 0 || second.Data.Admin {
+		t.Fatalf("demoted login failed: %+v", second)
+	}
+	if err := a.ValidateClaims(old); err == nil {
+		t.Fatal("admin token still valid after demotion")
+	}
+	current, err := token.ParseJWTToken(second.Data.Token.Token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := a.ValidateClaims(current); err != nil || current.Admin {
+		t.Fatalf("new token admin %v, err %v", current.Admin, err)
+	}
+}
+
+func TestOidcSubjectBinding(t *testing.T) {
+	_, m, r := newOidcAuthn(t)
+	first := oidcLogin(t, m, r, grantFor("sub-alice", "alice"), "")
+	if first.State.Code != 0 {
+		t.Fatalf("login failed: %+v", first.State)
+	}
+	// 身份源中修改了用户名，仍然按subject找到原来的用户
+	renamed := oidcLogin(t, m, r, grantFor("sub-alice", "alice2"), "")
+	if renamed.State.Code != 0 || renamed.Data.ID != first.Data.ID || renamed.Data.Name != "alice" {
+		t.Fatalf("renamed login: %+v, %+v", renamed.State, renamed.Data)
+	}
+	// 其他subject复用了用户名，不能接管原来的用户
+	expectOidcError(t, oidcLogin(t, m, r, grantFor("sub-mallory", "alice"), ""), ErrSourceConflict)
+}
+
+func TestOidcLinkExistingUser(t *testing.T) {
+	a, m, r := newOidcAuthn(t)
+	local := models.User{Name: "bob", CnName: "本地", Email: "bob@local", Source: models.SourceLocal, Enabled: true}
+	legacy := models.User{Name: "carol", CnName: "carol", Email: "carol@old", Source: models.SourceOidc, Enabled: true}
+	for _, u := range []*models.User{&local, &legacy} {
+		if err := a.Store.Create(context.TODO(), u); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// 保存subject之前创建的oidc用户，首次登录时关联
+	result := oidcLogin(t, m, r, grantFor("sub-carol", "carol"), "")
+	if result.State.Code != 0 || result.Data.ID != legacy.ID || result.Data.Email != "carol@example.com" {
+		t.Fatalf("legacy user not linked: %+v, %+v", result.State, result.Data)
+	}
+
+	// 同名的本地用户默认不能关联
+	expectOidcError(t, oidcLogin(t, m, r, grantFor("sub-bob", "bob"), ""), ErrSourceConflict)
+	var saved models.User
+	if err := a.Store.Get(context.TODO(), local.ID, "", &saved); err != nil {
+		t.Fatal(err)
+	}
+	if saved.OidcSubject != nil || saved.Email != "bob@local" {
+		t.Fatalf("local user was modified: %+v", saved)
+	}
+
+	// 配置后关联本地用户，保留原来的来源
+	config.Read().Oidc.LinkLocalAccounts = true
+	result = oidcLogin(t, m, r, grantFor("sub-bob", "bob"), "")
+	if result.State.Code != 0 || result.Data.ID != local.ID || result.Data.Source != models.SourceLocal {
+		t.Fatalf("local user not linked: %+v, %+v", result.State, result.Data)
+	}
+	if err := a.Store.Get(context.TODO(), local.ID, "", &saved); err != nil {
+		t.Fatal(err)
+	}
+	if saved.OidcSubject == nil || *saved.OidcSubject != "sub-bob" || saved.Password != local.Password {
+		t.Fatalf("local user link not stored: %+v", saved)
+	}
+}
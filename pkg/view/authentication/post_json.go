@@ -14,13 +14,13 @@ type ForgetPasswordForm struct {
 // 修改密码表单
 type ChangePasswordForm struct {
 	OldPassword        string `json:"oldPassword" binding:"required"`
-	NewPassword        string `json:"newPassword" binding:"required,nefield=OldPassword,min=6"`
+	NewPassword        string `json:"newPassword" binding:"required,nefield=OldPassword"`
 	NewPasswordConfirm string `json:"newPasswordConfirm" binding:"eqfield=NewPassword"`
 }
 
 // 重置密码表单
 type ResetPasswordForm struct {
-	Password        string `json:"password" binding:"required,min=6"`
+	Password        string `json:"password" binding:"required"`
 	PasswordConfirm string `json:"passwordConfirm" binding:"eqfield=Password"`
 	Token           string `json:"token" binding:"required"`
 }
@@ -28,10 +28,59 @@ type ResetPasswordForm struct {
 // 注册表单
 type RegisterForm struct {
 	Email     string `json:"email" binding:"required,email"`
-	Name      string `json:"name" binding:"required"`
-	Password  string `json:"password" binding:"required,min=6"`
+	Name      string `json:"name" binding:"required,excludes=:"`
+	Password  string `json:"password" binding:"required"`
 	Password2 string `json:"password2" binding:"eqfield=Password"`
 	CnName    string `json:"cnName" binding:"required"`
 	Phone     string `json:"phone"`
 	IM        string `json:"im"`
+	// 邀请令牌，邀请注册模式下必填
+	InviteToken string `json:"inviteToken"`
+}
+
+// 重新发送验证邮件表单
+type ResendVerifyEmailForm struct {
+	Name string `json:"name" binding:"required"`
+}
+
+// 刷新token表单
+type RefreshForm struct {
+	RefreshToken string `json:"refreshToken" binding:"required"`
+}
+
+// 两步验证表单，code和recoveryCode二选一
+type MFAVerifyForm struct {
+	MFAToken     string `json:"mfaToken" binding:"required"`
+	Code         string `json:"code"`
+	RecoveryCode string `json:"recoveryCode"`
+}
+
+// 验证码表单
+type MFACodeForm struct {
+	Code         string `json:"code"`
+	RecoveryCode string `json:"recoveryCode"`
+}
+
+// 会话查询参数，管理员可以指定用户
+type SessionQuery struct {
+	UserID uint `form:"userID"`
+}
+
+// 模拟登录表单
+type ImpersonateForm struct {
+	// 模拟的原因，记录在审计日志中
+	Reason string `json:"reason" binding:"required"`
+}
+
+// 审计日志查询参数
+type AuditLogQuery struct {
+	// 按真实操作人过滤
+	ActorID uint `form:"actorID"`
+	// 按生效的用户过滤
+	UserID uint `form:"userID"`
+	// 按操作类型过滤
+	Action string `form:"action" binding:"omitempty,oneof=impersonate impersonated_request access_request access_approve access_deny access_cancel access_revoke access_expire email_change"`
+	// 按资源过滤，如 resource=accessrequest&resourceID=1
+	Resource   string `form:"resource" binding:"omitempty,oneof=accessrequest user"`
+	ResourceID uint   `form:"resourceID"`
 }
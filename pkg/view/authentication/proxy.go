@@ -0,0 +1,152 @@
+package authentication
+
+import (
+	"context"
+	"errors"
+	"net"
+	"strings"
+
+	"github.com/fize/go-ext/log"
+	"github.com/gin-gonic/gin"
+	"github.com/hex-techs/blade/pkg/models"
+	"github.com/hex-techs/blade/pkg/utils/config"
+	"github.com/hex-techs/blade/pkg/utils/token"
+	"github.com/hex-techs/blade/pkg/utils/web"
+	"github.com/hex-techs/blade/pkg/view"
+	"gorm.io/gorm"
+)
+
+// ProxyAuthenticator 可信反向代理认证，只接受来自可信地址的header，用户不存在时自动创建
+func (a *Authn) ProxyAuthenticator() web.Authenticator {
+	cfg := config.Read().ProxyAuth
+	var trusted []*net.IPNet
+	for _, cidr := range cfg.TrustedCIDRs {
+		// 配置加载时已经校验过
+		if _, n, err := net.ParseCIDR(cidr); err == nil {
+			trusted = append(trusted, n)
+		}
+	}
+	return func(c *gin.Context) (*token.Claims, error) {
+		name := strings.TrimSpace(c.GetHeader(cfg.UserHeader))
+		if name == "" {
+			return nil, nil
+		}
+		// 使用连接的对端地址，X-Forwarded-For可以被伪造
+		if !fromTrusted(trusted, c.Request.RemoteAddr) {
+			log.Warnw("ignore proxy auth header from untrusted address", "remote", c.Request.RemoteAddr, "user", name)
+			return nil, nil
+		}
+		groups := splitGroups(c.GetHeader(cfg.GroupsHeader))
+		user, err := a.syncProxyUser(name, strings.TrimSpace(c.GetHeader(cfg.EmailHeader)), groups)
+		if err != nil {
+			return nil, err
+		}
+		// 禁用和未激活的用户不同步用户组
+		if !user.Enabled {
+			return nil, errors.New(ErrAccountDisabled)
+		}
+		if user.Pending {
+			return nil, errors.New(ErrAccountPending)
+		}
+		if err := view.SyncGroups(a.Store, user.ID, models.SourceProxy, groups); err != nil {
+			return nil, err
+		}
+		return &token.Claims{
+			ID:    user.ID,
+			Name:  user.Name,
+			Admin: user.Admin,
+		}, nil
+	}
+}
+
+// syncProxyUser 根据代理传递的信息即时创建用户，已存在的用户刷新邮箱，配置了AdminGroups时同步管理员状态
+func (a *Authn) syncProxyUser(name, email string, groups []string) (*models.User, error) {
+	// 内置管理员只能本地登录
+	if name == models.AdminName {
+		return nil, errors.New("builtin administrator can not login with proxy auth")
+	}
+	cfg := config.Read().ProxyAuth
+	admin := len(cfg.AdminGroups) > 0 && containsAny(groups, cfg.AdminGroups)
+	var user models.User
+	err := a.Store.Get(context.TODO(), 0, name, &user)
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, err
+	}
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		user = models.User{
+			Name:   name,
+			CnName: name,
+			Email:  email,
+			Admin:  admin,
+			Source: models.SourceProxy,
+		}
+		log.Infow("create user from proxy auth", "name", name, "groups", groups)
+		if err := a.Store.Create(context.TODO(), &user); err != nil {
+			return nil, err
+		}
+		return &user, nil
+	}
+	// 每个请求都会经过这里，只在信息变化时写入
+	updates := map[string]interface{}{}
+	if email != "" && email != user.Email {
+		updates["email"] = email
+	}
+	if len(cfg.AdminGroups) > 0 && admin != user.Admin {
+		updates["admin"] = admin
+	}
+	if len(updates) > 0 {
+		log.Infow("update user from proxy auth", "name", name, "updates", updates)
+		if err := a.Store.Update(context.TODO(), user.ID, "", &models.User{}, updates); err != nil {
+			return nil, err
+		}
+		// 代理传递的用户组中移出管理员组后，该用户通过其他方式获取的管理员token全部失效
+		if _, ok := updates["admin"]; ok && !admin {
+			if err := view.RevokeUserTokens(a.Store, user.ID); err != nil {
+				return nil, err
+			}
+		}
+		if err := a.Store.Get(context.TODO(), user.ID, "", &user); err != nil {
+			return nil, err
+		}
+	}
+	return &user, nil
+}
+
+// fromTrusted 判断连接的对端地址是否在可信地址段中
+func fromTrusted(trusted []*net.IPNet, remote string) bool {
+	host, _, err := net.SplitHostPort(remote)
+	if err != nil {
+		host = remote
+	}
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return false
+	}
+	for _, n := range trusted {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+func splitGroups(s string) []string {
+	var groups []string
+	for _, g := range strings.Split(s, ",") {
+		if g = strings.TrimSpace(g); g != "" {
+			groups = append(groups, g)
+		}
+	}
+	return groups
+}
+
+func containsAny(s, values []string) bool {
+	for _, v := range values {
+		for _, i := range s {
+			if i == v {
+				return true
+			}
+		}
+	}
+	return false
+}
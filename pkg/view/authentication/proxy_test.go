@@ -0,0 +1,71 @@
+package authentication
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/hex-techs/blade/pkg/models"
+)
+
+const testProxyConfig = "proxyAuth:\n  enabled: true\n  trustedCIDRs: [\"127.0.0.1/32\"]\n"
+
+// proxyLogin 模拟可信代理传递用户名和用户组的请求
+func proxyLogin(a *Authn, name, groups string) error {
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = httptest.NewRequest(http.MethodGet, "/api/v1/users/me", nil)
+	c.Request.RemoteAddr = "127.0.0.1:40000"
+	c.Request.Header.Set("X-Forwarded-User", name)
+	c.Request.Header.Set("X-Forwarded-Groups", groups)
+	_, err := a.ProxyAuthenticator()(c)
+	return err
+}
+
+// groupNames 用户所在的用户组
+func groupNames(t *testing.T, a *Authn, userID uint) map[string]bool {
+	t.Helper()
+	var members []models.GroupMember
+	if err := a.Store.FindWhere(context.TODO(), &members, "user_id = ?", userID); err != nil {
+		t.Fatal(err)
+	}
+	names := map[string]bool{}
+	for _, m := range members {
+		var g models.Group
+		if err := a.Store.Get(context.TODO(), m.GroupID, "", &g); err != nil {
+			t.Fatal(err)
+		}
+		names[g.Name] = true
+	}
+	return names
+}
+
+func TestProxyInactiveUserKeepsGroups(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	a := newTestAuthn(t, testProxyConfig)
+	if err := proxyLogin(a, "alice", "dev"); err != nil {
+		t.Fatal(err)
+	}
+	var alice models.User
+	if err := a.Store.Get(context.TODO(), 0, "alice", &alice); err != nil {
+		t.Fatal(err)
+	}
+	if got := groupNames(t, a, alice.ID); len(got) != 1 || !got["dev"] {
+		t.Fatalf("groups %v, want dev", got)
+	}
+
+	// 禁用和未激活的用户被拒绝，用户组保持不变
+	for field, want := range map[string]string{"enabled": ErrAccountDisabled, "pending": ErrAccountPending} {
+		updates := map[string]interface{}{"enabled": field != "enabled", "pending": field == "pending"}
+		if err := a.Store.Update(context.TODO(), alice.ID, "", &models.User{}, updates); err != nil {
+			t.Fatal(err)
+		}
+		if err := proxyLogin(a, "alice", "ops"); err == nil || err.Error() != want {
+			t.Fatalf("%s: error %v, want %s", field, err, want)
+		}
+		if got := groupNames(t, a, alice.ID); len(got) != 1 || !got["dev"] {
+			t.Fatalf("%s: groups %v, want dev", field, got)
+		}
+	}
+}
@@ -0,0 +1,106 @@
+package authentication
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/fize/go-ext/log"
+	"github.com/gin-gonic/gin"
+	"github.com/hex-techs/blade/pkg/models"
+	"github.com/hex-techs/blade/pkg/utils/token"
+	"github.com/hex-techs/blade/pkg/utils/web"
+	"github.com/hex-techs/blade/pkg/view"
+)
+
+// ListSessions 获取当前用户未过期的会话，管理员可以通过userID查看任意用户
+func (a *Authn) ListSessions(c *gin.Context) {
+	u, id, ok := a.sessionTarget(c)
+	if !ok {
+		return
+	}
+	var sessions []models.Session
+	if err := a.Store.FindWhere(context.TODO(), &sessions, "user_id = ? AND expires_at > ?", id, time.Now()); err != nil {
+		c.JSON(http.StatusOK, web.ExceptResponse(errorMap[ErrSessionFailed], err))
+		return
+	}
+	for i := range sessions {
+		sessions[i].Current = sessions[i].SID == u.SID
+	}
+	c.JSON(http.StatusOK, web.ListResponse(len(sessions), sessions))
+}
+
+// RevokeSession 吊销一个会话，管理员可以吊销任意用户的会话
+func (a *Authn) RevokeSession(c *gin.Context) {
+	u := web.GetCurrentUser(c)
+	if u.IsAccessToken() {
+		c.JSON(http.StatusForbidden, web.ExceptResponse(http.StatusForbidden, "access token can not manage sessions"))
+		return
+	}
+	id, err := view.GetID(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, web.ExceptResponse(errorMap[ErrInvalidParam], err))
+		return
+	}
+	var session models.Session
+	if err := a.Store.Get(context.TODO(), id, "", &session); err != nil {
+		c.JSON(http.StatusOK, web.ExceptResponse(errorMap[ErrSessionNotFound], ErrSessionNotFound))
+		return
+	}
+	if session.UserID != u.ID && !u.Admin {
+		c.JSON(http.StatusOK, web.ExceptResponse(errorMap[ErrSessionOther], ErrSessionOther))
+		return
+	}
+	log.Infow("revoke session", "user", session.UserID, "session", session.ID, "operator", u.Name)
+	if err := view.RevokeSession(a.Store, session.SID); err != nil {
+		c.JSON(http.StatusOK, web.ExceptResponse(errorMap[ErrSessionFailed], err))
+		return
+	}
+	c.JSON(http.StatusOK, web.OkResponse())
+}
+
+// RevokeOtherSessions 吊销当前用户除当前会话外的所有会话，管理员通过userID吊销任意用户的所有会话
+func (a *Authn) RevokeOtherSessions(c *gin.Context) {
+	u, id, ok := a.sessionTarget(c)
+	if !ok {
+		return
+	}
+	var sessions []models.Session
+	if err := a.Store.FindWhere(context.TODO(), &sessions, "user_id = ?", id); err != nil {
+		c.JSON(http.StatusOK, web.ExceptResponse(errorMap[ErrSessionFailed], err))
+		return
+	}
+	log.Infow("revoke other sessions", "user", id, "operator", u.Name)
+	for _, s := range sessions {
+		if s.SID == u.SID {
+			continue
+		}
+		if err := view.RevokeSession(a.Store, s.SID); err != nil {
+			c.JSON(http.StatusOK, web.ExceptResponse(errorMap[ErrSessionFailed], err))
+			return
+		}
+	}
+	c.JSON(http.StatusOK, web.OkResponse())
+}
+
+// sessionTarget 返回当前用户以及要管理的会话所属的用户id
+func (a *Authn) sessionTarget(c *gin.Context) (*token.Claims, uint, bool) {
+	u := web.GetCurrentUser(c)
+	if u.IsAccessToken() {
+		c.JSON(http.StatusForbidden, web.ExceptResponse(http.StatusForbidden, "access token can not manage sessions"))
+		return nil, 0, false
+	}
+	var q SessionQuery
+	if err := c.ShouldBindQuery(&q); err != nil {
+		c.JSON(http.StatusBadRequest, web.ExceptResponse(errorMap[ErrInvalidParam], err))
+		return nil, 0, false
+	}
+	if q.UserID == 0 || q.UserID == u.ID {
+		return u, u.ID, true
+	}
+	if !u.Admin {
+		c.JSON(http.StatusOK, web.ExceptResponse(errorMap[ErrSessionOther], ErrSessionOther))
+		return nil, 0, false
+	}
+	return u, q.UserID, true
+}
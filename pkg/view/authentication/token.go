@@ -0,0 +1,189 @@
+package authentication
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/fize/go-ext/log"
+	"github.com/gin-gonic/gin"
+	"github.com/hex-techs/blade/pkg/models"
+	"github.com/hex-techs/blade/pkg/utils/config"
+	"github.com/hex-techs/blade/pkg/utils/token"
+	"github.com/hex-techs/blade/pkg/utils/web"
+	"github.com/hex-techs/blade/pkg/view"
+)
+
+// Refresh 使用refresh token换取新的token，旧的refresh token同时失效
+func (a *Authn) Refresh(c *gin.Context) {
+	var f RefreshForm
+	if err := c.ShouldBindJSON(&f); err != nil {
+		c.JSON(http.StatusBadRequest, web.ExceptResponse(errorMap[ErrInvalidParam], err))
+		return
+	}
+	var rt models.RefreshToken
+	if err := a.Store.GetBy(context.TODO(), "hash", token.Hash(f.RefreshToken), &rt); err != nil {
+		c.JSON(http.StatusUnauthorized, web.ExceptResponse(errorMap[ErrRefreshTokenInvalid], ErrRefreshTokenInvalid))
+		return
+	}
+	if time.Now().After(rt.ExpiresAt) {
+		c.JSON(http.StatusUnauthorized, web.ExceptResponse(errorMap[ErrRefreshTokenInvalid], ErrRefreshTokenInvalid))
+		return
+	}
+	// 已轮换过的refresh token再次出现，说明令牌可能泄露，吊销整个family
+	ok, err := a.Store.CompareAndUpdate(context.TODO(), rt.ID, "used", false, &models.RefreshToken{},
+		map[string]interface{}{"used": true})
+	if err != nil {
+		c.JSON(http.StatusOK, web.ExceptResponse(errorMap[ErrOther], err))
+		return
+	}
+	if !ok {
+		log.Warnw("refresh token reused, revoke token family", "user", rt.UserID, "family", rt.Family)
+		if err := a.Store.DeleteWhere(context.TODO(), &models.RefreshToken{}, "family = ?", rt.Family); err != nil {
+			log.Errorw("revoke refresh token family error", "family", rt.Family, "error", err)
+		}
+		c.JSON(http.StatusUnauthorized, web.ExceptResponse(errorMap[ErrRefreshTokenInvalid], ErrRefreshTokenInvalid))
+		return
+	}
+	var session models.Session
+	if err := a.Store.GetBy(context.TODO(), "sid", rt.Family, &session); err != nil {
+		c.JSON(http.StatusUnauthorized, web.ExceptResponse(errorMap[ErrRefreshTokenInvalid], ErrRefreshTokenInvalid))
+		return
+	}
+	var user models.User
+	if err := a.Store.Get(context.TODO(), rt.UserID, "", &user); err != nil {
+		c.JSON(http.StatusUnauthorized, web.ExceptResponse(errorMap[ErrRefreshTokenInvalid], err))
+		return
+	}
+	if !user.Enabled {
+		c.JSON(http.StatusUnauthorized, web.ExceptResponse(errorMap[ErrAccountDisabled], ErrAccountDisabled))
+		return
+	}
+	if err := a.issueToken(c, &user, &session); err != nil {
+		c.JSON(http.StatusOK, web.ExceptResponse(errorMap[ErrGenerateToken], err))
+		return
+	}
+	user.TruncatePassword()
+	c.JSON(http.StatusOK, web.DataResponse(user))
+}
+
+// Logout 注销当前会话，会话中签发的token和refresh token全部失效
+func (a *Authn) Logout(c *gin.Context) {
+	u := web.GetCurrentUser(c)
+	// 访问令牌没有会话，无需注销
+	if u.SID != "" {
+		if err := view.RevokeSession(a.Store, u.SID); err != nil {
+			c.JSON(http.StatusOK, web.ExceptResponse(errorMap[ErrLogoutFailed], err))
+			return
+		}
+	}
+	c.JSON(http.StatusOK, web.OkResponse())
+}
+
+// JWKS 公开签名公钥，供其他服务离线校验blade签发的token
+func (a *Authn) JWKS(c *gin.Context) {
+	c.JSON(http.StatusOK, token.PublicKeys())
+}
+
+// ValidateClaims 校验用户是否被禁用，token版本号和管理员状态是否与用户一致，以及token所属的会话是否已吊销
+func (a *Authn) ValidateClaims(claims *token.Claims) error {
+	var user models.User
+	if err := a.Store.Get(context.TODO(), claims.ID, "", &user); err != nil {
+		return errors.New("token user invalid")
+	}
+	if !user.Enabled {
+		return errors.New("user disabled")
+	}
+	if user.TokenVersion != claims.Version {
+		return errors.New("token revoked")
+	}
+	// 特定用途的token不属于任何会话
+	if claims.Purpose != "" {
+		return nil
+	}
+	// 管理员状态变化后，之前签发的token不能继续使用，避免取消管理员后旧token仍有管理员权限
+	if user.Admin != claims.Admin {
+		return errors.New("token admin status changed")
+	}
+	// 模拟登录的token属于管理员的会话，管理员被禁用、取消管理员或会话被吊销后失效
+	if claims.IsImpersonated() {
+		var actor models.User
+		if err := a.Store.Get(context.TODO(), claims.Actor.ID, "", &actor); err != nil ||
+			!actor.Enabled || !actor.Admin {
+			return errors.New("impersonation actor invalid")
+		}
+		return a.touchSession(claims.Actor.SID, actor.ID)
+	}
+	return a.touchSession(claims.SID, user.ID)
+}
+
+// touchSession 校验会话是否存在且属于该用户，并更新最近使用时间
+func (a *Authn) touchSession(sid string, userID uint) error {
+	var session models.Session
+	if sid == "" || a.Store.GetBy(context.TODO(), "sid", sid, &session) != nil || session.UserID != userID {
+		return errors.New("token session revoked")
+	}
+	// 降低写入频率，最近使用时间精确到分钟即可
+	if time.Since(session.LastSeenAt) > time.Minute {
+		if err := a.Store.Update(context.TODO(), session.ID, "", &models.Session{},
+			map[string]interface{}{"last_seen_at": time.Now()}); err != nil {
+			log.Warnw("update session last seen time error", "session", session.ID, "error", err)
+		}
+	}
+	return nil
+}
+
+// issueToken 签发token和refresh token，session为空时表示新的登录，创建新的会话
+func (a *Authn) issueToken(c *gin.Context, user *models.User, session *models.Session) error {
+	now := time.Now()
+	expires := now.Add(time.Second * time.Duration(config.Read().Service.RefreshTokenExpired))
+	if session == nil {
+		sid, err := token.RandomString(16)
+		if err != nil {
+			return err
+		}
+		session = &models.Session{
+			UserID:     user.ID,
+			SID:        sid,
+			IP:         c.ClientIP(),
+			UserAgent:  c.Request.UserAgent(),
+			LastSeenAt: now,
+			ExpiresAt:  expires,
+		}
+		if err := a.Store.Create(context.TODO(), session); err != nil {
+			return err
+		}
+		// 顺便清理该用户已经过期的会话
+		if err := a.Store.DeleteWhere(context.TODO(), &models.Session{},
+			"user_id = ? AND expires_at < ?", user.ID, now); err != nil {
+			log.Warnw("clean expired session error", "user", user.Name, "error", err)
+		}
+	} else {
+		if err := a.Store.Update(context.TODO(), session.ID, "", &models.Session{}, map[string]interface{}{
+			"ip":           c.ClientIP(),
+			"user_agent":   c.Request.UserAgent(),
+			"last_seen_at": now,
+			"expires_at":   expires,
+		}); err != nil {
+			return err
+		}
+	}
+	if err := user.GenUser(session.SID); err != nil {
+		return err
+	}
+	rt := models.RefreshToken{
+		UserID:    user.ID,
+		Family:    session.SID,
+		ExpiresAt: expires,
+	}
+	if err := rt.GenToken(); err != nil {
+		return err
+	}
+	if err := a.Store.Create(context.TODO(), &rt); err != nil {
+		return err
+	}
+	user.Token.RefreshToken = rt.Token
+	user.Token.RefreshExpired = rt.ExpiresAt.Unix()
+	return nil
+}
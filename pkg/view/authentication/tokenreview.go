@@ -0,0 +1,128 @@
+package authentication
+
+import (
+	"context"
+	"crypto/subtle"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/fize/go-ext/log"
+	"github.com/gin-gonic/gin"
+	"github.com/hex-techs/blade/pkg/models"
+	"github.com/hex-techs/blade/pkg/utils/token"
+	"github.com/hex-techs/blade/pkg/utils/web"
+	"github.com/hex-techs/blade/pkg/view"
+	authenticationv1 "k8s.io/api/authentication/v1"
+)
+
+// TokenReview返回的用户组
+const (
+	// 所有通过认证的主体
+	GroupAuthenticated = "blade:authenticated"
+	// 管理员
+	GroupAdmins = "blade:admins"
+	// 服务账号
+	GroupServiceAccounts = "blade:serviceaccounts"
+	// 模块成员，blade:module:<模块名>:<角色>
+	groupModuleFormat = "blade:module:%s:%s"
+	// 用户组成员，blade:group:<用户组名>
+	UserGroupPrefix = "blade:group:"
+	// 访问令牌的权限范围
+	extraScopes = "blade.io/scopes"
+)
+
+// WebhookRequired 校验集群调用webhook时携带的bearer token，没有配置token时拒绝所有请求
+func WebhookRequired(t string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		got := strings.TrimPrefix(c.GetHeader("Authorization"), "Bearer ")
+		if t == "" || subtle.ConstantTimeCompare([]byte(got), []byte(t)) != 1 {
+			log.Warnw("reject webhook request with invalid token", "remote", c.ClientIP())
+			c.JSON(http.StatusUnauthorized, web.ExceptResponse(http.StatusUnauthorized, "invalid webhook token"))
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
+
+// TokenReview 实现kubernetes authentication.k8s.io/v1 TokenReview webhook，
+// 集群通过 --authentication-token-webhook-config-file 指向该接口，使用blade的token访问集群，
+// 调用时需要携带kubernetes.tokenReviewToken
+func (a *Authn) TokenReview(c *gin.Context) {
+	var review authenticationv1.TokenReview
+	if err := c.ShouldBindJSON(&review); err != nil {
+		c.JSON(http.StatusBadRequest, web.ExceptResponse(errorMap[ErrInvalidParam], err))
+		return
+	}
+	gv := authenticationv1.SchemeGroupVersion
+	if review.APIVersion != gv.String() || review.Kind != "TokenReview" {
+		c.JSON(http.StatusBadRequest, web.ExceptResponse(errorMap[ErrInvalidParam],
+			fmt.Sprintf("unsupported object %s %s", review.APIVersion, review.Kind)))
+		return
+	}
+	review.Status = a.reviewToken(review.Spec.Token)
+	// 不在响应中回显token
+	review.Spec.Token = ""
+	c.JSON(http.StatusOK, review)
+}
+
+// reviewToken 校验token并返回用户名、uid和用户组，校验失败时只返回原因
+func (a *Authn) reviewToken(t string) authenticationv1.TokenReviewStatus {
+	claims, err := web.ResolveToken(t)
+	if err != nil {
+		return authenticationv1.TokenReviewStatus{Error: err.Error()}
+	}
+	// 模拟登录只用于在blade中排查问题，不能用于访问集群
+	if claims.IsImpersonated() {
+		return authenticationv1.TokenReviewStatus{Error: "impersonation token can not be used outside blade"}
+	}
+	user := authenticationv1.UserInfo{
+		Username: claims.Name,
+		Groups:   []string{GroupAuthenticated},
+	}
+	if claims.IsServiceAccount() {
+		user.UID = claims.Name
+		user.Groups = append(user.Groups, GroupServiceAccounts)
+	} else {
+		user.UID = fmt.Sprint(claims.ID)
+		if claims.Admin {
+			user.Groups = append(user.Groups, GroupAdmins)
+		}
+		groups, err := a.moduleGroups(claims)
+		if err != nil {
+			log.Errorw("get module groups error", "user", claims.Name, "error", err)
+			return authenticationv1.TokenReviewStatus{Error: "get user groups failed"}
+		}
+		user.Groups = append(user.Groups, groups...)
+	}
+	if claims.IsAccessToken() {
+		user.Extra = map[string]authenticationv1.ExtraValue{extraScopes: claims.Scopes}
+	}
+	return authenticationv1.TokenReviewStatus{Authenticated: true, User: user}
+}
+
+// moduleGroups 用户所在的用户组，以及直接或通过用户组所在模块对应的用户组
+func (a *Authn) moduleGroups(claims *token.Claims) ([]string, error) {
+	names, err := view.UserGroupNames(a.Store, claims.ID)
+	if err != nil {
+		return nil, err
+	}
+	var groups []string
+	for _, name := range names {
+		groups = append(groups, UserGroupPrefix+name)
+	}
+	members, err := view.UserMembers(a.Store, claims.ID)
+	if err != nil {
+		return nil, err
+	}
+	for _, m := range members {
+		var module models.Module
+		if err := a.Store.Get(context.TODO(), m.ModuleID, "", &module); err != nil {
+			log.Warnw("module of member not found", "module", m.ModuleID, "user", claims.Name)
+			continue
+		}
+		groups = append(groups, fmt.Sprintf(groupModuleFormat, module.Name, m.Role))
+	}
+	return groups, nil
+}
@@ -0,0 +1,54 @@
+package authentication
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/hex-techs/blade/pkg/models"
+	authenticationv1 "k8s.io/api/authentication/v1"
+)
+
+func TestTokenReviewRequiresWebhookToken(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	a := newTestAuthn(t, "")
+	u := &models.User{Name: "alice", CnName: "alice", Email: "alice@example.com", Enabled: true}
+	if err := a.Store.Create(context.TODO(), u); err != nil {
+		t.Fatal(err)
+	}
+	if err := u.GenUser("test"); err != nil {
+		t.Fatal(err)
+	}
+	review := func(webhookToken, auth string) *httptest.ResponseRecorder {
+		r := gin.New()
+		r.POST("/webhook/tokenreview", WebhookRequired(webhookToken), a.TokenReview)
+		body := `{"apiVersion":"authentication.k8s.io/v1","kind":"TokenReview","spec":{"token":"` + u.Token.Token + `"}}`
+		req := httptest.NewRequest(http.MethodPost, "/webhook/tokenreview", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		if auth != "" {
+			req.Header.Set("Authorization", "Bearer "+auth)
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	// 没有携带、携带错误的token，以及没有配置token时都拒绝
+	for _, c := range [][2]string{{"secret", ""}, {"secret", "wrong"}, {"", ""}} {
+		if w := review(c[0], c[1]); w.Code != http.StatusUnauthorized {
+			t.Fatalf("webhook token %q, bearer %q: code %d, want %d", c[0], c[1], w.Code, http.StatusUnauthorized)
+		}
+	}
+	w := review("secret", "secret")
+	var resp authenticationv1.TokenReview
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("decode %s: %v", w.Body.String(), err)
+	}
+	if w.Code != http.StatusOK || !resp.Status.Authenticated || resp.Status.User.Username != "alice" {
+		t.Fatalf("unexpected review %d %s", w.Code, w.Body.String())
+	}
+}
@@ -0,0 +1,149 @@
+package authz
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/hex-techs/blade/pkg/models"
+	"github.com/hex-techs/blade/pkg/utils/casbin"
+	"github.com/hex-techs/blade/pkg/utils/storage"
+	"github.com/hex-techs/blade/pkg/utils/token"
+	"github.com/hex-techs/blade/pkg/utils/web"
+)
+
+// Authz 权限检查接口
+type Authz struct {
+	Store      *storage.Engine
+	Enforcer   *casbin.Enforcer
+	Authorizer *casbin.Authorizer
+}
+
+// NewAuthz return a new authz api
+func NewAuthz(s *storage.Engine, e *casbin.Enforcer) *Authz {
+	return &Authz{
+		Store:      s,
+		Enforcer:   e,
+		Authorizer: casbin.NewAuthorizer(e, s),
+	}
+}
+
+// CanI 检查主体是否可以对资源执行操作，与接口鉴权使用相同的规则
+func (a *Authz) CanI(c *gin.Context) {
+	var f CanIForm
+	if err := c.ShouldBindJSON(&f); err != nil {
+		c.JSON(http.StatusBadRequest, web.ExceptResponse(errorMap[ErrInvalidParam], err))
+		return
+	}
+	claims := web.GetCurrentUser(c)
+	if f.Subject != "" && f.Subject != claims.Name {
+		if !claims.Admin {
+			c.JSON(http.StatusOK, web.ExceptResponse(errorMap[ErrNoPermission], ErrNoPermission))
+			return
+		}
+		var err error
+		if claims, err = subjectClaims(a.Store, f.Subject); err != nil {
+			c.JSON(http.StatusOK, web.ExceptResponse(errorMap[ErrSubjectNotFound], err))
+			return
+		}
+	}
+	allowed, err := a.Authorizer.Authorize(claims, f.Resource, f.Action)
+	if err != nil {
+		c.JSON(http.StatusOK, web.ExceptResponse(errorMap[ErrCheckFailed], err))
+		return
+	}
+	c.JSON(http.StatusOK, web.DataResponse(CanIResult{
+		Subject:  claims.Name,
+		Resource: f.Resource,
+		Action:   f.Action,
+		Allowed:  allowed,
+	}))
+}
+
+// MyPermissions 返回当前用户的角色和按资源汇总的权限，资源或操作为*表示任意
+func (a *Authz) MyPermissions(c *gin.Context) {
+	claims := web.GetCurrentUser(c)
+	roles := map[string]bool{}
+	actions := map[string]map[string]bool{}
+	subjects, err := a.Authorizer.Subjects(claims)
+	if err != nil {
+		c.JSON(http.StatusOK, web.ExceptResponse(errorMap[ErrCheckFailed], err))
+		return
+	}
+	groups := []string{}
+	for _, sub := range subjects {
+		if strings.HasPrefix(sub, casbin.RolePrefix) {
+			roles[sub] = true
+		}
+		if g := strings.TrimPrefix(sub, models.GroupPrefix); g != sub {
+			groups = append(groups, g)
+		}
+		implicit, err := a.Enforcer.GetImplicitRolesForUser(sub)
+		if err != nil {
+			c.JSON(http.StatusOK, web.ExceptResponse(errorMap[ErrCheckFailed], err))
+			return
+		}
+		for _, r := range implicit {
+			roles[r] = true
+		}
+		permissions, err := a.Enforcer.GetImplicitPermissionsForUser(sub)
+		if err != nil {
+			c.JSON(http.StatusOK, web.ExceptResponse(errorMap[ErrCheckFailed], err))
+			return
+		}
+		for _, p := range permissions {
+			if actions[p[1]] == nil {
+				actions[p[1]] = map[string]bool{}
+			}
+			actions[p[1]][p[2]] = true
+		}
+	}
+	result := MyPermissions{
+		Subject:     claims.Name,
+		Admin:       claims.Admin,
+		Groups:      groups,
+		Roles:       sortedKeys(roles),
+		Permissions: []ResourcePermissions{},
+	}
+	for i, r := range result.Roles {
+		result.Roles[i] = strings.TrimPrefix(r, casbin.RolePrefix)
+	}
+	for _, res := range sortedKeys(actions) {
+		result.Permissions = append(result.Permissions, ResourcePermissions{Resource: res, Actions: sortedKeys(actions[res])})
+	}
+	c.JSON(http.StatusOK, web.DataResponse(result))
+}
+
+// subjectClaims 根据主体名称构造鉴权使用的用户信息，主体必须存在且有效
+func subjectClaims(s *storage.Engine, subject string) (*token.Claims, error) {
+	if name := strings.TrimPrefix(subject, models.GroupPrefix); name != subject {
+		if err := s.Get(context.TODO(), 0, name, &models.Group{}); err != nil {
+			return nil, fmt.Errorf("group %s not found", name)
+		}
+		return &token.Claims{Name: subject}, nil
+	}
+	if name := strings.TrimPrefix(subject, token.KindServiceAccount+":"); name != subject {
+		var sa models.ServiceAccount
+		if err := s.Get(context.TODO(), 0, name, &sa); err != nil || !sa.Enabled {
+			return nil, fmt.Errorf("service account %s not found", name)
+		}
+		return &token.Claims{Name: subject, Kind: token.KindServiceAccount}, nil
+	}
+	var user models.User
+	if err := s.Get(context.TODO(), 0, subject, &user); err != nil || !user.Enabled {
+		return nil, fmt.Errorf("user %s not found", subject)
+	}
+	return &token.Claims{ID: user.ID, Name: user.Name, Admin: user.Admin}, nil
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,49 @@
+package authz
+
+const (
+	// 创建角色失败
+	ErrCreateRoleFailed = "create role failed"
+	// 删除角色失败
+	ErrDeleteRoleFailed = "delete role failed"
+	// 更新角色失败
+	ErrUpdateRoleFailed = "update role failed"
+	// 角色不存在
+	ErrRoleNotFound = "role not found"
+	// 角色已存在
+	ErrRoleExist = "role already exists"
+	// 内置角色不能修改
+	ErrRoleBuiltin = "builtin role can not be modified or bound"
+	// 无效的参数
+	ErrInvalidParam = "invalid param"
+	// 创建角色绑定失败
+	ErrCreateRoleBindingFailed = "create role binding failed"
+	// 删除角色绑定失败
+	ErrDeleteRoleBindingFailed = "delete role binding failed"
+	// 角色绑定已存在
+	ErrRoleBindingExist = "role binding already exists"
+	// 角色绑定不存在
+	ErrRoleBindingNotFound = "role binding not found"
+	// 主体不存在
+	ErrSubjectNotFound = "subject not found"
+	// 只有管理员可以检查其他主体的权限
+	ErrNoPermission = "only administrators can check other subjects"
+	// 权限检查失败
+	ErrCheckFailed = "check permission failed"
+)
+
+var errorMap = map[string]int{
+	ErrCreateRoleFailed:        50001,
+	ErrDeleteRoleFailed:        50002,
+	ErrUpdateRoleFailed:        50003,
+	ErrRoleNotFound:            50004,
+	ErrRoleExist:               50005,
+	ErrRoleBuiltin:             50006,
+	ErrInvalidParam:            50007,
+	ErrCreateRoleBindingFailed: 50008,
+	ErrDeleteRoleBindingFailed: 50009,
+	ErrRoleBindingExist:        50010,
+	ErrRoleBindingNotFound:     50011,
+	ErrSubjectNotFound:         50012,
+	ErrNoPermission:            50013,
+	ErrCheckFailed:             50014,
+}
@@ -0,0 +1,63 @@
+package authz
+
+// Permission 对资源执行操作的权限，资源为控制器名称，嵌套资源如 user/token，资源和操作都可以为*
+type Permission struct {
+	Resource string `json:"resource" binding:"required"`
+	Action   string `json:"action" binding:"required,oneof=create delete update patch get list *"`
+}
+
+// Role 角色，即一组权限
+type Role struct {
+	// 角色名称，不包含前缀 role:
+	Name        string       `json:"name" binding:"required,excludes=:"`
+	Permissions []Permission `json:"permissions" binding:"required,min=1,dive"`
+	// 是否是内置角色
+	Builtin bool `json:"builtin"`
+}
+
+// RoleBinding 将角色授予主体
+type RoleBinding struct {
+	// 用户名，serviceaccount:<服务账号名> 或者 group:<用户组名>
+	Subject string `json:"subject" binding:"required"`
+	// 角色名称
+	Role string `json:"role" binding:"required"`
+}
+
+// RoleBindingQuery 角色绑定的查询参数
+type RoleBindingQuery struct {
+	Subject string `form:"subject"`
+	Role    string `form:"role"`
+}
+
+// CanIForm 权限检查表单
+type CanIForm struct {
+	// 检查的主体，为空时检查自己，检查其他主体需要管理员
+	Subject  string `json:"subject"`
+	Resource string `json:"resource" binding:"required"`
+	Action   string `json:"action" binding:"required"`
+}
+
+// CanIResult 权限检查结果
+type CanIResult struct {
+	Subject  string `json:"subject"`
+	Resource string `json:"resource"`
+	Action   string `json:"action"`
+	Allowed  bool   `json:"allowed"`
+}
+
+// ResourcePermissions 对一种资源可以执行的操作
+type ResourcePermissions struct {
+	Resource string   `json:"resource"`
+	Actions  []string `json:"actions"`
+}
+
+// MyPermissions 当前用户的角色和权限，供前端控制按钮的显示
+type MyPermissions struct {
+	Subject string `json:"subject"`
+	Admin   bool   `json:"admin"`
+	// 所在的用户组
+	Groups []string `json:"groups"`
+	// 拥有的角色，包括隐式拥有的内置角色
+	Roles       []string              `json:"roles"`
+	Permissions []ResourcePermissions `json:"permissions"`
+}
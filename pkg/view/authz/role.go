@@ -0,0 +1,183 @@
+package authz
+
+import (
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/fize/go-ext/log"
+	"github.com/gin-gonic/gin"
+	"github.com/hex-techs/blade/pkg/utils/casbin"
+	"github.com/hex-techs/blade/pkg/utils/web"
+)
+
+// RoleController 角色控制器，角色保存为casbin策略，修改后立即同步到所有副本
+type RoleController struct {
+	web.DefaultController
+	Enforcer *casbin.Enforcer
+}
+
+// NewRoleController return a new role controller
+func NewRoleController(e *casbin.Enforcer) web.RestController {
+	return &RoleController{
+		Enforcer: e,
+	}
+}
+
+// 资源名
+func (*RoleController) Name() string {
+	return "role"
+}
+
+// Create 创建角色
+func (rc *RoleController) Create() (gin.HandlerFunc, error) {
+	return func(c *gin.Context) {
+		var role Role
+		if err := c.ShouldBindJSON(&role); err != nil {
+			c.JSON(http.StatusBadRequest, web.ExceptResponse(errorMap[ErrInvalidParam], err))
+			return
+		}
+		sub := casbin.RoleSubject(role.Name)
+		if len(rc.Enforcer.GetFilteredPolicy(0, sub)) > 0 {
+			c.JSON(http.StatusOK, web.ExceptResponse(errorMap[ErrRoleExist], ErrRoleExist))
+			return
+		}
+		log.Infow("create role", "role", role.Name, "permissions", role.Permissions, "operator", web.GetCurrentUser(c).Name)
+		if _, err := rc.Enforcer.AddPolicies(policies(sub, role.Permissions)); err != nil {
+			c.JSON(http.StatusOK, web.ExceptResponse(errorMap[ErrCreateRoleFailed], err))
+			return
+		}
+		c.JSON(http.StatusOK, web.DataResponse(role))
+	}, nil
+}
+
+// Delete 删除角色及其所有绑定
+func (rc *RoleController) Delete() (gin.HandlerFunc, error) {
+	return func(c *gin.Context) {
+		sub, ok := rc.role(c)
+		if !ok {
+			return
+		}
+		log.Infow("delete role", "role", sub, "operator", web.GetCurrentUser(c).Name)
+		if _, err := rc.Enforcer.RemoveFilteredGroupingPolicy(1, sub); err != nil {
+			c.JSON(http.StatusOK, web.ExceptResponse(errorMap[ErrDeleteRoleFailed], err))
+			return
+		}
+		if _, err := rc.Enforcer.RemoveFilteredPolicy(0, sub); err != nil {
+			c.JSON(http.StatusOK, web.ExceptResponse(errorMap[ErrDeleteRoleFailed], err))
+			return
+		}
+		c.JSON(http.StatusOK, web.OkResponse())
+	}, nil
+}
+
+// Update 替换角色的权限，角色名不能修改
+func (rc *RoleController) Update() (gin.HandlerFunc, error) {
+	return func(c *gin.Context) {
+		var role Role
+		// 名称以路径为准
+		role.Name = c.Param("name")
+		if err := c.ShouldBindJSON(&role); err != nil {
+			c.JSON(http.StatusBadRequest, web.ExceptResponse(errorMap[ErrInvalidParam], err))
+			return
+		}
+		sub, ok := rc.role(c)
+		if !ok {
+			return
+		}
+		role.Name = strings.TrimPrefix(sub, casbin.RolePrefix)
+		log.Infow("update role", "role", sub, "permissions", role.Permissions, "operator", web.GetCurrentUser(c).Name)
+		if _, err := rc.Enforcer.RemoveFilteredPolicy(0, sub); err != nil {
+			c.JSON(http.StatusOK, web.ExceptResponse(errorMap[ErrUpdateRoleFailed], err))
+			return
+		}
+		if _, err := rc.Enforcer.AddPolicies(policies(sub, role.Permissions)); err != nil {
+			c.JSON(http.StatusOK, web.ExceptResponse(errorMap[ErrUpdateRoleFailed], err))
+			return
+		}
+		c.JSON(http.StatusOK, web.DataResponse(role))
+	}, nil
+}
+
+// Get 获取角色详情
+func (rc *RoleController) Get() (gin.HandlerFunc, error) {
+	return func(c *gin.Context) {
+		sub := casbin.RoleSubject(c.Param("name"))
+		role := rc.load(sub)
+		if len(role.Permissions) == 0 {
+			c.JSON(http.StatusOK, web.ExceptResponse(errorMap[ErrRoleNotFound], ErrRoleNotFound))
+			return
+		}
+		c.JSON(http.StatusOK, web.DataResponse(role))
+	}, nil
+}
+
+// List 获取所有角色，包括内置角色
+func (rc *RoleController) List() (gin.HandlerFunc, error) {
+	return func(c *gin.Context) {
+		var subs []string
+		seen := map[string]bool{}
+		for _, p := range rc.Enforcer.GetPolicy() {
+			if strings.HasPrefix(p[0], casbin.RolePrefix) && !seen[p[0]] {
+				seen[p[0]] = true
+				subs = append(subs, p[0])
+			}
+		}
+		sort.Strings(subs)
+		roles := make([]Role, 0, len(subs))
+		for _, sub := range subs {
+			roles = append(roles, rc.load(sub))
+		}
+		c.JSON(http.StatusOK, web.ListResponse(len(roles), roles))
+	}, nil
+}
+
+func (rc *RoleController) Middlewares() []web.MiddlewaresObject {
+	return []web.MiddlewaresObject{
+		{
+			Methods:     []string{web.CREATE, web.DELETE, web.UPDATE, web.GET, web.LIST},
+			Middlewares: []gin.HandlerFunc{web.LoginRequired()},
+		},
+	}
+}
+
+// role 返回路径中可以修改的角色
+func (rc *RoleController) role(c *gin.Context) (string, bool) {
+	sub := casbin.RoleSubject(c.Param("name"))
+	if casbin.IsBuiltinRole(sub) {
+		c.JSON(http.StatusOK, web.ExceptResponse(errorMap[ErrRoleBuiltin], ErrRoleBuiltin))
+		return "", false
+	}
+	if len(rc.Enforcer.GetFilteredPolicy(0, sub)) == 0 {
+		c.JSON(http.StatusOK, web.ExceptResponse(errorMap[ErrRoleNotFound], ErrRoleNotFound))
+		return "", false
+	}
+	return sub, true
+}
+
+// load 从策略中读取角色
+func (rc *RoleController) load(sub string) Role {
+	role := Role{
+		Name:        strings.TrimPrefix(sub, casbin.RolePrefix),
+		Builtin:     casbin.IsBuiltinRole(sub),
+		Permissions: []Permission{},
+	}
+	for _, p := range rc.Enforcer.GetFilteredPolicy(0, sub) {
+		role.Permissions = append(role.Permissions, Permission{Resource: p[1], Action: p[2]})
+	}
+	return role
+}
+
+// policies 将权限转换为策略
+func policies(sub string, permissions []Permission) [][]string {
+	var rules [][]string
+	seen := map[Permission]bool{}
+	for _, p := range permissions {
+		if seen[p] {
+			continue
+		}
+		seen[p] = true
+		rules = append(rules, []string{sub, p.Resource, p.Action})
+	}
+	return rules
+}
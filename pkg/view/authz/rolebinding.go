@@ -0,0 +1,114 @@
+package authz
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/fize/go-ext/log"
+	"github.com/gin-gonic/gin"
+	"github.com/hex-techs/blade/pkg/utils/casbin"
+	"github.com/hex-techs/blade/pkg/utils/storage"
+	"github.com/hex-techs/blade/pkg/utils/web"
+)
+
+// RoleBindingController 角色绑定控制器，将角色授予用户或服务账号
+type RoleBindingController struct {
+	web.DefaultController
+	Store    *storage.Engine
+	Enforcer *casbin.Enforcer
+}
+
+// NewRoleBindingController return a new role binding controller
+func NewRoleBindingController(s *storage.Engine, e *casbin.Enforcer) web.RestController {
+	return &RoleBindingController{
+		Store:    s,
+		Enforcer: e,
+	}
+}
+
+// 资源名
+func (*RoleBindingController) Name() string {
+	return "rolebinding"
+}
+
+// Create 将角色授予主体，内置角色由用户的管理员标记决定，不能绑定
+func (rc *RoleBindingController) Create() (gin.HandlerFunc, error) {
+	return func(c *gin.Context) {
+		var rb RoleBinding
+		if err := c.ShouldBindJSON(&rb); err != nil {
+			c.JSON(http.StatusBadRequest, web.ExceptResponse(errorMap[ErrInvalidParam], err))
+			return
+		}
+		role := casbin.RoleSubject(rb.Role)
+		if casbin.IsBuiltinRole(role) {
+			c.JSON(http.StatusOK, web.ExceptResponse(errorMap[ErrRoleBuiltin], ErrRoleBuiltin))
+			return
+		}
+		if len(rc.Enforcer.GetFilteredPolicy(0, role)) == 0 {
+			c.JSON(http.StatusOK, web.ExceptResponse(errorMap[ErrRoleNotFound], ErrRoleNotFound))
+			return
+		}
+		if _, err := subjectClaims(rc.Store, rb.Subject); err != nil {
+			c.JSON(http.StatusOK, web.ExceptResponse(errorMap[ErrSubjectNotFound], err))
+			return
+		}
+		log.Infow("create role binding", "subject", rb.Subject, "role", rb.Role, "operator", web.GetCurrentUser(c).Name)
+		ok, err := rc.Enforcer.AddGroupingPolicy(rb.Subject, role)
+		if err != nil {
+			c.JSON(http.StatusOK, web.ExceptResponse(errorMap[ErrCreateRoleBindingFailed], err))
+			return
+		}
+		if !ok {
+			c.JSON(http.StatusOK, web.ExceptResponse(errorMap[ErrRoleBindingExist], ErrRoleBindingExist))
+			return
+		}
+		c.JSON(http.StatusOK, web.DataResponse(rb))
+	}, nil
+}
+
+// Delete 删除角色绑定
+func (rc *RoleBindingController) Delete() (gin.HandlerFunc, error) {
+	return func(c *gin.Context) {
+		sub, role := c.Param("subject"), casbin.RoleSubject(c.Param("role"))
+		log.Infow("delete role binding", "subject", sub, "role", role, "operator", web.GetCurrentUser(c).Name)
+		ok, err := rc.Enforcer.RemoveGroupingPolicy(sub, role)
+		if err != nil {
+			c.JSON(http.StatusOK, web.ExceptResponse(errorMap[ErrDeleteRoleBindingFailed], err))
+			return
+		}
+		if !ok {
+			c.JSON(http.StatusOK, web.ExceptResponse(errorMap[ErrRoleBindingNotFound], ErrRoleBindingNotFound))
+			return
+		}
+		c.JSON(http.StatusOK, web.OkResponse())
+	}, nil
+}
+
+// List 获取角色绑定，可以按主体和角色过滤
+func (rc *RoleBindingController) List() (gin.HandlerFunc, error) {
+	return func(c *gin.Context) {
+		var q RoleBindingQuery
+		if err := c.ShouldBindQuery(&q); err != nil {
+			c.JSON(http.StatusBadRequest, web.ExceptResponse(errorMap[ErrInvalidParam], err))
+			return
+		}
+		bindings := []RoleBinding{}
+		for _, g := range rc.Enforcer.GetGroupingPolicy() {
+			rb := RoleBinding{Subject: g[0], Role: strings.TrimPrefix(g[1], casbin.RolePrefix)}
+			if (q.Subject != "" && q.Subject != rb.Subject) || (q.Role != "" && q.Role != rb.Role) {
+				continue
+			}
+			bindings = append(bindings, rb)
+		}
+		c.JSON(http.StatusOK, web.ListResponse(len(bindings), bindings))
+	}, nil
+}
+
+func (rc *RoleBindingController) Middlewares() []web.MiddlewaresObject {
+	return []web.MiddlewaresObject{
+		{
+			Methods:     []string{web.CREATE, web.DELETE, web.LIST},
+			Middlewares: []gin.HandlerFunc{web.LoginRequired()},
+		},
+	}
+}
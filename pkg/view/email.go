@@ -0,0 +1,48 @@
+package view
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/fize/go-ext/sendmail"
+	"github.com/hex-techs/blade/pkg/models"
+	"github.com/hex-techs/blade/pkg/utils/config"
+	"github.com/hex-techs/blade/pkg/utils/token"
+)
+
+// ErrEmailNotConfigured 未配置邮件服务
+var ErrEmailNotConfigured = errors.New("email service not configured")
+
+// EmailEnabled 是否配置了邮件服务
+func EmailEnabled() bool {
+	mc := config.Read().Email
+	return mc != nil && mc.SMTP != ""
+}
+
+// SendEmail 使用配置的邮件服务发送邮件
+func SendEmail(to, subject, body string) error {
+	if !EmailEnabled() {
+		return ErrEmailNotConfigured
+	}
+	mc := config.Read().Email
+	return sendmail.SendEmail("blade", mc.SMTP, mc.Account, mc.Password, to, subject, body, mc.Port)
+}
+
+// SendVerifyEmail 向邮箱发送验证链接，链接与用户当前的token版本号和待验证的邮箱绑定
+func SendVerifyEmail(u *models.User, email string) error {
+	claims := &token.Claims{
+		ID:      u.ID,
+		Name:    u.Name,
+		Version: u.TokenVersion,
+		Purpose: token.PurposeVerifyEmail,
+		Email:   email,
+	}
+	exp := config.Read().Service.VerifyEmailExpired
+	t, _, err := token.GenerateJWTToken(claims, exp)
+	if err != nil {
+		return err
+	}
+	body := fmt.Sprintf("验证邮箱链接： %s%s/%s，有效时间%d秒。",
+		config.Read().Service.Domain, config.Read().Service.VerifyPath, t, exp)
+	return SendEmail(email, "Verify Email", body)
+}
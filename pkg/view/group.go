@@ -0,0 +1,133 @@
+package view
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/fize/go-ext/log"
+	"github.com/hex-techs/blade/pkg/models"
+	"github.com/hex-techs/blade/pkg/utils/storage"
+	"gorm.io/gorm"
+)
+
+// UserGroups 返回用户所在的用户组
+func UserGroups(s *storage.Engine, userID uint) ([]models.Group, error) {
+	var groups []models.Group
+	err := s.FindWhere(context.TODO(), &groups,
+		"id IN (SELECT group_id FROM group_members WHERE user_id = ? AND deleted_at IS NULL)", userID)
+	return groups, err
+}
+
+// UserGroupNames 返回用户所在的用户组名称
+func UserGroupNames(s *storage.Engine, userID uint) ([]string, error) {
+	groups, err := UserGroups(s, userID)
+	if err != nil {
+		return nil, err
+	}
+	names := make([]string, 0, len(groups))
+	for _, g := range groups {
+		names = append(names, g.Name)
+	}
+	return names, nil
+}
+
+// UserMembers 返回用户直接以及通过用户组获得的、在整个模块上生效的角色绑定，不包括已过期的临时角色
+func UserMembers(s *storage.Engine, userID uint) ([]models.ModuleMember, error) {
+	var members []models.ModuleMember
+	err := s.FindWhere(context.TODO(), &members,
+		"project_id = 0 AND (expires_at IS NULL OR expires_at > ?) AND "+
+			"(user_id = ? OR group_id IN (SELECT group_id FROM group_members WHERE user_id = ? AND deleted_at IS NULL))",
+		time.Now(), userID, userID)
+	return members, err
+}
+
+// UserProjectMembers 返回用户直接以及通过用户组获得的、只在项目上生效的角色绑定，不包括已过期的临时角色
+func UserProjectMembers(s *storage.Engine, userID uint) ([]models.ModuleMember, error) {
+	var members []models.ModuleMember
+	err := s.FindWhere(context.TODO(), &members,
+		"project_id <> 0 AND (expires_at IS NULL OR expires_at > ?) AND "+
+			"(user_id = ? OR group_id IN (SELECT group_id FROM group_members WHERE user_id = ? AND deleted_at IS NULL))",
+		time.Now(), userID, userID)
+	return members, err
+}
+
+// SyncGroups 根据身份源返回的用户组同步用户的成员关系，不存在的用户组自动创建，
+// 只修改同一来源的成员关系，手动添加的成员和其他来源的用户组不受影响
+func SyncGroups(s *storage.Engine, userID uint, source string, names []string) error {
+	var members []models.GroupMember
+	if err := s.FindWhere(context.TODO(), &members, "user_id = ?", userID); err != nil {
+		return err
+	}
+	current := map[uint]models.GroupMember{}
+	var ids []uint
+	for _, m := range members {
+		current[m.GroupID] = m
+		if m.Source == source {
+			ids = append(ids, m.GroupID)
+		}
+	}
+	valid := map[string]bool{}
+	for _, name := range names {
+		name = strings.TrimSpace(name)
+		// 用户组名不能包含':'，超长的名称无法保存
+		if name == "" || strings.Contains(name, ":") || len(name) > 64 {
+			log.Warnw("skip invalid group", "group", name, "source", source)
+			continue
+		}
+		valid[name] = true
+	}
+	// 可信代理认证每个请求都会同步，成员关系没有变化时不做任何写入
+	if len(ids) == len(valid) {
+		var groups []models.Group
+		if err := s.FindWhere(context.TODO(), &groups, "id IN ?", ids); err != nil {
+			return err
+		}
+		same := len(groups) == len(valid)
+		for _, g := range groups {
+			same = same && valid[g.Name]
+		}
+		if same {
+			return nil
+		}
+	}
+	wanted := map[uint]bool{}
+	for name := range valid {
+		var g models.Group
+		err := s.Get(context.TODO(), 0, name, &g)
+		if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+			return err
+		}
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			g = models.Group{Name: name, Source: source}
+			log.Infow("create group from identity provider", "group", name, "source", source)
+			if err := s.Create(context.TODO(), &g); err != nil {
+				return err
+			}
+		}
+		// 同名的其他来源的用户组可能已经被授权，不能让身份源控制其成员
+		if g.Source != source {
+			log.Warnw("skip group from another source", "group", name, "source", source, "groupSource", g.Source)
+			continue
+		}
+		wanted[g.ID] = true
+		if _, ok := current[g.ID]; ok {
+			continue
+		}
+		log.Infow("add group member from identity provider", "group", name, "user", userID, "source", source)
+		if err := s.Create(context.TODO(), &models.GroupMember{GroupID: g.ID, UserID: userID, Source: source}); err != nil {
+			return err
+		}
+	}
+	for id, m := range current {
+		if m.Source != source || wanted[id] {
+			continue
+		}
+		log.Infow("remove group member from identity provider", "group", id, "user", userID, "source", source)
+		if err := s.ForceDelete(context.TODO(), m.ID, "", &models.GroupMember{}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
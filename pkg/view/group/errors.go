@@ -0,0 +1,43 @@
+package group
+
+const (
+	// 创建用户组失败
+	ErrCreateGroupFailed = "create group failed"
+	// 删除用户组失败
+	ErrDeleteGroupFailed = "delete group failed"
+	// 更新用户组失败
+	ErrUpdateGroupFailed = "update group failed"
+	// 获取用户组失败
+	ErrGetGroupFailed = "get group failed"
+	// 获取用户组列表失败
+	ErrGetGroupListFailed = "get group list failed"
+	// id错误
+	ErrID = "id error"
+	// 无效的参数
+	ErrInvalidParam = "invalid param"
+	// 添加成员失败
+	ErrCreateMemberFailed = "create group member failed"
+	// 删除成员失败
+	ErrDeleteMemberFailed = "delete group member failed"
+	// 获取成员列表失败
+	ErrGetMemberListFailed = "get group member list failed"
+	// 成员不存在
+	ErrMemberNotFound = "group member not found"
+	// 用户不存在
+	ErrUserNotFound = "user not found"
+)
+
+var errorMap = map[string]int{
+	ErrCreateGroupFailed:   60001,
+	ErrDeleteGroupFailed:   60002,
+	ErrUpdateGroupFailed:   60003,
+	ErrGetGroupFailed:      60004,
+	ErrGetGroupListFailed:  60005,
+	ErrID:                  60006,
+	ErrInvalidParam:        60007,
+	ErrCreateMemberFailed:  60008,
+	ErrDeleteMemberFailed:  60009,
+	ErrGetMemberListFailed: 60010,
+	ErrMemberNotFound:      60011,
+	ErrUserNotFound:        60012,
+}
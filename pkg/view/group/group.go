@@ -0,0 +1,173 @@
+package group
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/fize/go-ext/log"
+	"github.com/gin-gonic/gin"
+	"github.com/hex-techs/blade/pkg/models"
+	"github.com/hex-techs/blade/pkg/utils/casbin"
+	"github.com/hex-techs/blade/pkg/utils/storage"
+	"github.com/hex-techs/blade/pkg/utils/web"
+	"github.com/hex-techs/blade/pkg/view"
+)
+
+// GroupController 用户组控制器
+type GroupController struct {
+	web.DefaultController
+	Store    *storage.Engine
+	Enforcer *casbin.Enforcer
+}
+
+// NewGroupController return a new group controller
+func NewGroupController(s *storage.Engine, e *casbin.Enforcer) web.RestController {
+	return &GroupController{
+		Store:    s,
+		Enforcer: e,
+	}
+}
+
+// 资源名
+func (*GroupController) Name() string {
+	return "group"
+}
+
+// 写入的模型，按字段的write标签校验创建和更新请求
+func (*GroupController) Model() interface{} {
+	return &models.Group{}
+}
+
+// Create 创建用户组，通过接口创建的用户组来源为local，身份源不会修改其成员
+func (gc *GroupController) Create() (gin.HandlerFunc, error) {
+	return func(c *gin.Context) {
+		var g models.Group
+		if err := c.ShouldBindJSON(&g); err != nil {
+			c.JSON(http.StatusBadRequest, web.ExceptResponse(errorMap[ErrInvalidParam], err))
+			return
+		}
+		g.Source = models.SourceLocal
+		log.Infow("create group", "name", g.Name, "operator", web.GetCurrentUser(c).Name)
+		if err := gc.Store.Create(context.TODO(), &g); err != nil {
+			c.JSON(http.StatusOK, web.ExceptResponse(errorMap[ErrCreateGroupFailed], err))
+			return
+		}
+		c.JSON(http.StatusOK, web.DataResponse(g))
+	}, nil
+}
+
+// Delete 删除用户组及其成员、模块角色绑定和角色绑定
+func (gc *GroupController) Delete() (gin.HandlerFunc, error) {
+	return func(c *gin.Context) {
+		g, ok := getGroup(c, gc.Store)
+		if !ok {
+			return
+		}
+		log.Infow("delete group", "name", g.Name, "operator", web.GetCurrentUser(c).Name)
+		if err := gc.Store.DeleteWhere(context.TODO(), &models.GroupMember{}, "group_id = ?", g.ID); err != nil {
+			c.JSON(http.StatusOK, web.ExceptResponse(errorMap[ErrDeleteGroupFailed], err))
+			return
+		}
+		var grants []models.ModuleMember
+		if err := gc.Store.FindWhere(context.TODO(), &grants, "group_id = ?", g.ID); err != nil {
+			c.JSON(http.StatusOK, web.ExceptResponse(errorMap[ErrDeleteGroupFailed], err))
+			return
+		}
+		if err := gc.Store.DeleteWhere(context.TODO(), &models.ModuleMember{}, "group_id = ?", g.ID); err != nil {
+			c.JSON(http.StatusOK, web.ExceptResponse(errorMap[ErrDeleteGroupFailed], err))
+			return
+		}
+		for _, m := range grants {
+			view.NotifyGrantChanged(m.ModuleID)
+		}
+		// 真正删除，身份源同步时可以重新创建同名的用户组
+		if err := gc.Store.ForceDelete(context.TODO(), g.ID, "", &models.Group{}); err != nil {
+			c.JSON(http.StatusOK, web.ExceptResponse(errorMap[ErrDeleteGroupFailed], err))
+			return
+		}
+		// 删除用户组的角色绑定，避免同名的新用户组继承
+		if err := casbin.RemoveSubject(gc.Enforcer, models.GroupSubject(g.Name)); err != nil {
+			log.Errorw("remove group policies error", "name", g.Name, "error", err)
+		}
+		c.JSON(http.StatusOK, web.OkResponse())
+	}, nil
+}
+
+// Update 更新用户组的描述
+func (gc *GroupController) Update() (gin.HandlerFunc, error) {
+	return func(c *gin.Context) {
+		var f UpdateForm
+		if err := c.ShouldBindJSON(&f); err != nil {
+			c.JSON(http.StatusBadRequest, web.ExceptResponse(errorMap[ErrInvalidParam], err))
+			return
+		}
+		g, ok := getGroup(c, gc.Store)
+		if !ok {
+			return
+		}
+		if f.Description != nil {
+			log.Infow("update group", "name", g.Name, "operator", web.GetCurrentUser(c).Name)
+			if err := gc.Store.Update(context.TODO(), g.ID, "", &models.Group{},
+				map[string]interface{}{"description": *f.Description}); err != nil {
+				c.JSON(http.StatusOK, web.ExceptResponse(errorMap[ErrUpdateGroupFailed], err))
+				return
+			}
+			g.Description = *f.Description
+		}
+		c.JSON(http.StatusOK, web.DataResponse(g))
+	}, nil
+}
+
+// Get 获取用户组详情
+func (gc *GroupController) Get() (gin.HandlerFunc, error) {
+	return func(c *gin.Context) {
+		g, ok := getGroup(c, gc.Store)
+		if !ok {
+			return
+		}
+		c.JSON(http.StatusOK, web.DataResponse(g))
+	}, nil
+}
+
+// List 获取用户组列表
+func (gc *GroupController) List() (gin.HandlerFunc, error) {
+	return func(c *gin.Context) {
+		var req web.Request
+		if err := c.ShouldBindQuery(&req); err != nil {
+			c.JSON(http.StatusBadRequest, web.ExceptResponse(errorMap[ErrInvalidParam], err))
+			return
+		}
+		req.Default()
+		var groups []models.Group
+		total, err := gc.Store.List(context.TODO(), req.Limit, req.Page, "", &groups)
+		if err != nil {
+			c.JSON(http.StatusOK, web.ExceptResponse(errorMap[ErrGetGroupListFailed], err))
+			return
+		}
+		c.JSON(http.StatusOK, web.ListResponse(int(total), groups))
+	}, nil
+}
+
+func (gc *GroupController) Middlewares() []web.MiddlewaresObject {
+	return []web.MiddlewaresObject{
+		{
+			Methods:     []string{web.CREATE, web.DELETE, web.UPDATE, web.GET, web.LIST},
+			Middlewares: []gin.HandlerFunc{web.LoginRequired()},
+		},
+	}
+}
+
+// getGroup 获取路径中的用户组
+func getGroup(c *gin.Context, s *storage.Engine) (*models.Group, bool) {
+	id, err := view.GetID(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, web.ExceptResponse(errorMap[ErrID], err))
+		return nil, false
+	}
+	var g models.Group
+	if err := s.Get(context.TODO(), id, "", &g); err != nil {
+		c.JSON(http.StatusOK, web.ExceptResponse(errorMap[ErrGetGroupFailed], err))
+		return nil, false
+	}
+	return &g, true
+}
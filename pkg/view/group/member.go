@@ -0,0 +1,136 @@
+package group
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+
+	"github.com/fize/go-ext/log"
+	"github.com/gin-gonic/gin"
+	"github.com/hex-techs/blade/pkg/models"
+	"github.com/hex-techs/blade/pkg/utils/storage"
+	"github.com/hex-techs/blade/pkg/utils/web"
+)
+
+// MemberController 用户组成员控制器，挂载在 /group/:id/member 下
+type MemberController struct {
+	web.DefaultController
+	Store *storage.Engine
+}
+
+// NewMemberController return a new group member controller
+func NewMemberController(s *storage.Engine) web.RestController {
+	return &MemberController{
+		Store: s,
+	}
+}
+
+// 资源名
+func (*MemberController) Name() string {
+	return "member"
+}
+
+// 写入的模型，按字段的write标签校验创建和更新请求
+func (*MemberController) Model() interface{} {
+	return &models.GroupMember{}
+}
+
+// Create 手动添加用户组成员，身份源同步不会删除手动添加的成员
+func (mc *MemberController) Create() (gin.HandlerFunc, error) {
+	return func(c *gin.Context) {
+		g, ok := getGroup(c, mc.Store)
+		if !ok {
+			return
+		}
+		var f MemberForm
+		if err := c.ShouldBindJSON(&f); err != nil {
+			c.JSON(http.StatusBadRequest, web.ExceptResponse(errorMap[ErrInvalidParam], err))
+			return
+		}
+		var user models.User
+		if err := mc.Store.Get(context.TODO(), f.UserID, "", &user); err != nil {
+			c.JSON(http.StatusOK, web.ExceptResponse(errorMap[ErrUserNotFound], ErrUserNotFound))
+			return
+		}
+		m := models.GroupMember{GroupID: g.ID, UserID: user.ID, Source: models.SourceLocal}
+		log.Infow("create group member", "group", g.Name, "user", user.Name, "operator", web.GetCurrentUser(c).Name)
+		if err := mc.Store.Create(context.TODO(), &m); err != nil {
+			c.JSON(http.StatusOK, web.ExceptResponse(errorMap[ErrCreateMemberFailed], err))
+			return
+		}
+		c.JSON(http.StatusOK, web.DataResponse(Member{
+			ID:        m.ID,
+			UserID:    user.ID,
+			UserName:  user.Name,
+			Source:    m.Source,
+			CreatedAt: m.CreatedAt,
+		}))
+	}, nil
+}
+
+// Delete 删除用户组成员，从身份源同步的成员在下次登录时会重新加入
+func (mc *MemberController) Delete() (gin.HandlerFunc, error) {
+	return func(c *gin.Context) {
+		g, ok := getGroup(c, mc.Store)
+		if !ok {
+			return
+		}
+		mid, err := strconv.Atoi(c.Param("mid"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, web.ExceptResponse(errorMap[ErrID], err))
+			return
+		}
+		var m models.GroupMember
+		if err := mc.Store.Get(context.TODO(), uint(mid), "", &m); err != nil || m.GroupID != g.ID {
+			c.JSON(http.StatusOK, web.ExceptResponse(errorMap[ErrMemberNotFound], ErrMemberNotFound))
+			return
+		}
+		log.Infow("delete group member", "group", g.Name, "user", m.UserID, "source", m.Source,
+			"operator", web.GetCurrentUser(c).Name)
+		if err := mc.Store.ForceDelete(context.TODO(), m.ID, "", &models.GroupMember{}); err != nil {
+			c.JSON(http.StatusOK, web.ExceptResponse(errorMap[ErrDeleteMemberFailed], err))
+			return
+		}
+		c.JSON(http.StatusOK, web.OkResponse())
+	}, nil
+}
+
+// List 获取用户组成员
+func (mc *MemberController) List() (gin.HandlerFunc, error) {
+	return func(c *gin.Context) {
+		g, ok := getGroup(c, mc.Store)
+		if !ok {
+			return
+		}
+		var members []models.GroupMember
+		if err := mc.Store.FindWhere(context.TODO(), &members, "group_id = ?", g.ID); err != nil {
+			c.JSON(http.StatusOK, web.ExceptResponse(errorMap[ErrGetMemberListFailed], err))
+			return
+		}
+		result := make([]Member, 0, len(members))
+		for _, m := range members {
+			var user models.User
+			if err := mc.Store.Get(context.TODO(), m.UserID, "", &user); err != nil {
+				// 用户已删除
+				continue
+			}
+			result = append(result, Member{
+				ID:        m.ID,
+				UserID:    m.UserID,
+				UserName:  user.Name,
+				Source:    m.Source,
+				CreatedAt: m.CreatedAt,
+			})
+		}
+		c.JSON(http.StatusOK, web.ListResponse(len(result), result))
+	}, nil
+}
+
+func (mc *MemberController) Middlewares() []web.MiddlewaresObject {
+	return []web.MiddlewaresObject{
+		{
+			Methods:     []string{web.CREATE, web.DELETE, web.LIST},
+			Middlewares: []gin.HandlerFunc{web.LoginRequired()},
+		},
+	}
+}
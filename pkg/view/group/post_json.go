@@ -0,0 +1,27 @@
+package group
+
+import "time"
+
+// UpdateForm 用户组更新表单，名称和来源不能修改
+type UpdateForm struct {
+	Description *string `json:"description"`
+}
+
+// MemberForm 添加用户组成员的表单
+type MemberForm struct {
+	UserID uint `json:"userID" binding:"required"`
+}
+
+// Member 用户组成员
+type Member struct {
+	// 成员id
+	ID uint `json:"id"`
+	// 用户id
+	UserID uint `json:"userID"`
+	// 用户名
+	UserName string `json:"userName"`
+	// 成员来源，local为手动添加，其他为登录时从身份源同步
+	Source string `json:"source"`
+	// 加入时间
+	CreatedAt time.Time `json:"createdAt"`
+}
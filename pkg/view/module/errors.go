@@ -15,14 +15,44 @@ const (
 	ErrGetModuleListFailed = "get module list failed"
 	// 无效的参数
 	ErrInvalidParam = "invalid param"
+	// 没有权限
+	ErrNoPermission = "no permission on module"
+	// 添加成员失败
+	ErrCreateMemberFailed = "create module member failed"
+	// 更新成员失败
+	ErrUpdateMemberFailed = "update module member failed"
+	// 删除成员失败
+	ErrDeleteMemberFailed = "delete module member failed"
+	// 获取成员列表失败
+	ErrGetMemberListFailed = "get module member list failed"
+	// 成员不存在
+	ErrMemberNotFound = "module member not found"
+	// 用户不存在
+	ErrUserNotFound = "user not found"
+	// 用户组不存在
+	ErrGroupNotFound = "group not found"
+	// 服务账号不存在
+	ErrServiceAccountNotFound = "service account not found"
+	// 服务账号不属于模块
+	ErrServiceAccountOutOfScope = "service account does not belong to the module"
 )
 
 var errorMap = map[string]int{
-	ErrCreateModuleFailed:  30001,
-	ErrDeleteModuleFailed:  30002,
-	ErrUpdateModuleFailed:  30003,
-	ErrGetModuleFailed:     30004,
-	ErrID:                  30005,
-	ErrGetModuleListFailed: 30006,
-	ErrInvalidParam:        30007,
+	ErrCreateModuleFailed:       30001,
+	ErrDeleteModuleFailed:       30002,
+	ErrUpdateModuleFailed:       30003,
+	ErrGetModuleFailed:          30004,
+	ErrID:                       30005,
+	ErrGetModuleListFailed:      30006,
+	ErrInvalidParam:             30007,
+	ErrNoPermission:             30008,
+	ErrCreateMemberFailed:       30009,
+	ErrUpdateMemberFailed:       30010,
+	ErrDeleteMemberFailed:       30011,
+	ErrGetMemberListFailed:      30012,
+	ErrMemberNotFound:           30013,
+	ErrUserNotFound:             30014,
+	ErrGroupNotFound:            30015,
+	ErrServiceAccountNotFound:   30016,
+	ErrServiceAccountOutOfScope: 30017,
 }
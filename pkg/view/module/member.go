@@ -0,0 +1,299 @@
+package module
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/fize/go-ext/log"
+	"github.com/gin-gonic/gin"
+	"github.com/hex-techs/blade/pkg/models"
+	"github.com/hex-techs/blade/pkg/utils/storage"
+	"github.com/hex-techs/blade/pkg/utils/web"
+	"github.com/hex-techs/blade/pkg/view"
+)
+
+// MemberForm 添加或修改模块成员的表单，添加时用户id、用户组id和服务账号id必须且只能指定一个
+type MemberForm struct {
+	// 用户id，修改时忽略
+	UserID uint `json:"userID"`
+	// 用户组id，修改时忽略
+	GroupID uint `json:"groupID"`
+	// 服务账号id，修改时忽略
+	ServiceAccountID uint `json:"serviceAccountID"`
+	// 角色
+	Role string `json:"role" binding:"required,oneof=owner maintainer developer viewer"`
+	// 过期时间，为空时长期有效，修改时忽略
+	ExpiresAt *time.Time `json:"expiresAt"`
+}
+
+// AccessQuery 查询用户在模块上权限的参数
+type AccessQuery struct {
+	// 用户id，为空时查询自己
+	UserID uint `form:"userID"`
+}
+
+// AccessReport 用户在模块上的权限以及来源
+type AccessReport struct {
+	UserID   uint `json:"userID"`
+	ModuleID uint `json:"moduleID"`
+	// 有效角色，取自身和继承的角色绑定中最高的，没有权限时为空
+	Role string `json:"role"`
+	// 有效角色可以执行的操作
+	Actions []string `json:"actions"`
+	// 生效的角色绑定
+	Grants []view.Grant `json:"grants"`
+}
+
+// MemberController 模块成员控制器，挂载在 /module/:id/member 下
+type MemberController struct {
+	web.DefaultController
+	Store *storage.Engine
+}
+
+// NewMemberController return a new module member controller
+func NewMemberController(s *storage.Engine) *MemberController {
+	return &MemberController{
+		Store: s,
+	}
+}
+
+// 资源名
+func (*MemberController) Name() string {
+	return "member"
+}
+
+// 写入的模型，按字段的write标签校验创建和更新请求
+func (*MemberController) Model() interface{} {
+	return &models.ModuleMember{}
+}
+
+// Create 在模块上为用户、用户组或服务账号绑定角色，模块的owner可以操作
+func (mc *MemberController) Create() (gin.HandlerFunc, error) {
+	return func(c *gin.Context) {
+		id, ok := mc.moduleID(c, models.RoleOwner)
+		if !ok {
+			return
+		}
+		var f MemberForm
+		if err := c.ShouldBindJSON(&f); err != nil {
+			c.JSON(http.StatusBadRequest, web.ExceptResponse(errorMap[ErrInvalidParam], err))
+			return
+		}
+		switch {
+		case nonZero(f.UserID, f.GroupID, f.ServiceAccountID) != 1:
+			c.JSON(http.StatusBadRequest, web.ExceptResponse(errorMap[ErrInvalidParam],
+				"exactly one of userID, groupID and serviceAccountID is required"))
+			return
+		case f.UserID != 0:
+			if err := mc.Store.Get(context.TODO(), f.UserID, "", &models.User{}); err != nil {
+				c.JSON(http.StatusOK, web.ExceptResponse(errorMap[ErrUserNotFound], ErrUserNotFound))
+				return
+			}
+		case f.ServiceAccountID != 0:
+			var sa models.ServiceAccount
+			if err := mc.Store.Get(context.TODO(), f.ServiceAccountID, "", &sa); err != nil {
+				c.JSON(http.StatusOK, web.ExceptResponse(errorMap[ErrServiceAccountNotFound], ErrServiceAccountNotFound))
+				return
+			}
+			// 其他模块的服务账号只有能管理它的用户才能绑定
+			if !mc.inSubtree(id, &sa) && !view.ServiceAccountManageable(mc.Store, web.GetCurrentUser(c), &sa) {
+				c.JSON(http.StatusOK, web.ExceptResponse(errorMap[ErrServiceAccountOutOfScope], ErrServiceAccountOutOfScope))
+				return
+			}
+		default:
+			if err := mc.Store.Get(context.TODO(), f.GroupID, "", &models.Group{}); err != nil {
+				c.JSON(http.StatusOK, web.ExceptResponse(errorMap[ErrGroupNotFound], ErrGroupNotFound))
+				return
+			}
+		}
+		if f.ExpiresAt != nil && f.ExpiresAt.Before(time.Now()) {
+			c.JSON(http.StatusBadRequest, web.ExceptResponse(errorMap[ErrInvalidParam], "expiresAt must be in the future"))
+			return
+		}
+		m := models.ModuleMember{ModuleID: id, UserID: f.UserID, GroupID: f.GroupID, ServiceAccountID: f.ServiceAccountID,
+			Role: f.Role, ExpiresAt: f.ExpiresAt}
+		log.Infow("create module member", "module", id, "user", f.UserID, "group", f.GroupID,
+			"serviceAccount", f.ServiceAccountID, "role", f.Role, "operator", web.GetCurrentUser(c).Name)
+		if err := mc.Store.Create(context.TODO(), &m); err != nil {
+			c.JSON(http.StatusOK, web.ExceptResponse(errorMap[ErrCreateMemberFailed], err))
+			return
+		}
+		view.NotifyGrantChanged(id)
+		c.JSON(http.StatusOK, web.DataResponse(m))
+	}, nil
+}
+
+// Update 修改模块成员的角色
+func (mc *MemberController) Update() (gin.HandlerFunc, error) {
+	return func(c *gin.Context) {
+		m, ok := mc.member(c)
+		if !ok {
+			return
+		}
+		var f MemberForm
+		if err := c.ShouldBindJSON(&f); err != nil {
+			c.JSON(http.StatusBadRequest, web.ExceptResponse(errorMap[ErrInvalidParam], err))
+			return
+		}
+		log.Infow("update module member", "module", m.ModuleID, "user", m.UserID, "group", m.GroupID,
+			"serviceAccount", m.ServiceAccountID, "from", m.Role, "to", f.Role, "operator", web.GetCurrentUser(c).Name)
+		if err := mc.Store.Update(context.TODO(), m.ID, "", &models.ModuleMember{},
+			map[string]interface{}{"role": f.Role}); err != nil {
+			c.JSON(http.StatusOK, web.ExceptResponse(errorMap[ErrUpdateMemberFailed], err))
+			return
+		}
+		view.NotifyGrantChanged(m.ModuleID)
+		m.Role = f.Role
+		c.JSON(http.StatusOK, web.DataResponse(m))
+	}, nil
+}
+
+// Delete 删除模块成员
+func (mc *MemberController) Delete() (gin.HandlerFunc, error) {
+	return func(c *gin.Context) {
+		m, ok := mc.member(c)
+		if !ok {
+			return
+		}
+		log.Infow("delete module member", "module", m.ModuleID, "user", m.UserID, "group", m.GroupID,
+			"serviceAccount", m.ServiceAccountID, "role", m.Role, "operator", web.GetCurrentUser(c).Name)
+		// 真正删除，否则唯一索引会阻止再次添加
+		if err := mc.Store.ForceDelete(context.TODO(), m.ID, "", &models.ModuleMember{}); err != nil {
+			c.JSON(http.StatusOK, web.ExceptResponse(errorMap[ErrDeleteMemberFailed], err))
+			return
+		}
+		view.NotifyGrantChanged(m.ModuleID)
+		c.JSON(http.StatusOK, web.OkResponse())
+	}, nil
+}
+
+// List 获取可以访问模块的用户和用户组，包括从上级模块继承的角色绑定及其来源
+func (mc *MemberController) List() (gin.HandlerFunc, error) {
+	return func(c *gin.Context) {
+		id, ok := mc.moduleID(c, models.RoleViewer)
+		if !ok {
+			return
+		}
+		grants, err := view.ModuleGrants(mc.Store, id, 0)
+		if err != nil {
+			c.JSON(http.StatusOK, web.ExceptResponse(errorMap[ErrGetMemberListFailed], err))
+			return
+		}
+		c.JSON(http.StatusOK, web.ListResponse(len(grants), grants))
+	}, nil
+}
+
+// Access 查询用户在模块上的有效角色和可以执行的操作，以及角色的来源，查询其他用户需要模块的查看权限
+func (mc *MemberController) Access(c *gin.Context) {
+	var q AccessQuery
+	if err := c.ShouldBindQuery(&q); err != nil {
+		c.JSON(http.StatusBadRequest, web.ExceptResponse(errorMap[ErrInvalidParam], err))
+		return
+	}
+	u := web.GetCurrentUser(c)
+	min := models.RoleViewer
+	if q.UserID == 0 || q.UserID == u.ID {
+		q.UserID = u.ID
+		// 查询自己不需要权限
+		min = ""
+	}
+	id, ok := mc.moduleID(c, min)
+	if !ok {
+		return
+	}
+	grants, err := view.ModuleGrants(mc.Store, id, q.UserID)
+	if err != nil {
+		c.JSON(http.StatusOK, web.ExceptResponse(errorMap[ErrGetMemberListFailed], err))
+		return
+	}
+	role := view.HighestRole(grants)
+	actions := models.RoleActions[role]
+	if actions == nil {
+		actions = []string{}
+	}
+	c.JSON(http.StatusOK, web.DataResponse(AccessReport{
+		UserID:   q.UserID,
+		ModuleID: id,
+		Role:     role,
+		Actions:  actions,
+		Grants:   grants,
+	}))
+}
+
+func (mc *MemberController) Middlewares() []web.MiddlewaresObject {
+	return []web.MiddlewaresObject{
+		{
+			Methods:     []string{web.CREATE, web.DELETE, web.UPDATE, web.LIST},
+			Middlewares: []gin.HandlerFunc{web.LoginRequired()},
+		},
+	}
+}
+
+// moduleID 获取路径中的模块id，并校验当前用户在模块上的有效角色不低于min，min为空时只校验模块存在
+func (mc *MemberController) moduleID(c *gin.Context, min string) (uint, bool) {
+	id, err := view.GetID(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, web.ExceptResponse(errorMap[ErrID], err))
+		return 0, false
+	}
+	if err := mc.Store.Get(context.TODO(), id, "", &models.Module{}); err != nil {
+		c.JSON(http.StatusOK, web.ExceptResponse(errorMap[ErrGetModuleFailed], err))
+		return 0, false
+	}
+	if min != "" && !view.ModuleAllowed(mc.Store, web.GetCurrentUser(c), id, min) {
+		c.JSON(http.StatusOK, web.ExceptResponse(errorMap[ErrNoPermission], ErrNoPermission))
+		return 0, false
+	}
+	return id, true
+}
+
+// member 获取路径中模块上直接绑定的成员，并校验当前用户是模块的owner
+func (mc *MemberController) member(c *gin.Context) (*models.ModuleMember, bool) {
+	id, ok := mc.moduleID(c, models.RoleOwner)
+	if !ok {
+		return nil, false
+	}
+	mid, err := strconv.Atoi(c.Param("mid"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, web.ExceptResponse(errorMap[ErrID], err))
+		return nil, false
+	}
+	var m models.ModuleMember
+	// 继承的角色绑定需要在所在的模块上修改
+	if err := mc.Store.Get(context.TODO(), uint(mid), "", &m); err != nil || m.ModuleID != id {
+		c.JSON(http.StatusOK, web.ExceptResponse(errorMap[ErrMemberNotFound], ErrMemberNotFound))
+		return nil, false
+	}
+	return &m, true
+}
+
+// inSubtree 服务账号是否属于模块或其下级模块
+func (mc *MemberController) inSubtree(moduleID uint, sa *models.ServiceAccount) bool {
+	home, err := view.ServiceAccountModule(mc.Store, sa)
+	if err != nil {
+		return false
+	}
+	ids, err := view.ModuleDescendants(mc.Store, []uint{moduleID})
+	if err != nil {
+		return false
+	}
+	for _, id := range ids {
+		if id == home {
+			return true
+		}
+	}
+	return false
+}
+
+// nonZero 返回不为0的id个数
+func nonZero(ids ...uint) int {
+	n := 0
+	for _, id := range ids {
+		if id != 0 {
+			n++
+		}
+	}
+	return n
+}
@@ -31,6 +31,11 @@ func (*ModuleController) Name() string {
 	return "module"
 }
 
+// 写入的模型，按字段的write标签校验创建和更新请求
+func (*ModuleController) Model() interface{} {
+	return &models.Module{}
+}
+
 // Create 创建新模块
 func (mc *ModuleController) Create() (gin.HandlerFunc, error) {
 	return func(c *gin.Context) {
@@ -76,6 +81,9 @@ func (mc *ModuleController) delete(id uint) error {
 			return err
 		}
 	}
+	if err := mc.Store.DeleteWhere(context.TODO(), &models.ModuleMember{}, "module_id = ?", id); err != nil {
+		return err
+	}
 	return mc.Store.ForceDelete(context.TODO(), id, "", &models.Module{})
 }
 
@@ -87,6 +95,11 @@ func (mc *ModuleController) Update() (gin.HandlerFunc, error) {
 			c.JSON(http.StatusOK, web.ExceptResponse(errorMap[ErrID], err))
 			return
 		}
+		// 模块的maintainer及以上角色可以修改，包括从上级模块继承的角色
+		if !view.ModuleAllowed(mc.Store, web.GetCurrentUser(c), id, models.RoleMaintainer) {
+			c.JSON(http.StatusOK, web.ExceptResponse(errorMap[ErrNoPermission], ErrNoPermission))
+			return
+		}
 		var (
 			new models.Module
 			old models.Module
@@ -163,11 +176,7 @@ func (mc *ModuleController) List() (gin.HandlerFunc, error) {
 func (uc *ModuleController) Middlewares() []web.MiddlewaresObject {
 	return []web.MiddlewaresObject{
 		{
-			Methods:     []string{web.CREATE, web.DELETE},
-			Middlewares: []gin.HandlerFunc{web.LoginRequired(), web.AdminRequired()},
-		},
-		{
-			Methods:     []string{web.UPDATE, web.GET, web.LIST},
+			Methods:     []string{web.CREATE, web.DELETE, web.UPDATE, web.GET, web.LIST},
 			Middlewares: []gin.HandlerFunc{web.LoginRequired()},
 		},
 	}
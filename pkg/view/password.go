@@ -0,0 +1,49 @@
+package view
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/hex-techs/blade/pkg/models"
+	"github.com/hex-techs/blade/pkg/utils/config"
+	"github.com/hex-techs/blade/pkg/utils/password"
+	"github.com/hex-techs/blade/pkg/utils/storage"
+)
+
+// CheckPassword 按照密码策略检查用户的新密码，u为已存在的用户时同时检查密码历史
+func CheckPassword(s *storage.Engine, u *models.User, plain string) (password.Violations, error) {
+	var history []string
+	if n := config.Read().PasswordPolicy.History; n > 0 && u.ID != 0 {
+		if u.Password != "" {
+			history = append(history, u.Password)
+		}
+		var records []models.PasswordHistory
+		if _, err := s.List(context.TODO(), n, 1, "user_id = "+fmt.Sprint(u.ID), &records); err != nil {
+			return nil, err
+		}
+		for _, r := range records {
+			history = append(history, r.Password)
+		}
+	}
+	return password.Check(plain, u.Name, u.Email, history), nil
+}
+
+// RecordPassword 记录用户当前的密码哈希，只保留最近的N条
+func RecordPassword(s *storage.Engine, u *models.User) error {
+	n := config.Read().PasswordPolicy.History
+	if n <= 0 {
+		return nil
+	}
+	if err := s.Create(context.TODO(), &models.PasswordHistory{UserID: u.ID, Password: u.Password}); err != nil {
+		return err
+	}
+	var records []models.PasswordHistory
+	if _, err := s.List(context.TODO(), -1, 1, "user_id = "+fmt.Sprint(u.ID), &records); err != nil {
+		return err
+	}
+	if len(records) <= n {
+		return nil
+	}
+	// List按照id倒序返回，超出部分为最早的记录
+	return s.DeleteWhere(context.TODO(), &models.PasswordHistory{}, "user_id = ? AND id <= ?", u.ID, records[n].ID)
+}
@@ -0,0 +1,13 @@
+package rbac
+
+const (
+	// 无效的参数
+	ErrInvalidParam = "invalid param"
+	// 同步失败
+	ErrSyncFailed = "sync kubernetes rbac failed"
+)
+
+var errorMap = map[string]int{
+	ErrInvalidParam: 70001,
+	ErrSyncFailed:   70002,
+}
@@ -0,0 +1,54 @@
+package rbac
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/hex-techs/blade/pkg/models"
+	"github.com/hex-techs/blade/pkg/utils/config"
+	"github.com/hex-techs/blade/pkg/utils/kube"
+	"github.com/hex-techs/blade/pkg/utils/storage"
+	"github.com/hex-techs/blade/pkg/utils/testutil"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+// newTestSyncer 使用临时目录中的配置和sqlite数据库，以及只有项目命名空间的fake集群创建同步器
+func newTestSyncer(t *testing.T, namespaces map[string]string) (*Syncer, *fake.Clientset) {
+	t.Helper()
+	s := testutil.NewStore(t, "", &models.User{}, &models.Module{}, &models.Project{}, &models.ModuleMember{},
+		&models.Group{}, &models.GroupMember{}, &models.ServiceAccount{})
+	cfgk := config.Read().Kubernetes
+	client := fake.NewSimpleClientset()
+	for ns, project := range namespaces {
+		if _, err := client.CoreV1().Namespaces().Create(context.TODO(), &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{
+			Name:   ns,
+			Labels: map[string]string{cfgk.ProjectLabel: project},
+		}}, metav1.CreateOptions{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	cluster := kube.NewCluster("test", client, cfgk.ProjectLabel)
+	return NewSyncer(s, kube.NewReconciler([]kube.Cluster{cluster}, cfgk.RoleMapping)), client
+}
+
+// create 保存测试数据
+func create(t *testing.T, s *storage.Engine, v interface{}) {
+	t.Helper()
+	if err := s.Create(context.TODO(), v); err != nil {
+		t.Fatalf("create %T: %v", v, err)
+	}
+}
+
+// grant 在模块或项目上绑定角色，expires不为0时是临时角色
+func grant(t *testing.T, s *storage.Engine, m models.ModuleMember, expires time.Duration) *models.ModuleMember {
+	t.Helper()
+	if expires != 0 {
+		at := time.Now().Add(expires)
+		m.ExpiresAt = &at
+	}
+	create(t, s, &m)
+	return &m
+}
@@ -0,0 +1,232 @@
+package rbac
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fize/go-ext/log"
+	"github.com/gin-gonic/gin"
+	"github.com/hex-techs/blade/pkg/models"
+	"github.com/hex-techs/blade/pkg/utils/kube"
+	"github.com/hex-techs/blade/pkg/utils/storage"
+	"github.com/hex-techs/blade/pkg/utils/token"
+	"github.com/hex-techs/blade/pkg/utils/web"
+	"github.com/hex-techs/blade/pkg/view"
+	"github.com/hex-techs/blade/pkg/view/authentication"
+	"gorm.io/gorm"
+	rbacv1 "k8s.io/api/rbac/v1"
+)
+
+// ReportQuery 查询同步结果的参数
+type ReportQuery struct {
+	// 项目id，为空时返回所有项目
+	ProjectID uint `form:"projectID"`
+}
+
+// Report 项目最近一次的同步结果
+type Report struct {
+	ProjectID uint          `json:"projectID"`
+	Project   string        `json:"project"`
+	SyncedAt  time.Time     `json:"syncedAt"`
+	Results   []kube.Result `json:"results"`
+	// 获取项目授权失败的原因，失败时不同步
+	Error string `json:"error,omitempty"`
+}
+
+// Syncer 将模块和项目上的角色同步为集群中的RoleBinding，用户组使用TokenReview返回的用户组名，
+// 用户组成员变化不需要同步
+type Syncer struct {
+	Store      *storage.Engine
+	Reconciler *kube.Reconciler
+	// 同一时间只有一次同步
+	mu      sync.Mutex
+	reports map[uint]Report
+}
+
+// NewSyncer return a new kubernetes rbac syncer
+func NewSyncer(s *storage.Engine, r *kube.Reconciler) *Syncer {
+	return &Syncer{
+		Store:      s,
+		Reconciler: r,
+		reports:    map[uint]Report{},
+	}
+}
+
+// Start 模块角色绑定变化时同步受影响的项目，并按照间隔全量同步，修复在blade之外的修改
+func (sy *Syncer) Start(interval time.Duration) {
+	view.RegisterGrantListener(func(moduleID uint) {
+		go func() {
+			if err := sy.SyncModule(moduleID); err != nil {
+				log.Errorw("sync module rbac error", "module", moduleID, "error", err)
+			}
+		}()
+	})
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			if err := sy.SyncAll(); err != nil {
+				log.Errorw("sync rbac error", "error", err)
+			}
+			<-ticker.C
+		}
+	}()
+}
+
+// SyncAll 同步所有项目
+func (sy *Syncer) SyncAll() error {
+	var projects []models.Project
+	if _, err := sy.Store.List(context.TODO(), -1, 1, "", &projects); err != nil {
+		return err
+	}
+	return sy.sync(projects, true)
+}
+
+// SyncModule 同步模块及其下级模块中的项目
+func (sy *Syncer) SyncModule(moduleID uint) error {
+	ids, err := view.ModuleDescendants(sy.Store, []uint{moduleID})
+	if err != nil {
+		return err
+	}
+	var projects []models.Project
+	if err := sy.Store.FindWhere(context.TODO(), &projects, "module_id IN ?", ids); err != nil {
+		return err
+	}
+	return sy.sync(projects, false)
+}
+
+// sync 同步项目，all为true时丢弃已删除项目的同步结果，一个项目失败不影响其他项目，返回所有失败的原因
+func (sy *Syncer) sync(projects []models.Project, all bool) error {
+	sy.mu.Lock()
+	defer sy.mu.Unlock()
+	if all {
+		sy.reports = map[uint]Report{}
+	}
+	var errs []error
+	for _, p := range projects {
+		subjects, err := sy.subjects(&p)
+		if err != nil {
+			log.Errorw("get project subjects error", "project", p.Name, "error", err)
+			sy.reports[p.ID] = Report{
+				ProjectID: p.ID,
+				Project:   p.Name,
+				SyncedAt:  time.Now(),
+				Error:     err.Error(),
+			}
+			errs = append(errs, fmt.Errorf("project %s: %w", p.Name, err))
+			continue
+		}
+		results := sy.Reconciler.Reconcile(context.TODO(), p.Name, subjects)
+		sy.reports[p.ID] = Report{
+			ProjectID: p.ID,
+			Project:   p.Name,
+			SyncedAt:  time.Now(),
+			Results:   results,
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// subjects 项目上的授权主体，每个主体取自身和继承的角色绑定中最高的角色，项目负责人至少是maintainer
+func (sy *Syncer) subjects(p *models.Project) ([]kube.Subject, error) {
+	grants, err := view.ProjectGrants(sy.Store, p.ID, 0)
+	if err != nil {
+		return nil, err
+	}
+	roles := map[kube.Subject]string{}
+	for _, g := range grants {
+		s := kube.Subject{Kind: rbacv1.UserKind, Name: g.UserName}
+		switch {
+		case g.GroupID != 0:
+			s = kube.Subject{Kind: rbacv1.GroupKind, Name: authentication.UserGroupPrefix + g.GroupName}
+		case g.ServiceAccountID != 0:
+			s = kube.Subject{Kind: rbacv1.UserKind, Name: token.ServiceAccountName(g.ServiceAccountName)}
+		}
+		// 用户、用户组或服务账号已经删除
+		if g.UserName == "" && g.GroupName == "" && g.ServiceAccountName == "" {
+			continue
+		}
+		if models.RoleRank(g.Role) > models.RoleRank(roles[s]) {
+			roles[s] = g.Role
+		}
+	}
+	owners, err := sy.owners(p)
+	if err != nil {
+		return nil, err
+	}
+	for _, s := range owners {
+		if models.RoleRank(roles[s]) < models.RoleRank(models.RoleMaintainer) {
+			roles[s] = models.RoleMaintainer
+		}
+	}
+	subjects := make([]kube.Subject, 0, len(roles))
+	for s, role := range roles {
+		s.Role = role
+		subjects = append(subjects, s)
+	}
+	return subjects, nil
+}
+
+// owners 项目负责人对应的主体，已经删除的用户和用户组不同步
+func (sy *Syncer) owners(p *models.Project) ([]kube.Subject, error) {
+	var subjects []kube.Subject
+	for _, name := range p.Owners() {
+		var err error
+		s := kube.Subject{Kind: rbacv1.UserKind, Name: name}
+		if group := strings.TrimPrefix(name, models.GroupPrefix); group != name {
+			s = kube.Subject{Kind: rbacv1.GroupKind, Name: authentication.UserGroupPrefix + group}
+			err = sy.Store.Get(context.TODO(), 0, group, &models.Group{})
+		} else {
+			err = sy.Store.Get(context.TODO(), 0, name, &models.User{})
+		}
+		switch {
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			continue
+		case err != nil:
+			return nil, err
+		}
+		subjects = append(subjects, s)
+	}
+	return subjects, nil
+}
+
+// Reports 获取最近一次的同步结果，包括在blade之外被修改的RoleBinding
+func (sy *Syncer) Reports(c *gin.Context) {
+	var q ReportQuery
+	if err := c.ShouldBindQuery(&q); err != nil {
+		c.JSON(http.StatusBadRequest, web.ExceptResponse(errorMap[ErrInvalidParam], err))
+		return
+	}
+	reports := sy.list(q.ProjectID)
+	c.JSON(http.StatusOK, web.ListResponse(len(reports), reports))
+}
+
+// Sync 立即全量同步，返回同步结果
+func (sy *Syncer) Sync(c *gin.Context) {
+	log.Infow("sync kubernetes rbac", "operator", web.GetCurrentUser(c).Name)
+	if err := sy.SyncAll(); err != nil {
+		c.JSON(http.StatusOK, web.ExceptResponse(errorMap[ErrSyncFailed], err))
+		return
+	}
+	reports := sy.list(0)
+	c.JSON(http.StatusOK, web.ListResponse(len(reports), reports))
+}
+
+func (sy *Syncer) list(projectID uint) []Report {
+	sy.mu.Lock()
+	defer sy.mu.Unlock()
+	reports := []Report{}
+	for id, r := range sy.reports {
+		if projectID == 0 || projectID == id {
+			reports = append(reports, r)
+		}
+	}
+	sort.Slice(reports, func(i, j int) bool { return reports[i].ProjectID < reports[j].ProjectID })
+	return reports
+}
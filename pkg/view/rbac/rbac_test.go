@@ -0,0 +1,274 @@
+package rbac
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/hex-techs/blade/pkg/models"
+	"github.com/hex-techs/blade/pkg/utils/kube"
+	"gorm.io/gorm"
+	rbacv1 "k8s.io/api/rbac/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+// fixture 两级模块，子模块和父模块各有一个项目
+type fixture struct {
+	sy     *Syncer
+	client *fake.Clientset
+	parent *models.Module
+	child  *models.Module
+	p1     *models.Project
+	p2     *models.Project
+	alice  *models.User
+}
+
+// newFixture p1属于子模块，命名空间为p1-dev，p2属于父模块，命名空间为p2-dev
+func newFixture(t *testing.T) *fixture {
+	t.Helper()
+	sy, client := newTestSyncer(t, map[string]string{"p1-dev": "p1", "p2-dev": "p2"})
+	f := &fixture{sy: sy, client: client}
+	f.parent = &models.Module{Name: "infra", CnName: "基础设施"}
+	create(t, sy.Store, f.parent)
+	f.child = &models.Module{Name: "storage", CnName: "存储", ParentID: f.parent.ID}
+	create(t, sy.Store, f.child)
+	f.p1 = &models.Project{Name: "p1", CnName: "项目1", ModuleID: f.child.ID}
+	create(t, sy.Store, f.p1)
+	f.p2 = &models.Project{Name: "p2", CnName: "项目2", ModuleID: f.parent.ID}
+	create(t, sy.Store, f.p2)
+	f.alice = &models.User{Name: "alice", CnName: "alice", Email: "alice@example.com"}
+	create(t, sy.Store, f.alice)
+	return f
+}
+
+// bindings 命名空间中blade管理的RoleBinding，名称到排序后的主体
+func (f *fixture) bindings(t *testing.T, namespace string) map[string][]string {
+	t.Helper()
+	list, err := f.client.RbacV1().RoleBindings(namespace).List(context.TODO(), metav1.ListOptions{
+		LabelSelector: kube.ManagedByLabel + "=" + kube.ManagedByValue,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	result := map[string][]string{}
+	for _, rb := range list.Items {
+		subjects := []string{}
+		for _, s := range rb.Subjects {
+			subjects = append(subjects, s.Kind+"/"+s.Name)
+		}
+		result[rb.Name] = subjects
+	}
+	return result
+}
+
+func TestSyncSubjects(t *testing.T) {
+	f := newFixture(t)
+	s := f.sy.Store
+	bob := &models.User{Name: "bob", CnName: "bob", Email: "bob@example.com"}
+	create(t, s, bob)
+	carol := &models.User{Name: "carol", CnName: "carol", Email: "carol@example.com"}
+	create(t, s, carol)
+	dev := &models.Group{Name: "dev"}
+	create(t, s, dev)
+	ci := &models.ServiceAccount{Name: "ci", ModuleID: f.child.ID, Enabled: true}
+	create(t, s, ci)
+
+	// 继承父模块的角色，取最高的角色
+	grant(t, s, models.ModuleMember{ModuleID: f.parent.ID, UserID: f.alice.ID, Role: models.RoleDeveloper}, 0)
+	grant(t, s, models.ModuleMember{ModuleID: f.child.ID, UserID: f.alice.ID, Role: models.RoleViewer}, 0)
+	grant(t, s, models.ModuleMember{ModuleID: f.child.ID, GroupID: dev.ID, Role: models.RoleViewer}, 0)
+	// 只在p1上生效的服务账号
+	grant(t, s, models.ModuleMember{ModuleID: f.child.ID, ProjectID: f.p1.ID, ServiceAccountID: ci.ID,
+		Role: models.RoleMaintainer}, 0)
+	// 已过期的临时角色和已删除的用户不同步
+	grant(t, s, models.ModuleMember{ModuleID: f.child.ID, UserID: bob.ID, Role: models.RoleOwner}, -time.Hour)
+	grant(t, s, models.ModuleMember{ModuleID: f.child.ID, UserID: carol.ID, Role: models.RoleViewer}, 0)
+	if err := s.Delete(context.TODO(), carol.ID, "", &models.User{}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := f.sy.SyncAll(); err != nil {
+		t.Fatal(err)
+	}
+	want := map[string][]string{
+		"blade:developer":  {"User/alice"},
+		"blade:maintainer": {"User/serviceaccount:ci"},
+		"blade:viewer":     {"Group/blade:group:dev"},
+	}
+	if got := f.bindings(t, "p1-dev"); !reflect.DeepEqual(got, want) {
+		t.Fatalf("p1-dev bindings %v, want %v", got, want)
+	}
+	want = map[string][]string{"blade:developer": {"User/alice"}}
+	if got := f.bindings(t, "p2-dev"); !reflect.DeepEqual(got, want) {
+		t.Fatalf("p2-dev bindings %v, want %v", got, want)
+	}
+	reports := f.sy.list(0)
+	if len(reports) != 2 || reports[0].ProjectID != f.p1.ID || reports[1].ProjectID != f.p2.ID {
+		t.Fatalf("unexpected reports %+v", reports)
+	}
+	created := reports[0].Results[0].Created
+	if want := []string{"blade:developer", "blade:maintainer", "blade:viewer"}; !reflect.DeepEqual(created, want) {
+		t.Fatalf("created %v, want %v", created, want)
+	}
+}
+
+func TestSyncModuleRemovedGrant(t *testing.T) {
+	f := newFixture(t)
+	s := f.sy.Store
+	inherited := grant(t, s, models.ModuleMember{ModuleID: f.parent.ID, UserID: f.alice.ID, Role: models.RoleDeveloper}, 0)
+	direct := grant(t, s, models.ModuleMember{ModuleID: f.child.ID, UserID: f.alice.ID, Role: models.RoleViewer}, 0)
+	if err := f.sy.SyncAll(); err != nil {
+		t.Fatal(err)
+	}
+
+	// 删除父模块上的角色后，子模块的项目降为直接绑定的角色，父模块的项目删除授权
+	if err := s.ForceDelete(context.TODO(), inherited.ID, "", &models.ModuleMember{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.sy.SyncModule(f.parent.ID); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := f.bindings(t, "p1-dev"), map[string][]string{"blade:viewer": {"User/alice"}}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("p1-dev bindings %v, want %v", got, want)
+	}
+	if got := f.bindings(t, "p2-dev"); len(got) != 0 {
+		t.Fatalf("p2-dev bindings not removed: %v", got)
+	}
+	reports := f.sy.list(f.p1.ID)
+	if len(reports) != 1 {
+		t.Fatalf("unexpected reports %+v", reports)
+	}
+	result := reports[0].Results[0]
+	if !reflect.DeepEqual(result.Deleted, []string{"blade:developer"}) || !reflect.DeepEqual(result.Created, []string{"blade:viewer"}) {
+		t.Fatalf("unexpected result %+v", result)
+	}
+
+	// 只同步子模块时不影响父模块的项目
+	if err := s.ForceDelete(context.TODO(), direct.ID, "", &models.ModuleMember{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.sy.SyncModule(f.child.ID); err != nil {
+		t.Fatal(err)
+	}
+	if got := f.bindings(t, "p1-dev"); len(got) != 0 {
+		t.Fatalf("p1-dev bindings not removed: %v", got)
+	}
+	if reports := f.sy.list(f.p1.ID); !reflect.DeepEqual(reports[0].Results[0].Deleted, []string{"blade:viewer"}) {
+		t.Fatalf("unexpected result %+v", reports[0].Results[0])
+	}
+}
+
+func TestReportsDrift(t *testing.T) {
+	f := newFixture(t)
+	grant(t, f.sy.Store, models.ModuleMember{ModuleID: f.child.ID, UserID: f.alice.ID, Role: models.RoleViewer}, 0)
+	if err := f.sy.SyncAll(); err != nil {
+		t.Fatal(err)
+	}
+	// 在blade之外给RoleBinding增加主体
+	rb, err := f.client.RbacV1().RoleBindings("p1-dev").Get(context.TODO(), "blade:viewer", metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	rb.Subjects = append(rb.Subjects, rbacv1.Subject{APIGroup: rbacv1.GroupName, Kind: rbacv1.UserKind, Name: "mallory"})
+	if _, err := f.client.RbacV1().RoleBindings("p1-dev").Update(context.TODO(), rb, metav1.UpdateOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.sy.SyncAll(); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := f.bindings(t, "p1-dev"), map[string][]string{"blade:viewer": {"User/alice"}}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("drift not reverted, bindings %v", got)
+	}
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.GET("/rbac/reports", f.sy.Reports)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, fmt.Sprintf("/rbac/reports?projectID=%d", f.p1.ID), nil))
+	var resp struct {
+		Data struct {
+			Items []Report `json:"items"`
+			Total int      `json:"total"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("decode %s: %v", w.Body.String(), err)
+	}
+	if resp.Data.Total != 1 || len(resp.Data.Items) != 1 || resp.Data.Items[0].Project != "p1" {
+		t.Fatalf("unexpected reports %s", w.Body.String())
+	}
+	result := resp.Data.Items[0].Results[0]
+	if result.Namespace != "p1-dev" || !reflect.DeepEqual(result.Drift, []string{"blade:viewer"}) ||
+		!reflect.DeepEqual(result.Updated, []string{"blade:viewer"}) {
+		t.Fatalf("unexpected result %+v", result)
+	}
+}
+
+func TestSyncProjectOwners(t *testing.T) {
+	f := newFixture(t)
+	s := f.sy.Store
+	bob := &models.User{Name: "bob", CnName: "bob", Email: "bob@example.com"}
+	create(t, s, bob)
+	ops := &models.Group{Name: "ops"}
+	create(t, s, ops)
+	// 负责人至少是维护者，已有更高的角色时保留，不存在的负责人不同步
+	grant(t, s, models.ModuleMember{ModuleID: f.child.ID, UserID: f.alice.ID, Role: models.RoleOwner}, 0)
+	grant(t, s, models.ModuleMember{ModuleID: f.child.ID, UserID: bob.ID, Role: models.RoleViewer}, 0)
+	if err := s.Update(context.TODO(), f.p1.ID, "", &models.Project{}, map[string]interface{}{
+		"owner": "alice, bob", "product_owner": "group:ops", "test_owner": "ghost,group:nobody",
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := f.sy.SyncAll(); err != nil {
+		t.Fatal(err)
+	}
+	want := map[string][]string{
+		"blade:maintainer": {"Group/blade:group:ops", "User/bob"},
+		"blade:owner":      {"User/alice"},
+	}
+	if got := f.bindings(t, "p1-dev"); !reflect.DeepEqual(got, want) {
+		t.Fatalf("p1-dev bindings %v, want %v", got, want)
+	}
+}
+
+func TestSyncContinuesAfterProjectError(t *testing.T) {
+	f := newFixture(t)
+	s := f.sy.Store
+	grant(t, s, models.ModuleMember{ModuleID: f.child.ID, UserID: f.alice.ID, Role: models.RoleViewer}, 0)
+	// 上级模块超过5级，获取p0的授权失败
+	parent := f.child.ID
+	for _, name := range []string{"l3", "l4", "l5"} {
+		m := &models.Module{Name: name, CnName: name, ParentID: parent}
+		create(t, s, m)
+		parent = m.ID
+	}
+	root := &models.Module{Name: "r1", CnName: "r1"}
+	create(t, s, root)
+	leaf := &models.Module{Name: "r2", CnName: "r2", ParentID: root.ID}
+	create(t, s, leaf)
+	if err := s.Client().(*gorm.DB).Model(root).UpdateColumn("parent_id", parent).Error; err != nil {
+		t.Fatal(err)
+	}
+	p0 := &models.Project{Name: "p0", CnName: "项目0", ModuleID: leaf.ID}
+	create(t, s, p0)
+
+	if err := f.sy.SyncAll(); err == nil || !strings.Contains(err.Error(), "project p0") {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if got, want := f.bindings(t, "p1-dev"), map[string][]string{"blade:viewer": {"User/alice"}}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("p1-dev bindings %v, want %v", got, want)
+	}
+	reports := f.sy.list(p0.ID)
+	if len(reports) != 1 || reports[0].Error == "" || len(reports[0].Results) != 0 {
+		t.Fatalf("unexpected reports %+v", reports)
+	}
+}
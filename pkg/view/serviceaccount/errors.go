@@ -0,0 +1,43 @@
+package serviceaccount
+
+const (
+	// 创建服务账号失败
+	ErrCreateServiceAccountFailed = "create service account failed"
+	// 删除服务账号失败
+	ErrDeleteServiceAccountFailed = "delete service account failed"
+	// 更新服务账号失败
+	ErrUpdateServiceAccountFailed = "update service account failed"
+	// 获取服务账号失败
+	ErrGetServiceAccountFailed = "get service account failed"
+	// 获取服务账号列表失败
+	ErrGetServiceAccountListFailed = "get service account list failed"
+	// id错误
+	ErrID = "id error"
+	// 无效的参数
+	ErrInvalidParam = "invalid param"
+	// 没有权限管理该服务账号
+	ErrNoPermission = "no permission to manage the service account"
+	// 服务账号不能管理服务账号
+	ErrByServiceAccount = "access token can not manage service accounts"
+	// 创建服务账号令牌失败
+	ErrCreateTokenFailed = "create service account token failed"
+	// 吊销服务账号令牌失败
+	ErrRevokeTokenFailed = "revoke service account token failed"
+	// 获取服务账号令牌列表失败
+	ErrGetTokenListFailed = "get service account token list failed"
+)
+
+var errorMap = map[string]int{
+	ErrCreateServiceAccountFailed:  40001,
+	ErrDeleteServiceAccountFailed:  40002,
+	ErrUpdateServiceAccountFailed:  40003,
+	ErrGetServiceAccountFailed:     40004,
+	ErrGetServiceAccountListFailed: 40005,
+	ErrID:                          40006,
+	ErrInvalidParam:                40007,
+	ErrNoPermission:                40008,
+	ErrByServiceAccount:            40009,
+	ErrCreateTokenFailed:           40010,
+	ErrRevokeTokenFailed:           40011,
+	ErrGetTokenListFailed:          40012,
+}
@@ -0,0 +1,295 @@
+package serviceaccount
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/fize/go-ext/log"
+	"github.com/gin-gonic/gin"
+	"github.com/hex-techs/blade/pkg/models"
+	"github.com/hex-techs/blade/pkg/utils/casbin"
+	"github.com/hex-techs/blade/pkg/utils/storage"
+	"github.com/hex-techs/blade/pkg/utils/token"
+	"github.com/hex-techs/blade/pkg/utils/web"
+	"github.com/hex-techs/blade/pkg/view"
+)
+
+// UpdateForm 服务账号更新表单，名称和所属不能修改
+type UpdateForm struct {
+	Description *string `json:"description"`
+	// 禁用后服务账号的所有令牌立即失效
+	Enabled *bool `json:"enabled"`
+}
+
+// ServiceAccountController service account controller
+type ServiceAccountController struct {
+	web.DefaultController
+	Store    *storage.Engine
+	Enforcer *casbin.Enforcer
+}
+
+// NewServiceAccountController return a new service account controller
+func NewServiceAccountController(s *storage.Engine, e *casbin.Enforcer) web.RestController {
+	return &ServiceAccountController{
+		Store:    s,
+		Enforcer: e,
+	}
+}
+
+// 资源名
+func (*ServiceAccountController) Name() string {
+	return "serviceaccount"
+}
+
+// 写入的模型，按字段的write标签校验创建和更新请求
+func (*ServiceAccountController) Model() interface{} {
+	return &models.ServiceAccount{}
+}
+
+// Create 创建服务账号，管理员或所属模块的owner、maintainer可以创建
+func (sc *ServiceAccountController) Create() (gin.HandlerFunc, error) {
+	return func(c *gin.Context) {
+		u := web.GetCurrentUser(c)
+		if u.IsServiceAccount() {
+			c.JSON(http.StatusOK, web.ExceptResponse(errorMap[ErrByServiceAccount], ErrByServiceAccount))
+			return
+		}
+		var sa models.ServiceAccount
+		if err := c.ShouldBindJSON(&sa); err != nil {
+			c.JSON(http.StatusBadRequest, web.ExceptResponse(errorMap[ErrInvalidParam], err))
+			return
+		}
+		if sa.ModuleID != 0 {
+			if err := sc.Store.Get(context.TODO(), sa.ModuleID, "", &models.Module{}); err != nil {
+				c.JSON(http.StatusOK, web.ExceptResponse(errorMap[ErrInvalidParam], "module not found"))
+				return
+			}
+		}
+		if sa.ProjectID != 0 {
+			if err := sc.Store.Get(context.TODO(), sa.ProjectID, "", &models.Project{}); err != nil {
+				c.JSON(http.StatusOK, web.ExceptResponse(errorMap[ErrInvalidParam], "project not found"))
+				return
+			}
+		}
+		if !view.ServiceAccountManageable(sc.Store, u, &sa) {
+			c.JSON(http.StatusOK, web.ExceptResponse(errorMap[ErrNoPermission], ErrNoPermission))
+			return
+		}
+		sa.CreatedBy = u.ID
+		sa.Enabled = true
+		log.Infow("create service account", "name", sa.Name, "module", sa.ModuleID, "project", sa.ProjectID, "operator", u.Name)
+		if err := sc.Store.Create(context.TODO(), &sa); err != nil {
+			c.JSON(http.StatusOK, web.ExceptResponse(errorMap[ErrCreateServiceAccountFailed], err))
+			return
+		}
+		c.JSON(http.StatusOK, web.DataResponse(sa))
+	}, nil
+}
+
+// Delete 删除服务账号及其所有令牌和模块上的角色绑定
+func (sc *ServiceAccountController) Delete() (gin.HandlerFunc, error) {
+	return func(c *gin.Context) {
+		sa, ok := sc.manageable(c)
+		if !ok {
+			return
+		}
+		log.Infow("delete service account", "name", sa.Name, "operator", web.GetCurrentUser(c).Name)
+		if err := sc.Store.DeleteWhere(context.TODO(), &models.ServiceAccountToken{}, "service_account_id = ?", sa.ID); err != nil {
+			c.JSON(http.StatusOK, web.ExceptResponse(errorMap[ErrDeleteServiceAccountFailed], err))
+			return
+		}
+		var members []models.ModuleMember
+		if err := sc.Store.FindWhere(context.TODO(), &members, "service_account_id = ?", sa.ID); err != nil {
+			c.JSON(http.StatusOK, web.ExceptResponse(errorMap[ErrDeleteServiceAccountFailed], err))
+			return
+		}
+		if err := sc.Store.DeleteWhere(context.TODO(), &models.ModuleMember{}, "service_account_id = ?", sa.ID); err != nil {
+			c.JSON(http.StatusOK, web.ExceptResponse(errorMap[ErrDeleteServiceAccountFailed], err))
+			return
+		}
+		if err := sc.Store.Delete(context.TODO(), sa.ID, "", &models.ServiceAccount{}); err != nil {
+			c.JSON(http.StatusOK, web.ExceptResponse(errorMap[ErrDeleteServiceAccountFailed], err))
+			return
+		}
+		for _, m := range members {
+			view.NotifyGrantChanged(m.ModuleID)
+		}
+		// 删除服务账号的角色绑定，避免同名的新服务账号继承
+		if err := casbin.RemoveSubject(sc.Enforcer, token.ServiceAccountName(sa.Name)); err != nil {
+			log.Errorw("remove service account policies error", "name", sa.Name, "error", err)
+		}
+		c.JSON(http.StatusOK, web.OkResponse())
+	}, nil
+}
+
+// Update 更新服务账号的描述和启用状态，名称和所属不能修改
+func (sc *ServiceAccountController) Update() (gin.HandlerFunc, error) {
+	return func(c *gin.Context) {
+		var f UpdateForm
+		if err := c.ShouldBindJSON(&f); err != nil {
+			c.JSON(http.StatusBadRequest, web.ExceptResponse(errorMap[ErrInvalidParam], err))
+			return
+		}
+		sa, ok := sc.manageable(c)
+		if !ok {
+			return
+		}
+		updates := map[string]interface{}{}
+		if f.Description != nil {
+			updates["description"] = *f.Description
+		}
+		if f.Enabled != nil {
+			updates["enabled"] = *f.Enabled
+		}
+		if len(updates) > 0 {
+			if err := sc.Store.Update(context.TODO(), sa.ID, "", &models.ServiceAccount{}, updates); err != nil {
+				c.JSON(http.StatusOK, web.ExceptResponse(errorMap[ErrUpdateServiceAccountFailed], err))
+				return
+			}
+		}
+		if err := sc.Store.Get(context.TODO(), sa.ID, "", sa); err != nil {
+			c.JSON(http.StatusOK, web.ExceptResponse(errorMap[ErrGetServiceAccountFailed], err))
+			return
+		}
+		c.JSON(http.StatusOK, web.DataResponse(sa))
+	}, nil
+}
+
+// Get 获取服务账号详情
+func (sc *ServiceAccountController) Get() (gin.HandlerFunc, error) {
+	return func(c *gin.Context) {
+		sa, ok := sc.manageable(c)
+		if !ok {
+			return
+		}
+		c.JSON(http.StatusOK, web.DataResponse(sa))
+	}, nil
+}
+
+// List 获取服务账号列表，与用户列表分开，非管理员只能看到所在模块和项目的服务账号
+func (sc *ServiceAccountController) List() (gin.HandlerFunc, error) {
+	return func(c *gin.Context) {
+		var req web.Request
+		if err := c.ShouldBindQuery(&req); err != nil {
+			c.JSON(http.StatusBadRequest, web.ExceptResponse(errorMap[ErrInvalidParam], err))
+			return
+		}
+		req.Default()
+		u := web.GetCurrentUser(c)
+		var condition string
+		if !u.Admin {
+			modules, projects, err := memberScope(sc.Store, u)
+			if err != nil {
+				c.JSON(http.StatusOK, web.ExceptResponse(errorMap[ErrGetServiceAccountListFailed], err))
+				return
+			}
+			if len(modules) == 0 && len(projects) == 0 {
+				c.JSON(http.StatusOK, web.ListResponse(0, []models.ServiceAccount{}))
+				return
+			}
+			// 项目上的服务账号module_id为0，模块上的project_id为0，不能用0补齐空的条件
+			var conditions []string
+			if len(modules) > 0 {
+				conditions = append(conditions, fmt.Sprintf("module_id IN (%s)", joinIDs(modules)))
+			}
+			if len(projects) > 0 {
+				conditions = append(conditions, fmt.Sprintf("project_id IN (%s)", joinIDs(projects)))
+			}
+			condition = strings.Join(conditions, " OR ")
+		}
+		var sas []models.ServiceAccount
+		total, err := sc.Store.List(context.TODO(), req.Limit, req.Page, condition, &sas)
+		if err != nil {
+			c.JSON(http.StatusOK, web.ExceptResponse(errorMap[ErrGetServiceAccountListFailed], err))
+			return
+		}
+		c.JSON(http.StatusOK, web.ListResponse(int(total), sas))
+	}, nil
+}
+
+func (sc *ServiceAccountController) Middlewares() []web.MiddlewaresObject {
+	return []web.MiddlewaresObject{
+		{
+			Methods:     []string{web.CREATE, web.DELETE, web.UPDATE, web.GET, web.LIST},
+			Middlewares: []gin.HandlerFunc{web.LoginRequired()},
+		},
+	}
+}
+
+// manageable 获取路径中的服务账号，并校验当前用户是否可以管理
+func (sc *ServiceAccountController) manageable(c *gin.Context) (*models.ServiceAccount, bool) {
+	return getManageable(c, sc.Store)
+}
+
+// getManageable 获取路径中id对应的服务账号，并校验当前用户是否可以管理
+func getManageable(c *gin.Context, s *storage.Engine) (*models.ServiceAccount, bool) {
+	u := web.GetCurrentUser(c)
+	if u.IsServiceAccount() {
+		c.JSON(http.StatusOK, web.ExceptResponse(errorMap[ErrByServiceAccount], ErrByServiceAccount))
+		return nil, false
+	}
+	id, err := view.GetID(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, web.ExceptResponse(errorMap[ErrID], err))
+		return nil, false
+	}
+	var sa models.ServiceAccount
+	if err := s.Get(context.TODO(), id, "", &sa); err != nil {
+		c.JSON(http.StatusOK, web.ExceptResponse(errorMap[ErrGetServiceAccountFailed], err))
+		return nil, false
+	}
+	if !view.ServiceAccountManageable(s, u, &sa) {
+		c.JSON(http.StatusOK, web.ExceptResponse(errorMap[ErrNoPermission], ErrNoPermission))
+		return nil, false
+	}
+	return &sa, true
+}
+
+// memberScope 返回用户直接或通过用户组所在的模块及其下级模块，以及这些模块下的项目和只在项目上绑定了角色的项目
+func memberScope(s *storage.Engine, u *token.Claims) ([]uint, []uint, error) {
+	// 服务账号的id为0，会匹配到所有用户组和服务账号的角色绑定
+	if u.IsServiceAccount() {
+		return nil, nil, nil
+	}
+	members, err := view.UserMembers(s, u.ID)
+	if err != nil {
+		return nil, nil, err
+	}
+	grants, err := view.UserProjectMembers(s, u.ID)
+	if err != nil {
+		return nil, nil, err
+	}
+	var projects []uint
+	for _, m := range grants {
+		projects = append(projects, m.ProjectID)
+	}
+	if len(members) == 0 {
+		return nil, projects, nil
+	}
+	var ids []uint
+	for _, m := range members {
+		ids = append(ids, m.ModuleID)
+	}
+	modules, err := view.ModuleDescendants(s, ids)
+	if err != nil {
+		return nil, nil, err
+	}
+	var ps []models.Project
+	if err := s.FindWhere(context.TODO(), &ps, "module_id IN ?", modules); err != nil {
+		return nil, nil, err
+	}
+	for _, p := range ps {
+		projects = append(projects, p.ID)
+	}
+	return modules, projects, nil
+}
+
+func joinIDs(ids []uint) string {
+	s := make([]string, 0, len(ids))
+	for _, id := range ids {
+		s = append(s, fmt.Sprint(id))
+	}
+	return strings.Join(s, ",")
+}
@@ -0,0 +1,152 @@
+package serviceaccount
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/fize/go-ext/log"
+	"github.com/gin-gonic/gin"
+	"github.com/hex-techs/blade/pkg/models"
+	"github.com/hex-techs/blade/pkg/utils/storage"
+	"github.com/hex-techs/blade/pkg/utils/token"
+	"github.com/hex-techs/blade/pkg/utils/web"
+)
+
+// TokenController 服务账号令牌控制器，挂载在 /serviceaccount/:id/token 下
+type TokenController struct {
+	web.DefaultController
+	Store *storage.Engine
+}
+
+// NewTokenController return a new service account token controller
+func NewTokenController(s *storage.Engine) *TokenController {
+	return &TokenController{
+		Store: s,
+	}
+}
+
+// 资源名
+func (*TokenController) Name() string {
+	return "token"
+}
+
+// 写入的模型，按字段的write标签校验创建和更新请求
+func (*TokenController) Model() interface{} {
+	return &models.ServiceAccountToken{}
+}
+
+// Create 为服务账号创建令牌，必须设置过期时间和权限范围，令牌明文只在此时返回一次
+func (tc *TokenController) Create() (gin.HandlerFunc, error) {
+	return func(c *gin.Context) {
+		var sat models.ServiceAccountToken
+		if err := c.ShouldBindJSON(&sat); err != nil {
+			c.JSON(http.StatusBadRequest, web.ExceptResponse(errorMap[ErrInvalidParam], err))
+			return
+		}
+		sa, ok := getManageable(c, tc.Store)
+		if !ok {
+			return
+		}
+		sat.ServiceAccountID = sa.ID
+		if err := sat.GenToken(); err != nil {
+			c.JSON(http.StatusOK, web.ExceptResponse(errorMap[ErrCreateTokenFailed], err))
+			return
+		}
+		log.Infow("create service account token", "serviceaccount", sa.Name, "name", sat.Name,
+			"scopes", sat.Scopes, "expiresAt", sat.ExpiresAt, "operator", web.GetCurrentUser(c).Name)
+		if err := tc.Store.Create(context.TODO(), &sat); err != nil {
+			c.JSON(http.StatusOK, web.ExceptResponse(errorMap[ErrCreateTokenFailed], err))
+			return
+		}
+		c.JSON(http.StatusOK, web.DataResponse(sat))
+	}, nil
+}
+
+// Delete 吊销服务账号令牌
+func (tc *TokenController) Delete() (gin.HandlerFunc, error) {
+	return func(c *gin.Context) {
+		tid, err := strconv.Atoi(c.Param("tid"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, web.ExceptResponse(errorMap[ErrID], err))
+			return
+		}
+		sa, ok := getManageable(c, tc.Store)
+		if !ok {
+			return
+		}
+		var sat models.ServiceAccountToken
+		if err := tc.Store.Get(context.TODO(), uint(tid), "", &sat); err != nil || sat.ServiceAccountID != sa.ID {
+			c.JSON(http.StatusOK, web.ExceptResponse(errorMap[ErrRevokeTokenFailed], "token not found"))
+			return
+		}
+		log.Infow("revoke service account token", "serviceaccount", sa.Name, "name", sat.Name,
+			"operator", web.GetCurrentUser(c).Name)
+		if err := tc.Store.Delete(context.TODO(), sat.ID, "", &models.ServiceAccountToken{}); err != nil {
+			c.JSON(http.StatusOK, web.ExceptResponse(errorMap[ErrRevokeTokenFailed], err))
+			return
+		}
+		c.JSON(http.StatusOK, web.OkResponse())
+	}, nil
+}
+
+// List 获取服务账号的令牌列表，不包含令牌明文
+func (tc *TokenController) List() (gin.HandlerFunc, error) {
+	return func(c *gin.Context) {
+		sa, ok := getManageable(c, tc.Store)
+		if !ok {
+			return
+		}
+		var req web.Request
+		c.ShouldBindQuery(&req)
+		req.Default()
+		var sats []models.ServiceAccountToken
+		total, err := tc.Store.List(context.TODO(), req.Limit, req.Page, "service_account_id = "+fmt.Sprint(sa.ID), &sats)
+		if err != nil {
+			c.JSON(http.StatusOK, web.ExceptResponse(errorMap[ErrGetTokenListFailed], err))
+			return
+		}
+		c.JSON(http.StatusOK, web.ListResponse(int(total), sats))
+	}, nil
+}
+
+func (tc *TokenController) Middlewares() []web.MiddlewaresObject {
+	return []web.MiddlewaresObject{
+		{
+			Methods:     []string{web.CREATE, web.DELETE, web.LIST},
+			Middlewares: []gin.HandlerFunc{web.LoginRequired()},
+		},
+	}
+}
+
+// Resolve 将服务账号令牌解析为服务账号的信息，供 web.LoginRequired 使用
+func (tc *TokenController) Resolve(t string) (*token.Claims, error) {
+	var sat models.ServiceAccountToken
+	if err := tc.Store.GetBy(context.TODO(), "hash", token.Hash(t), &sat); err != nil {
+		return nil, fmt.Errorf("service account token invalid")
+	}
+	if err := sat.Validate(); err != nil {
+		return nil, err
+	}
+	var sa models.ServiceAccount
+	if err := tc.Store.Get(context.TODO(), sat.ServiceAccountID, "", &sa); err != nil {
+		return nil, fmt.Errorf("service account invalid: %v", err)
+	}
+	if !sa.Enabled {
+		return nil, fmt.Errorf("service account disabled")
+	}
+	// 降低写入频率，最近使用时间精确到分钟即可
+	if sat.LastUsedAt == nil || time.Since(*sat.LastUsedAt) > time.Minute {
+		if err := tc.Store.Update(context.TODO(), sat.ID, "", &models.ServiceAccountToken{},
+			map[string]interface{}{"last_used_at": time.Now()}); err != nil {
+			log.Warnw("update service account token last used time error", "id", sat.ID, "error", err)
+		}
+	}
+	return &token.Claims{
+		Name:   token.ServiceAccountName(sa.Name),
+		Kind:   token.KindServiceAccount,
+		Scopes: sat.Scopes,
+	}, nil
+}
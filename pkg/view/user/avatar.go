@@ -0,0 +1,128 @@
+package user
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/hex-techs/blade/pkg/models"
+	"github.com/hex-techs/blade/pkg/utils/config"
+	"github.com/hex-techs/blade/pkg/utils/web"
+	"github.com/hex-techs/blade/pkg/view"
+	"gorm.io/gorm"
+)
+
+// 允许上传的头像类型，根据内容识别，不允许svg，避免在页面中执行脚本
+var avatarTypes = map[string]bool{
+	"image/png":  true,
+	"image/jpeg": true,
+	"image/gif":  true,
+	"image/webp": true,
+}
+
+// UploadAvatar 上传当前用户的头像，表单字段为avatar，替换已有的头像
+func (uc *UserController) UploadAvatar(c *gin.Context) {
+	u := web.GetCurrentUser(c)
+	if u.IsServiceAccount() {
+		c.JSON(http.StatusOK, web.ExceptResponse(errorMap[ErrNotUser], ErrNotUser))
+		return
+	}
+	limit := config.Read().Service.AvatarMaxSize
+	// multipart的边界和表头需要额外的空间
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, limit+4096)
+	data, err := readAvatar(c, limit)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, web.ExceptResponse(errorMap[ErrAvatarInvalid], ErrAvatarInvalid, ": ", err))
+		return
+	}
+	avatar := models.UserAvatar{UserID: u.ID, ContentType: http.DetectContentType(data), Data: data}
+	if !avatarTypes[avatar.ContentType] {
+		c.JSON(http.StatusBadRequest, web.ExceptResponse(errorMap[ErrAvatarInvalid], ErrAvatarInvalid))
+		return
+	}
+	var old models.UserAvatar
+	err = uc.Store.GetBy(context.TODO(), "user_id", u.ID, &old)
+	switch {
+	case err == nil:
+		avatar.ID, avatar.CreatedAt = old.ID, old.CreatedAt
+		err = uc.Store.ForceUpdate(context.TODO(), old.ID, "", &models.UserAvatar{}, &avatar)
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		err = uc.Store.Create(context.TODO(), &avatar)
+	}
+	if err != nil {
+		c.JSON(http.StatusOK, web.ExceptResponse(errorMap[ErrUpdateAvatarFailed], err))
+		return
+	}
+	// 地址带上版本号，前端可以长期缓存
+	url := fmt.Sprintf("/api/v1/user/%d/avatar?v=%d", u.ID, time.Now().UnixNano())
+	if err := uc.Store.Update(context.TODO(), u.ID, "", &models.User{},
+		map[string]interface{}{"avatar": url}); err != nil {
+		c.JSON(http.StatusOK, web.ExceptResponse(errorMap[ErrUpdateAvatarFailed], err))
+		return
+	}
+	uc.Me(c)
+}
+
+// readAvatar 读取上传的头像，超过大小上限时返回错误
+func readAvatar(c *gin.Context, limit int64) ([]byte, error) {
+	fh, err := c.FormFile("avatar")
+	if err != nil {
+		return nil, err
+	}
+	if fh.Size > limit {
+		return nil, fmt.Errorf("larger than %d bytes", limit)
+	}
+	f, err := fh.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	data, err := io.ReadAll(io.LimitReader(f, limit+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(data)) > limit {
+		return nil, fmt.Errorf("larger than %d bytes", limit)
+	}
+	return data, nil
+}
+
+// DeleteAvatar 删除当前用户的头像
+func (uc *UserController) DeleteAvatar(c *gin.Context) {
+	u := web.GetCurrentUser(c)
+	if u.IsServiceAccount() {
+		c.JSON(http.StatusOK, web.ExceptResponse(errorMap[ErrNotUser], ErrNotUser))
+		return
+	}
+	if err := uc.Store.DeleteWhere(context.TODO(), &models.UserAvatar{}, "user_id = ?", u.ID); err != nil {
+		c.JSON(http.StatusOK, web.ExceptResponse(errorMap[ErrUpdateAvatarFailed], err))
+		return
+	}
+	if err := uc.Store.Update(context.TODO(), u.ID, "", &models.User{},
+		map[string]interface{}{"avatar": ""}); err != nil {
+		c.JSON(http.StatusOK, web.ExceptResponse(errorMap[ErrUpdateAvatarFailed], err))
+		return
+	}
+	c.JSON(http.StatusOK, web.OkResponse())
+}
+
+// Avatar 获取用户的头像图片，登录用户都可以获取
+func (uc *UserController) Avatar(c *gin.Context) {
+	id, err := view.GetID(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, web.ExceptResponse(errorMap[ErrID], err))
+		return
+	}
+	var avatar models.UserAvatar
+	if err := uc.Store.GetBy(context.TODO(), "user_id", id, &avatar); err != nil {
+		c.JSON(http.StatusNotFound, web.ExceptResponse(errorMap[ErrAvatarNotFound], ErrAvatarNotFound))
+		return
+	}
+	c.Header("X-Content-Type-Options", "nosniff")
+	c.Header("Cache-Control", "private, max-age=86400")
+	c.Data(http.StatusOK, avatar.ContentType, avatar.Data)
+}
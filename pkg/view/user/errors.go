@@ -25,18 +25,91 @@ const (
 	ErrGenerateUserToken = "generate user token failed"
 	// 不能删除管理员
 	ErrDeleteAdmin = "can not delete admin"
+	// 不能管理其他用户的访问令牌
+	ErrTokenOther = "can not manage other user's access token"
+	// 不能使用访问令牌创建访问令牌
+	ErrTokenByToken = "can not create access token with access token"
+	// 创建访问令牌失败
+	ErrCreateTokenFailed = "create access token failed"
+	// 吊销访问令牌失败
+	ErrRevokeTokenFailed = "revoke access token failed"
+	// 获取访问令牌列表失败
+	ErrGetTokenListFailed = "get access token list failed"
+	// 密码不符合密码策略
+	ErrPasswordPolicy = "password does not meet the password policy"
+	// 创建邀请失败
+	ErrCreateInvitationFailed = "create invitation failed"
+	// 获取邀请失败
+	ErrGetInvitationFailed = "get invitation failed"
+	// 删除邀请失败
+	ErrDeleteInvitationFailed = "delete invitation failed"
+	// 邮箱已经注册
+	ErrEmailRegistered = "email already registered"
+	// 模块不存在
+	ErrModuleNotFound = "module not found"
+	// 离职处理失败
+	ErrOffboardFailed = "offboard user failed"
+	// 不能处理自己离职
+	ErrOffboardSelf = "can not offboard yourself"
+	// 不能处理内置管理员离职
+	ErrOffboardAdmin = "can not offboard built-in admin"
+	// 接手用户无效
+	ErrTransferUserInvalid = "transfer user invalid"
+	// 当前身份不是用户，如服务账号
+	ErrNotUser = "current identity is not a user"
+	// 邮箱由身份源管理，不能修改
+	ErrEmailManaged = "email is managed by the identity provider"
+	// 邮箱后缀不允许
+	ErrEmailNotAllowed = "email not allowed"
+	// 发送验证邮件失败
+	ErrSendVerifyEmailFailed = "send verify email failed"
+	// 获取偏好设置失败
+	ErrGetPreferencesFailed = "get preferences failed"
+	// 更新偏好设置失败
+	ErrUpdatePreferencesFailed = "update preferences failed"
+	// 头像不合法
+	ErrAvatarInvalid = "avatar must be a png, jpeg, gif or webp image within the size limit"
+	// 头像不存在
+	ErrAvatarNotFound = "avatar not found"
+	// 更新头像失败
+	ErrUpdateAvatarFailed = "update avatar failed"
 )
 
 var errorMap = map[string]int{
-	ErrCreateUserFailed:  20001,
-	ErrDeleteUserFailed:  20002,
-	ErrDeleteSelf:        20003,
-	ErrUpdateOther:       20004,
-	ErrID:                20005,
-	ErrUpdateUserFailed:  20006,
-	ErrGetOther:          20007,
-	ErrGetUserFailed:     20008,
-	ErrGetUserListFailed: 20009,
-	ErrInvalidParam:      20010,
-	ErrGenerateUserToken: 20011,
+	ErrCreateUserFailed:        20001,
+	ErrDeleteUserFailed:        20002,
+	ErrDeleteSelf:              20003,
+	ErrUpdateOther:             20004,
+	ErrID:                      20005,
+	ErrUpdateUserFailed:        20006,
+	ErrGetOther:                20007,
+	ErrGetUserFailed:           20008,
+	ErrGetUserListFailed:       20009,
+	ErrInvalidParam:            20010,
+	ErrGenerateUserToken:       20011,
+	ErrDeleteAdmin:             20012,
+	ErrTokenOther:              20013,
+	ErrTokenByToken:            20014,
+	ErrCreateTokenFailed:       20015,
+	ErrRevokeTokenFailed:       20016,
+	ErrGetTokenListFailed:      20017,
+	ErrPasswordPolicy:          20018,
+	ErrCreateInvitationFailed:  20019,
+	ErrGetInvitationFailed:     20020,
+	ErrDeleteInvitationFailed:  20021,
+	ErrEmailRegistered:         20022,
+	ErrModuleNotFound:          20023,
+	ErrOffboardFailed:          20024,
+	ErrOffboardSelf:            20025,
+	ErrOffboardAdmin:           20026,
+	ErrTransferUserInvalid:     20027,
+	ErrNotUser:                 20028,
+	ErrEmailManaged:            20029,
+	ErrEmailNotAllowed:         20030,
+	ErrSendVerifyEmailFailed:   20031,
+	ErrGetPreferencesFailed:    20032,
+	ErrUpdatePreferencesFailed: 20033,
+	ErrAvatarInvalid:           20034,
+	ErrAvatarNotFound:          20035,
+	ErrUpdateAvatarFailed:      20036,
 }
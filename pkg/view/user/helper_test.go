@@ -0,0 +1,47 @@
+package user
+
+import (
+	"context"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/hex-techs/blade/pkg/models"
+	"github.com/hex-techs/blade/pkg/utils/testutil"
+	"github.com/hex-techs/blade/pkg/utils/token"
+	"github.com/hex-techs/blade/pkg/utils/web"
+)
+
+// newTestServer 使用临时目录中的配置和sqlite数据库安装用户接口
+func newTestServer(t *testing.T) (*gin.Engine, *UserController) {
+	t.Helper()
+	s := testutil.NewStore(t, "", &models.User{}, &models.PersonalAccessToken{}, &models.RefreshToken{},
+		&models.Session{}, &models.UserPreference{}, &models.UserAvatar{})
+	web.SetAuthorizer(allowAll{})
+	t.Cleanup(func() { web.SetAuthorizer(nil) })
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	uc := NewUserController(s, nil)
+	api := web.RestfulAPI{PostParameter: "/:id"}
+	api.Install(r, uc)
+	return r, uc
+}
+
+// allowAll 允许所有请求，测试只关心接口自身的校验
+type allowAll struct{}
+
+func (allowAll) Authorize(*token.Claims, string, string) (bool, error) {
+	return true, nil
+}
+
+// createUser 创建用户并签发token
+func createUser(t *testing.T, uc *UserController, name string, admin bool) *models.User {
+	t.Helper()
+	u := &models.User{Name: name, CnName: name, Email: name + "@example.com", Admin: admin, Enabled: true}
+	if err := uc.Store.Create(context.TODO(), u); err != nil {
+		t.Fatal(err)
+	}
+	if err := u.GenUser("test"); err != nil {
+		t.Fatal(err)
+	}
+	return u
+}
@@ -0,0 +1,142 @@
+package user
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"github.com/fize/go-ext/log"
+	"github.com/gin-gonic/gin"
+	"github.com/hex-techs/blade/pkg/models"
+	"github.com/hex-techs/blade/pkg/utils/config"
+	"github.com/hex-techs/blade/pkg/utils/storage"
+	"github.com/hex-techs/blade/pkg/utils/web"
+	"github.com/hex-techs/blade/pkg/view"
+)
+
+// InvitationController 邀请注册控制器，只有管理员可以管理邀请
+type InvitationController struct {
+	web.DefaultController
+	Store *storage.Engine
+}
+
+// NewInvitationController return a new invitation controller
+func NewInvitationController(s *storage.Engine) web.RestController {
+	return &InvitationController{
+		Store: s,
+	}
+}
+
+// 资源名
+func (*InvitationController) Name() string {
+	return "invitation"
+}
+
+// 写入的模型，按字段的write标签校验创建和更新请求
+func (*InvitationController) Model() interface{} {
+	return &models.Invitation{}
+}
+
+// Create 创建邀请，配置了邮件服务时发送邀请邮件，邀请令牌只在此时返回一次
+func (ic *InvitationController) Create() (gin.HandlerFunc, error) {
+	return func(c *gin.Context) {
+		var inv models.Invitation
+		if err := c.ShouldBindJSON(&inv); err != nil {
+			c.JSON(http.StatusBadRequest, web.ExceptResponse(errorMap[ErrInvalidParam], err))
+			return
+		}
+		if err := ic.Store.GetBy(context.TODO(), "email", inv.Email, &models.User{}); err == nil {
+			c.JSON(http.StatusOK, web.ExceptResponse(errorMap[ErrEmailRegistered], ErrEmailRegistered))
+			return
+		}
+		for _, g := range inv.Modules {
+			if !ic.Store.IsExist(context.TODO(), g.ModuleID, "", &models.Module{}) {
+				c.JSON(http.StatusOK, web.ExceptResponse(errorMap[ErrModuleNotFound], ErrModuleNotFound, ": ", g.ModuleID))
+				return
+			}
+		}
+		inv.InvitedBy = web.GetCurrentUser(c).ID
+		inv.Used = false
+		inv.UserID = 0
+		if err := inv.GenToken(config.Read().Service.InvitationExpired); err != nil {
+			c.JSON(http.StatusOK, web.ExceptResponse(errorMap[ErrCreateInvitationFailed], err))
+			return
+		}
+		if err := ic.Store.Create(context.TODO(), &inv); err != nil {
+			c.JSON(http.StatusOK, web.ExceptResponse(errorMap[ErrCreateInvitationFailed], err))
+			return
+		}
+		log.Infow("create invitation", "email", inv.Email, "invitedBy", inv.InvitedBy)
+		// 邮件发送失败不影响创建，管理员可以将返回的令牌转交给被邀请人
+		if view.EmailEnabled() {
+			body := fmt.Sprintf("您被邀请注册Blade： %s%s/%s，有效时间%d秒。",
+				config.Read().Service.Domain, config.Read().Service.InvitePath,
+				inv.Token, config.Read().Service.InvitationExpired)
+			if err := view.SendEmail(inv.Email, "Invitation", body); err != nil {
+				log.Warnw("send invitation email error", "email", inv.Email, "error", err)
+			}
+		}
+		c.JSON(http.StatusOK, web.DataResponse(inv))
+	}, nil
+}
+
+// Delete 撤销邀请
+func (ic *InvitationController) Delete() (gin.HandlerFunc, error) {
+	return func(c *gin.Context) {
+		id, err := view.GetID(c)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, web.ExceptResponse(errorMap[ErrID], err))
+			return
+		}
+		if err := ic.Store.Delete(context.TODO(), id, "", &models.Invitation{}); err != nil {
+			c.JSON(http.StatusOK, web.ExceptResponse(errorMap[ErrDeleteInvitationFailed], err))
+			return
+		}
+		c.JSON(http.StatusOK, web.OkResponse())
+	}, nil
+}
+
+// Get 获取邀请详情
+func (ic *InvitationController) Get() (gin.HandlerFunc, error) {
+	return func(c *gin.Context) {
+		id, err := view.GetID(c)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, web.ExceptResponse(errorMap[ErrID], err))
+			return
+		}
+		var inv models.Invitation
+		if err := ic.Store.Get(context.TODO(), id, "", &inv); err != nil {
+			c.JSON(http.StatusOK, web.ExceptResponse(errorMap[ErrGetInvitationFailed], err))
+			return
+		}
+		c.JSON(http.StatusOK, web.DataResponse(inv))
+	}, nil
+}
+
+// List 获取邀请列表
+func (ic *InvitationController) List() (gin.HandlerFunc, error) {
+	return func(c *gin.Context) {
+		var req web.Request
+		if err := c.ShouldBindQuery(&req); err != nil {
+			c.JSON(http.StatusBadRequest, web.ExceptResponse(errorMap[ErrInvalidParam], err))
+			return
+		}
+		req.Default()
+		var invs []models.Invitation
+		total, err := ic.Store.List(context.TODO(), req.Limit, req.Page, "", &invs)
+		if err != nil {
+			c.JSON(http.StatusOK, web.ExceptResponse(errorMap[ErrGetInvitationFailed], err))
+			return
+		}
+		c.JSON(http.StatusOK, web.ListResponse(int(total), invs))
+	}, nil
+}
+
+func (ic *InvitationController) Middlewares() []web.MiddlewaresObject {
+	return []web.MiddlewaresObject{
+		{
+			Methods:     []string{web.CREATE, web.DELETE, web.GET, web.LIST},
+			Middlewares: []gin.HandlerFunc{web.LoginRequired()},
+		},
+	}
+}
@@ -0,0 +1,130 @@
+package user
+
+import (
+	"context"
+	"net/http"
+	"strings"
+
+	"github.com/fize/go-ext/log"
+	"github.com/gin-gonic/gin"
+	"github.com/hex-techs/blade/pkg/models"
+	"github.com/hex-techs/blade/pkg/utils/config"
+	"github.com/hex-techs/blade/pkg/utils/web"
+	"github.com/hex-techs/blade/pkg/view"
+)
+
+// Profile 当前用户的信息
+type Profile struct {
+	models.User
+	// 已发送验证邮件的新邮箱，验证后才生效
+	PendingEmail string `json:"pendingEmail,omitempty"`
+}
+
+// MeForm 修改当前用户的资料，没有传入的字段不修改
+type MeForm struct {
+	// 中文名称
+	CnName *string `json:"cnName" binding:"omitempty,min=1,max=64"`
+	// 新邮箱，验证后才生效
+	Email *string `json:"email" binding:"omitempty,email"`
+	// 电话号码
+	Phone *string `json:"phone" binding:"omitempty,max=32"`
+	// 社交账号
+	IM *string `json:"im" binding:"omitempty,max=128"`
+}
+
+// Me 获取当前用户的信息，前端不需要解析token获取用户id
+func (uc *UserController) Me(c *gin.Context) {
+	user, ok := uc.current(c)
+	if !ok {
+		return
+	}
+	user.TruncatePassword()
+	c.JSON(http.StatusOK, web.DataResponse(Profile{User: *user}))
+}
+
+// UpdateMe 修改当前用户的资料，修改邮箱时向新邮箱发送验证链接，验证后才生效
+func (uc *UserController) UpdateMe(c *gin.Context) {
+	var f MeForm
+	if err := c.ShouldBindJSON(&f); err != nil {
+		c.JSON(http.StatusBadRequest, web.ExceptResponse(errorMap[ErrInvalidParam], err))
+		return
+	}
+	user, ok := uc.current(c)
+	if !ok {
+		return
+	}
+	var pending string
+	if f.Email != nil && !strings.EqualFold(*f.Email, user.Email) {
+		if !uc.checkEmail(c, user, *f.Email) {
+			return
+		}
+		pending = *f.Email
+	}
+	updates := map[string]interface{}{}
+	if f.CnName != nil {
+		updates["cn_name"] = *f.CnName
+	}
+	if f.Phone != nil {
+		updates["phone"] = *f.Phone
+	}
+	if f.IM != nil {
+		updates["im"] = *f.IM
+	}
+	if len(updates) > 0 {
+		if err := uc.Store.Update(context.TODO(), user.ID, "", &models.User{}, updates); err != nil {
+			c.JSON(http.StatusOK, web.ExceptResponse(errorMap[ErrUpdateUserFailed], err))
+			return
+		}
+	}
+	if pending != "" {
+		if err := view.SendVerifyEmail(user, pending); err != nil {
+			c.JSON(http.StatusOK, web.ExceptResponse(errorMap[ErrSendVerifyEmailFailed], err))
+			return
+		}
+		log.Infow("send email change verification", "user", user.Name, "email", pending)
+	}
+	if err := uc.Store.Get(context.TODO(), user.ID, "", user); err != nil {
+		c.JSON(http.StatusOK, web.ExceptResponse(errorMap[ErrGetUserFailed], err))
+		return
+	}
+	user.TruncatePassword()
+	c.JSON(http.StatusOK, web.DataResponse(Profile{User: *user, PendingEmail: pending}))
+}
+
+// current 获取当前登录的用户，服务账号没有用户信息
+func (uc *UserController) current(c *gin.Context) (*models.User, bool) {
+	u := web.GetCurrentUser(c)
+	if u.IsServiceAccount() {
+		c.JSON(http.StatusOK, web.ExceptResponse(errorMap[ErrNotUser], ErrNotUser))
+		return nil, false
+	}
+	var user models.User
+	if err := uc.Store.Get(context.TODO(), u.ID, "", &user); err != nil {
+		c.JSON(http.StatusOK, web.ExceptResponse(errorMap[ErrGetUserFailed], err))
+		return nil, false
+	}
+	return &user, true
+}
+
+// checkEmail 校验是否可以修改为新邮箱，身份源同步的用户邮箱由身份源管理
+func (uc *UserController) checkEmail(c *gin.Context, user *models.User, email string) bool {
+	if user.Source != models.SourceLocal {
+		c.JSON(http.StatusOK, web.ExceptResponse(errorMap[ErrEmailManaged], ErrEmailManaged))
+		return false
+	}
+	// 与注册一样限制邮箱后缀
+	if cfg := config.Read().Service; cfg.RegistrationMode == config.RegistrationDomain &&
+		!strings.EqualFold(email[strings.LastIndex(email, "@")+1:], cfg.Company) {
+		c.JSON(http.StatusOK, web.ExceptResponse(errorMap[ErrEmailNotAllowed], ErrEmailNotAllowed))
+		return false
+	}
+	if err := uc.Store.GetBy(context.TODO(), "email", email, &models.User{}); err == nil {
+		c.JSON(http.StatusOK, web.ExceptResponse(errorMap[ErrEmailRegistered], ErrEmailRegistered))
+		return false
+	}
+	if !view.EmailEnabled() {
+		c.JSON(http.StatusOK, web.ExceptResponse(errorMap[ErrSendVerifyEmailFailed], view.ErrEmailNotConfigured))
+		return false
+	}
+	return true
+}
@@ -0,0 +1,118 @@
+package user
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/fize/go-ext/log"
+	"github.com/gin-gonic/gin"
+	"github.com/hex-techs/blade/pkg/models"
+	"github.com/hex-techs/blade/pkg/utils/web"
+	"github.com/hex-techs/blade/pkg/view"
+)
+
+// OffboardForm 离职表单
+type OffboardForm struct {
+	// 接手项目的用户名，为空时只报告用户负责的项目
+	TransferTo string `json:"transferTo"`
+}
+
+// OffboardReport 离职处理结果
+type OffboardReport struct {
+	// 离职的用户名
+	User string `json:"user"`
+	// 接手项目的用户名
+	TransferTo string `json:"transferTo,omitempty"`
+	// 用户负责的项目
+	Projects []ProjectOwnership `json:"projects"`
+}
+
+// ProjectOwnership 用户在项目中担任的负责人
+type ProjectOwnership struct {
+	ID   uint   `json:"id"`
+	Name string `json:"name"`
+	// 引用了该用户的负责人字段
+	Fields []string `json:"fields"`
+	// 是否已经转交
+	Transferred bool `json:"transferred"`
+}
+
+// Offboard 用户离职，禁用账号并吊销所有凭据，报告或转交用户负责的项目，可以重复执行
+func (uc *UserController) Offboard(c *gin.Context) {
+	id, err := view.GetID(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, web.ExceptResponse(errorMap[ErrID], err))
+		return
+	}
+	var f OffboardForm
+	if err := c.ShouldBindJSON(&f); err != nil && c.Request.ContentLength > 0 {
+		c.JSON(http.StatusBadRequest, web.ExceptResponse(errorMap[ErrInvalidParam], err))
+		return
+	}
+	if web.GetCurrentUser(c).ID == id {
+		c.JSON(http.StatusOK, web.ExceptResponse(errorMap[ErrOffboardSelf], ErrOffboardSelf))
+		return
+	}
+	var user models.User
+	if err := uc.Store.Get(context.TODO(), id, "", &user); err != nil {
+		c.JSON(http.StatusOK, web.ExceptResponse(errorMap[ErrGetUserFailed], err))
+		return
+	}
+	if user.Name == models.AdminName {
+		c.JSON(http.StatusOK, web.ExceptResponse(errorMap[ErrOffboardAdmin], ErrOffboardAdmin))
+		return
+	}
+	if f.TransferTo != "" {
+		var to models.User
+		if err := uc.Store.Get(context.TODO(), 0, f.TransferTo, &to); err != nil || !to.Enabled || to.ID == user.ID {
+			c.JSON(http.StatusOK, web.ExceptResponse(errorMap[ErrTransferUserInvalid], ErrTransferUserInvalid))
+			return
+		}
+	}
+	log.Infow("offboard user", "user", user.Name, "transferTo", f.TransferTo, "operator", web.GetCurrentUser(c).Name)
+	if err := uc.revokeCredentials(&user); err != nil {
+		c.JSON(http.StatusOK, web.ExceptResponse(errorMap[ErrOffboardFailed], err))
+		return
+	}
+	report := OffboardReport{User: user.Name, TransferTo: f.TransferTo, Projects: []ProjectOwnership{}}
+	var projects []models.Project
+	like := "%" + user.Name + "%"
+	if err := uc.Store.FindWhere(context.TODO(), &projects,
+		"owner LIKE ? OR product_owner LIKE ? OR test_owner LIKE ?", like, like, like); err != nil {
+		c.JSON(http.StatusOK, web.ExceptResponse(errorMap[ErrOffboardFailed], err))
+		return
+	}
+	for _, p := range projects {
+		// LIKE 只用于缩小范围，按用户名精确匹配
+		fields := p.OwnedBy(user.Name)
+		if len(fields) == 0 {
+			continue
+		}
+		po := ProjectOwnership{ID: p.ID, Name: p.Name, Fields: fields}
+		if f.TransferTo != "" {
+			if err := uc.Store.Update(context.TODO(), p.ID, "", &models.Project{},
+				p.TransferOwner(user.Name, f.TransferTo)); err != nil {
+				log.Errorw("transfer project owner error", "project", p.Name, "error", err)
+			} else {
+				po.Transferred = true
+			}
+		}
+		report.Projects = append(report.Projects, po)
+	}
+	c.JSON(http.StatusOK, web.DataResponse(report))
+}
+
+// revokeCredentials 禁用用户并吊销token、refresh token、访问令牌和重置密码令牌
+func (uc *UserController) revokeCredentials(user *models.User) error {
+	if err := uc.Store.Update(context.TODO(), user.ID, "", &models.User{},
+		map[string]interface{}{"enabled": false}); err != nil {
+		return err
+	}
+	if err := view.RevokeUserTokens(uc.Store, user.ID); err != nil {
+		return err
+	}
+	if err := view.RevokeAccessTokens(uc.Store, user.ID); err != nil {
+		return err
+	}
+	return uc.Store.DeleteWhere(context.TODO(), &models.PasswordResetToken{}, "user_id = ?", user.ID)
+}
@@ -0,0 +1,132 @@
+package user
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+	// 容器镜像中可能没有时区数据
+	_ "time/tzdata"
+
+	"github.com/gin-gonic/gin"
+	"github.com/hex-techs/blade/pkg/models"
+	"github.com/hex-techs/blade/pkg/utils/config"
+	"github.com/hex-techs/blade/pkg/utils/web"
+	"gorm.io/gorm"
+	"k8s.io/apimachinery/pkg/util/validation"
+)
+
+// Preferences 获取当前用户的偏好设置，没有保存过时返回空的设置
+func (uc *UserController) Preferences(c *gin.Context) {
+	u := web.GetCurrentUser(c)
+	if u.IsServiceAccount() {
+		c.JSON(http.StatusOK, web.ExceptResponse(errorMap[ErrNotUser], ErrNotUser))
+		return
+	}
+	var p models.UserPreference
+	if err := uc.Store.GetBy(context.TODO(), "user_id", u.ID, &p); err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		c.JSON(http.StatusOK, web.ExceptResponse(errorMap[ErrGetPreferencesFailed], err))
+		return
+	}
+	p.UserID = u.ID
+	if p.FavoriteModules == nil {
+		p.FavoriteModules = []uint{}
+	}
+	if p.FavoriteProjects == nil {
+		p.FavoriteProjects = []uint{}
+	}
+	c.JSON(http.StatusOK, web.DataResponse(p))
+}
+
+// UpdatePreferences 整体替换当前用户的偏好设置
+func (uc *UserController) UpdatePreferences(c *gin.Context) {
+	u := web.GetCurrentUser(c)
+	if u.IsServiceAccount() {
+		c.JSON(http.StatusOK, web.ExceptResponse(errorMap[ErrNotUser], ErrNotUser))
+		return
+	}
+	var p models.UserPreference
+	if err := c.ShouldBindJSON(&p); err != nil {
+		c.JSON(http.StatusBadRequest, web.ExceptResponse(errorMap[ErrInvalidParam], err))
+		return
+	}
+	if err := uc.validPreferences(&p); err != nil {
+		c.JSON(http.StatusBadRequest, web.ExceptResponse(errorMap[ErrInvalidParam], err))
+		return
+	}
+	p.UserID = u.ID
+	var old models.UserPreference
+	err := uc.Store.GetBy(context.TODO(), "user_id", u.ID, &old)
+	switch {
+	case err == nil:
+		p.ID, p.CreatedAt = old.ID, old.CreatedAt
+		err = uc.Store.ForceUpdate(context.TODO(), old.ID, "", &models.UserPreference{}, &p)
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		err = uc.Store.Create(context.TODO(), &p)
+	}
+	if err != nil {
+		c.JSON(http.StatusOK, web.ExceptResponse(errorMap[ErrUpdatePreferencesFailed], err))
+		return
+	}
+	uc.Preferences(c)
+}
+
+// validPreferences 校验时区、集群和命名空间，收藏的模块和项目去重后必须存在
+func (uc *UserController) validPreferences(p *models.UserPreference) error {
+	if p.Timezone != "" {
+		if _, err := time.LoadLocation(p.Timezone); err != nil || p.Timezone == "Local" {
+			return fmt.Errorf("invalid timezone %q", p.Timezone)
+		}
+	}
+	// 配置了集群时只能选择已配置的集群
+	if clusters := config.Read().Kubernetes.Clusters; p.DefaultCluster != "" && len(clusters) > 0 {
+		found := false
+		for _, cl := range clusters {
+			found = found || cl.Name == p.DefaultCluster
+		}
+		if !found {
+			return fmt.Errorf("cluster %q not found", p.DefaultCluster)
+		}
+	}
+	if p.DefaultNamespace != "" {
+		if errs := validation.IsDNS1123Label(p.DefaultNamespace); len(errs) > 0 {
+			return fmt.Errorf("invalid namespace %q: %s", p.DefaultNamespace, strings.Join(errs, ", "))
+		}
+	}
+	p.FavoriteModules = dedupe(p.FavoriteModules)
+	if len(p.FavoriteModules) > 0 {
+		var modules []models.Module
+		if err := uc.Store.FindWhere(context.TODO(), &modules, "id IN ?", p.FavoriteModules); err != nil {
+			return err
+		}
+		if len(modules) != len(p.FavoriteModules) {
+			return errors.New("favorite module not found")
+		}
+	}
+	p.FavoriteProjects = dedupe(p.FavoriteProjects)
+	if len(p.FavoriteProjects) > 0 {
+		var projects []models.Project
+		if err := uc.Store.FindWhere(context.TODO(), &projects, "id IN ?", p.FavoriteProjects); err != nil {
+			return err
+		}
+		if len(projects) != len(p.FavoriteProjects) {
+			return errors.New("favorite project not found")
+		}
+	}
+	return nil
+}
+
+// dedupe 去掉重复的id，保留原有顺序
+func dedupe(ids []uint) []uint {
+	seen := map[uint]bool{}
+	result := make([]uint, 0, len(ids))
+	for _, id := range ids {
+		if !seen[id] {
+			seen[id] = true
+			result = append(result, id)
+		}
+	}
+	return result
+}
@@ -0,0 +1,178 @@
+package user
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/fize/go-ext/log"
+	"github.com/gin-gonic/gin"
+	"github.com/hex-techs/blade/pkg/models"
+	"github.com/hex-techs/blade/pkg/utils/storage"
+	"github.com/hex-techs/blade/pkg/utils/token"
+	"github.com/hex-techs/blade/pkg/utils/web"
+	"github.com/hex-techs/blade/pkg/view"
+)
+
+// TokenController 个人访问令牌控制器，挂载在 /user/:id/token 下
+type TokenController struct {
+	web.DefaultController
+	Store *storage.Engine
+}
+
+// NewTokenController return a new personal access token controller
+func NewTokenController(s *storage.Engine) *TokenController {
+	return &TokenController{
+		Store: s,
+	}
+}
+
+// 资源名
+func (*TokenController) Name() string {
+	return "token"
+}
+
+// 写入的模型，按字段的write标签校验创建和更新请求
+func (*TokenController) Model() interface{} {
+	return &models.PersonalAccessToken{}
+}
+
+// Create 为自己创建访问令牌，令牌明文只在此时返回一次
+func (tc *TokenController) Create() (gin.HandlerFunc, error) {
+	return func(c *gin.Context) {
+		id, err := view.GetID(c)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, web.ExceptResponse(errorMap[ErrID], err))
+			return
+		}
+		u := web.GetCurrentUser(c)
+		if u.ID != id {
+			c.JSON(http.StatusOK, web.ExceptResponse(errorMap[ErrTokenOther], ErrTokenOther))
+			return
+		}
+		// 不允许使用访问令牌再创建访问令牌
+		if u.IsAccessToken() {
+			c.JSON(http.StatusOK, web.ExceptResponse(errorMap[ErrTokenByToken], ErrTokenByToken))
+			return
+		}
+		var pat models.PersonalAccessToken
+		if err := c.ShouldBindJSON(&pat); err != nil {
+			c.JSON(http.StatusBadRequest, web.ExceptResponse(errorMap[ErrInvalidParam], err))
+			return
+		}
+		pat.UserID = id
+		if err := pat.GenToken(); err != nil {
+			c.JSON(http.StatusOK, web.ExceptResponse(errorMap[ErrCreateTokenFailed], err))
+			return
+		}
+		log.Debugw("create access token", "user", u.Name, "name", pat.Name, "scopes", pat.Scopes)
+		if err := tc.Store.Create(context.TODO(), &pat); err != nil {
+			c.JSON(http.StatusOK, web.ExceptResponse(errorMap[ErrCreateTokenFailed], err))
+			return
+		}
+		c.JSON(http.StatusOK, web.DataResponse(pat))
+	}, nil
+}
+
+// Delete 吊销访问令牌，管理员可以吊销任意用户的令牌
+func (tc *TokenController) Delete() (gin.HandlerFunc, error) {
+	return func(c *gin.Context) {
+		id, err := view.GetID(c)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, web.ExceptResponse(errorMap[ErrID], err))
+			return
+		}
+		tid, err := strconv.Atoi(c.Param("tid"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, web.ExceptResponse(errorMap[ErrID], err))
+			return
+		}
+		u := web.GetCurrentUser(c)
+		if !u.Admin && u.ID != id {
+			c.JSON(http.StatusOK, web.ExceptResponse(errorMap[ErrTokenOther], ErrTokenOther))
+			return
+		}
+		var pat models.PersonalAccessToken
+		if err := tc.Store.Get(context.TODO(), uint(tid), "", &pat); err != nil || pat.UserID != id {
+			c.JSON(http.StatusOK, web.ExceptResponse(errorMap[ErrRevokeTokenFailed], "token not found"))
+			return
+		}
+		if err := tc.Store.Delete(context.TODO(), pat.ID, "", &models.PersonalAccessToken{}); err != nil {
+			c.JSON(http.StatusOK, web.ExceptResponse(errorMap[ErrRevokeTokenFailed], err))
+			return
+		}
+		c.JSON(http.StatusOK, web.OkResponse())
+	}, nil
+}
+
+// List 获取用户的访问令牌列表，不包含令牌明文
+func (tc *TokenController) List() (gin.HandlerFunc, error) {
+	return func(c *gin.Context) {
+		id, err := view.GetID(c)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, web.ExceptResponse(errorMap[ErrID], err))
+			return
+		}
+		u := web.GetCurrentUser(c)
+		if !u.Admin && u.ID != id {
+			c.JSON(http.StatusOK, web.ExceptResponse(errorMap[ErrTokenOther], ErrTokenOther))
+			return
+		}
+		var req web.Request
+		c.ShouldBindQuery(&req)
+		req.Default()
+		var pats []models.PersonalAccessToken
+		total, err := tc.Store.List(context.TODO(), req.Limit, req.Page, "user_id = "+fmt.Sprint(id), &pats)
+		if err != nil {
+			c.JSON(http.StatusOK, web.ExceptResponse(errorMap[ErrGetTokenListFailed], err))
+			return
+		}
+		c.JSON(http.StatusOK, web.ListResponse(int(total), pats))
+	}, nil
+}
+
+func (tc *TokenController) Middlewares() []web.MiddlewaresObject {
+	return []web.MiddlewaresObject{
+		{
+			Methods:     []string{web.CREATE},
+			Middlewares: []gin.HandlerFunc{web.LoginRequired(), web.NoImpersonation()},
+		},
+		{
+			Methods:     []string{web.DELETE, web.LIST},
+			Middlewares: []gin.HandlerFunc{web.LoginRequired()},
+		},
+	}
+}
+
+// Resolve 将访问令牌解析为所属用户的信息，供 web.LoginRequired 使用
+func (tc *TokenController) Resolve(t string) (*token.Claims, error) {
+	var pat models.PersonalAccessToken
+	if err := tc.Store.GetBy(context.TODO(), "hash", token.Hash(t), &pat); err != nil {
+		return nil, fmt.Errorf("access token invalid")
+	}
+	if err := pat.Validate(); err != nil {
+		return nil, err
+	}
+	var user models.User
+	if err := tc.Store.Get(context.TODO(), pat.UserID, "", &user); err != nil {
+		return nil, fmt.Errorf("access token owner invalid: %v", err)
+	}
+	if !user.Enabled {
+		return nil, fmt.Errorf("access token owner disabled")
+	}
+	// 降低写入频率，最近使用时间精确到分钟即可
+	if pat.LastUsedAt == nil || time.Since(*pat.LastUsedAt) > time.Minute {
+		if err := tc.Store.Update(context.TODO(), pat.ID, "", &models.PersonalAccessToken{},
+			map[string]interface{}{"last_used_at": time.Now()}); err != nil {
+			log.Warnw("update access token last used time error", "id", pat.ID, "error", err)
+		}
+	}
+	return &token.Claims{
+		ID:     user.ID,
+		Name:   user.Name,
+		Admin:  user.Admin,
+		Scopes: pat.Scopes,
+	}, nil
+}
@@ -6,7 +6,9 @@ import (
 
 	"github.com/fize/go-ext/log"
 	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
 	"github.com/hex-techs/blade/pkg/models"
+	"github.com/hex-techs/blade/pkg/utils/casbin"
 	"github.com/hex-techs/blade/pkg/utils/storage"
 	"github.com/hex-techs/blade/pkg/utils/web"
 	"github.com/hex-techs/blade/pkg/view"
@@ -15,13 +17,15 @@ import (
 // UserController user controller
 type UserController struct {
 	web.DefaultController
-	Store *storage.Engine
+	Store    *storage.Engine
+	Enforcer *casbin.Enforcer
 }
 
 // NewUserController return a new user controller
-func NewUserController(s *storage.Engine) web.RestController {
+func NewUserController(s *storage.Engine, e *casbin.Enforcer) *UserController {
 	return &UserController{
-		Store: s,
+		Store:    s,
+		Enforcer: e,
 	}
 }
 
@@ -30,6 +34,11 @@ func (*UserController) Name() string {
 	return "user"
 }
 
+// 写入的模型，按字段的write标签校验创建和更新请求
+func (*UserController) Model() interface{} {
+	return &models.User{}
+}
+
 // Create 创建新用户，只有管理员才能创建
 func (uc *UserController) Create() (gin.HandlerFunc, error) {
 	return func(c *gin.Context) {
@@ -38,11 +47,27 @@ func (uc *UserController) Create() (gin.HandlerFunc, error) {
 			c.JSON(http.StatusBadRequest, web.ExceptResponse(errorMap[ErrInvalidParam], err))
 			return
 		}
-		log.Debugf("create user: %v", user)
+		log.Debugf("create user: %s", user.Name)
+		violations, err := view.CheckPassword(uc.Store, &user, user.Password)
+		if err != nil {
+			c.JSON(http.StatusOK, web.ExceptResponse(errorMap[ErrCreateUserFailed], err))
+			return
+		}
+		if len(violations) > 0 {
+			c.JSON(http.StatusOK, web.ExceptDataResponse(errorMap[ErrPasswordPolicy], violations, ErrPasswordPolicy))
+			return
+		}
+		if err := user.EncodePasswd(); err != nil {
+			c.JSON(http.StatusOK, web.ExceptResponse(errorMap[ErrCreateUserFailed], err))
+			return
+		}
 		if err := uc.Store.Create(context.TODO(), &user); err != nil {
 			c.JSON(http.StatusOK, web.ExceptResponse(errorMap[ErrCreateUserFailed], err))
 			return
 		}
+		if err := view.RecordPassword(uc.Store, &user); err != nil {
+			log.Warnw("record password history error", "user", user.Name, "error", err)
+		}
 		c.JSON(http.StatusOK, web.OkResponse())
 	}, nil
 }
@@ -56,7 +81,7 @@ func (uc *UserController) Delete() (gin.HandlerFunc, error) {
 			return
 		}
 		u := web.GetCurrentUser(c)
-		if u.Name == "admin" {
+		if u.Name == models.AdminName {
 			c.JSON(http.StatusOK, web.ExceptResponse(errorMap[ErrDeleteAdmin], ErrDeleteAdmin))
 			return
 		}
@@ -65,10 +90,19 @@ func (uc *UserController) Delete() (gin.HandlerFunc, error) {
 			c.JSON(http.StatusOK, web.ExceptResponse(errorMap[ErrDeleteSelf], ErrDeleteSelf))
 			return
 		}
+		var user models.User
+		if err := uc.Store.Get(context.TODO(), id, "", &user); err != nil {
+			c.JSON(http.StatusOK, web.ExceptResponse(errorMap[ErrDeleteUserFailed], err))
+			return
+		}
 		if err := uc.Store.Delete(context.TODO(), id, "", &models.User{}); err != nil {
 			c.JSON(http.StatusOK, web.ExceptResponse(errorMap[ErrDeleteUserFailed], err))
 			return
 		}
+		// 删除用户的角色绑定，避免同名的新用户继承
+		if err := casbin.RemoveSubject(uc.Enforcer, user.Name); err != nil {
+			log.Errorw("remove user policies error", "user", user.Name, "error", err)
+		}
 		c.JSON(http.StatusOK, web.OkResponse())
 	}, nil
 }
@@ -81,23 +115,59 @@ func (uc *UserController) Update() (gin.HandlerFunc, error) {
 			c.JSON(http.StatusOK, web.ExceptResponse(errorMap[ErrID], err))
 			return
 		}
-		var user models.User
-		c.ShouldBindJSON(&user)
+		var (
+			user models.User
+			raw  map[string]interface{}
+		)
+		c.ShouldBindBodyWith(&user, binding.JSON)
+		c.ShouldBindBodyWith(&raw, binding.JSON)
 		u := web.GetCurrentUser(c)
 		log.Debugw("update user", "id", id, "user", user, "current user", u)
 		if !u.Admin && u.ID != id {
 			c.JSON(http.StatusOK, web.ExceptResponse(errorMap[ErrUpdateOther], ErrUpdateOther))
 			return
 		}
-		if err := uc.Store.Update(context.TODO(), id, "", &models.User{}, &user); err != nil {
+		// 只更新资料字段，用户名、管理员、启用状态、密码和邮箱等受保护的字段已被写入策略拒绝，这里不再信任请求体
+		profile := models.User{CnName: user.CnName, Phone: user.Phone, IM: user.IM}
+		if err := uc.Store.Update(context.TODO(), id, "", &models.User{}, &profile); err != nil {
 			c.JSON(http.StatusOK, web.ExceptResponse(errorMap[ErrUpdateUserFailed], err))
 			return
 		}
+		// 零值不会被更新，管理员修改管理员和启用状态需要单独处理，撤销权限时使该用户已签发的token全部失效
+		if u.Admin {
+			flags := map[string]interface{}{}
+			revoke := false
+			for _, k := range []string{"admin", "enabled"} {
+				if v, ok := raw[k].(bool); ok {
+					flags[k] = v
+					revoke = revoke || !v
+				}
+			}
+			if len(flags) > 0 {
+				if err := uc.Store.Update(context.TODO(), id, "", &models.User{}, flags); err != nil {
+					c.JSON(http.StatusOK, web.ExceptResponse(errorMap[ErrUpdateUserFailed], err))
+					return
+				}
+			}
+			if revoke {
+				if err := view.RevokeUserTokens(uc.Store, id); err != nil {
+					c.JSON(http.StatusOK, web.ExceptResponse(errorMap[ErrUpdateUserFailed], err))
+					return
+				}
+			}
+		}
 		// 刷新用户信息
-		if err := user.GenUser(); err != nil {
-			c.JSON(http.StatusOK, web.ExceptResponse(errorMap[ErrGenerateUserToken], err))
+		if err := uc.Store.Get(context.TODO(), id, "", &user); err != nil {
+			c.JSON(http.StatusOK, web.ExceptResponse(errorMap[ErrGetUserFailed], err))
 			return
 		}
+		// 只为自己在当前会话中重新签发token，不能替其他用户签发
+		if u.ID == id && u.SID != "" {
+			if err := user.GenUser(u.SID); err != nil {
+				c.JSON(http.StatusOK, web.ExceptResponse(errorMap[ErrGenerateUserToken], err))
+				return
+			}
+		}
 		user.TruncatePassword()
 		c.JSON(http.StatusOK, web.DataResponse(user))
 	}, nil
@@ -153,11 +223,11 @@ func (uc *UserController) List() (gin.HandlerFunc, error) {
 func (uc *UserController) Middlewares() []web.MiddlewaresObject {
 	return []web.MiddlewaresObject{
 		{
-			Methods:     []string{web.CREATE, web.DELETE},
-			Middlewares: []gin.HandlerFunc{web.LoginRequired(), web.AdminRequired()},
+			Methods:     []string{web.DELETE},
+			Middlewares: []gin.HandlerFunc{web.LoginRequired(), web.NoImpersonation()},
 		},
 		{
-			Methods:     []string{web.UPDATE, web.GET, web.LIST},
+			Methods:     []string{web.CREATE, web.UPDATE, web.GET, web.LIST},
 			Middlewares: []gin.HandlerFunc{web.LoginRequired()},
 		},
 	}
@@ -0,0 +1,83 @@
+package user
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/hex-techs/blade/pkg/models"
+	"github.com/hex-techs/blade/pkg/utils/token"
+	"github.com/hex-techs/blade/pkg/utils/web"
+)
+
+// update 以用户的身份修改用户资料
+func update(r *gin.Engine, u *models.User, id uint, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPut, fmt.Sprintf("/api/v1/user/%d", id), strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+u.Token.Token)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func TestUpdateRejectsRename(t *testing.T) {
+	r, uc := newTestServer(t)
+	alice := createUser(t, uc, "alice", false)
+	createUser(t, uc, "bob", false)
+	admin := createUser(t, uc, "root", true)
+
+	// 普通用户不能改名为其他用户，管理员也不能修改用户名
+	for _, u := range []*models.User{alice, admin} {
+		w := update(r, u, alice.ID, `{"name":"bob","cnName":"bob"}`)
+		if w.Code != http.StatusForbidden || !strings.Contains(w.Body.String(), `"name`) {
+			t.Fatalf("rename by %s: code %d, body %s", u.Name, w.Code, w.Body.String())
+		}
+	}
+	var saved models.User
+	if err := uc.Store.Get(context.TODO(), alice.ID, "", &saved); err != nil {
+		t.Fatal(err)
+	}
+	if saved.Name != "alice" || saved.CnName != "alice" {
+		t.Fatalf("user was renamed: %+v", saved)
+	}
+}
+
+func TestUpdateIgnoresName(t *testing.T) {
+	r, uc := newTestServer(t)
+	alice := createUser(t, uc, "alice", false)
+	h, err := uc.Update()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 即使请求绕过了写入策略，也不会修改用户名
+	r.PUT("/unchecked/:id", func(c *gin.Context) {
+		c.Set(web.CurrentUser, &token.Claims{ID: alice.ID, Name: alice.Name, SID: "test"})
+	}, h)
+	req := httptest.NewRequest(http.MethodPut, fmt.Sprintf("/unchecked/%d", alice.ID),
+		strings.NewReader(`{"name":"bob","cnName":"爱丽丝"}`))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	var resp struct {
+		Data models.User `json:"data"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	if resp.Data.Name != "alice" || resp.Data.CnName != "爱丽丝" {
+		t.Fatalf("unexpected user %+v", resp.Data)
+	}
+	// 重新签发的token仍然是原来的用户名
+	claims, err := token.ParseJWTToken(resp.Data.Token.Token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if claims.Name != "alice" {
+		t.Fatalf("token issued for %q", claims.Name)
+	}
+}
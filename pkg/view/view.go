@@ -1,9 +1,13 @@
 package view
 
 import (
+	"context"
 	"strconv"
 
 	"github.com/gin-gonic/gin"
+	"github.com/hex-techs/blade/pkg/models"
+	"github.com/hex-techs/blade/pkg/utils/storage"
+	"gorm.io/gorm"
 )
 
 func GetID(c *gin.Context) (uint, error) {
@@ -13,3 +17,28 @@ func GetID(c *gin.Context) (uint, error) {
 	}
 	return uint(i), nil
 }
+
+// RevokeUserTokens 递增用户的token版本号并删除所有会话和refresh token，使该用户已签发的token全部失效
+func RevokeUserTokens(s *storage.Engine, id uint) error {
+	if err := s.Update(context.TODO(), id, "", &models.User{},
+		map[string]interface{}{"token_version": gorm.Expr("token_version + 1")}); err != nil {
+		return err
+	}
+	if err := s.DeleteWhere(context.TODO(), &models.Session{}, "user_id = ?", id); err != nil {
+		return err
+	}
+	return s.DeleteWhere(context.TODO(), &models.RefreshToken{}, "user_id = ?", id)
+}
+
+// RevokeAccessTokens 删除用户的所有个人访问令牌，修改或重置密码后旧的令牌不能继续使用
+func RevokeAccessTokens(s *storage.Engine, id uint) error {
+	return s.DeleteWhere(context.TODO(), &models.PersonalAccessToken{}, "user_id = ?", id)
+}
+
+// RevokeSession 删除会话及其refresh token，会话中签发的token随之失效
+func RevokeSession(s *storage.Engine, sid string) error {
+	if err := s.DeleteWhere(context.TODO(), &models.Session{}, "sid = ?", sid); err != nil {
+		return err
+	}
+	return s.DeleteWhere(context.TODO(), &models.RefreshToken{}, "family = ?", sid)
+}